@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/fakeskinport"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	options := fakeskinport.DefaultOptions()
+
+	addr := flag.String("addr", ":8090", "address to listen on")
+	flag.StringVar(&options.FixturesDir, "fixtures", options.FixturesDir, "directory with recorded responses")
+	flag.DurationVar(&options.Latency, "latency", 0, "delay added to every response")
+	flag.Float64Var(&options.RateLimitRate, "rate-limit-rate", 0, "probability of answering 429, from 0 to 1")
+	flag.Float64Var(&options.ErrorRate, "error-rate", 0, "probability of answering -error-status, from 0 to 1")
+	flag.IntVar(&options.ErrorStatus, "error-status", options.ErrorStatus, "status of injected errors")
+	flag.DurationVar(&options.RetryAfter, "retry-after", options.RetryAfter, "Retry-After of injected 429 responses")
+	flag.StringVar(&options.RecordURL, "record", "", "upstream base URL to record fixtures from, e.g. https://api.skinport.com/v1")
+	flag.Parse()
+
+	log := logrus.New()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: fakeskinport.New(options, &http.Client{Timeout: 30 * time.Second}, log),
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		if options.RecordURL != "" {
+			log.Infof("Recording %s into %s", options.RecordURL, options.FixturesDir)
+		}
+		log.Infof("Running fake SkinPort on %s", *addr)
+
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.WithError(err).Fatal("Fake SkinPort stopped unexpectedly")
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = server.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,407 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/alert/domain"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var logger = logrus.New()
+
+type repositoryMock struct {
+	mu       sync.Mutex
+	err      error
+	alerts   []domain.Alert
+	triggers []domain.Trigger
+}
+
+func (r *repositoryMock) UserExists(_ context.Context, userId int64) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	return userId == 1, nil
+}
+
+func (r *repositoryMock) CreateAlert(_ context.Context, a domain.Alert) (domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return domain.Alert{}, r.err
+	}
+
+	a.Id = int64(len(r.alerts) + 1)
+	a.CreatedAt = time.Now()
+	r.alerts = append(r.alerts, a)
+
+	return a, nil
+}
+
+func (r *repositoryMock) GetUserAlerts(_ context.Context, userId int64) ([]domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var alerts []domain.Alert
+	for _, a := range r.alerts {
+		if a.UserId == userId {
+			alerts = append(alerts, a)
+		}
+	}
+
+	return alerts, r.err
+}
+
+func (r *repositoryMock) GetUserAlert(_ context.Context, userId int64, alertId int64) (domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range r.alerts {
+		if a.UserId == userId && a.Id == alertId {
+			return a, nil
+		}
+	}
+
+	return domain.Alert{}, sql.ErrNoRows
+}
+
+func (r *repositoryMock) UpdateAlert(_ context.Context, a domain.Alert) (domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.alerts {
+		if r.alerts[i].UserId == a.UserId && r.alerts[i].Id == a.Id {
+			r.alerts[i].Direction = a.Direction
+			r.alerts[i].Threshold = a.Threshold
+			r.alerts[i].Active = a.Active
+			r.alerts[i].Triggered = false
+			return r.alerts[i], nil
+		}
+	}
+
+	return domain.Alert{}, sql.ErrNoRows
+}
+
+func (r *repositoryMock) DeleteAlert(_ context.Context, userId int64, alertId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.alerts {
+		if r.alerts[i].UserId == userId && r.alerts[i].Id == alertId {
+			r.alerts = append(r.alerts[:i], r.alerts[i+1:]...)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (r *repositoryMock) GetActiveAlerts(_ context.Context, appId int, currency string) ([]domain.Alert, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var alerts []domain.Alert
+	for _, a := range r.alerts {
+		if a.AppId == appId && a.Currency == currency && a.Active {
+			alerts = append(alerts, a)
+		}
+	}
+
+	return alerts, r.err
+}
+
+func (r *repositoryMock) SaveEvaluation(_ context.Context, triggers []domain.Trigger, rearmedIds []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range triggers {
+		t.Id = int64(len(r.triggers) + 1)
+		t.CreatedAt = time.Now()
+		r.triggers = append(r.triggers, t)
+		r.setTriggered(t.AlertId, true)
+	}
+
+	for _, id := range rearmedIds {
+		r.setTriggered(id, false)
+	}
+
+	return nil
+}
+
+func (r *repositoryMock) setTriggered(alertId int64, triggered bool) {
+	for i := range r.alerts {
+		if r.alerts[i].Id == alertId {
+			r.alerts[i].Triggered = triggered
+		}
+	}
+}
+
+func (r *repositoryMock) GetUserTriggers(_ context.Context, userId int64, afterId int64, limit int) ([]domain.Trigger, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var triggers []domain.Trigger
+	for _, t := range r.triggers {
+		if t.UserId == userId && t.Id > afterId && len(triggers) < limit {
+			triggers = append(triggers, t)
+		}
+	}
+
+	return triggers, r.err
+}
+
+func newTestHandler(repository *repositoryMock) (*Handler, *Service) {
+	svc := NewService(logger, repository)
+	return NewHandler(svc), svc
+}
+
+func createAlert(t *testing.T, handler *Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/alerts", strings.NewReader(body))
+	req.SetPathValue("id", "1")
+
+	handler.CreateAlert(rec, req)
+
+	return rec
+}
+
+func getTriggers(t *testing.T, handler *Handler, afterId string) TriggersResponseDTO {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/alerts/triggered?after_id="+afterId, nil)
+	req.SetPathValue("id", "1")
+
+	handler.GetTriggers(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var res TriggersResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func catalogWithPrice(price float64) []item.GetItemsResponseDto {
+	return []item.GetItemsResponseDto{
+		{MarketHashName: "AK-47 | Redline (Field-Tested)", TradableMinPrice: &price},
+	}
+}
+
+func TestCreateAlertOk(t *testing.T) {
+	handler, _ := newTestHandler(&repositoryMock{})
+
+	rec := createAlert(t, handler, `{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+
+	var res AlertResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.AppId != item.DefaultAppId || res.Currency != item.DefaultCurrency {
+		t.Fatalf("expected default catalog, got %d:%s", res.AppId, res.Currency)
+	}
+
+	if !res.Active || res.Triggered {
+		t.Fatalf("expected active and not triggered alert, got %+v", res)
+	}
+}
+
+func TestCreateAlertWithInvalidBody(t *testing.T) {
+	handler, _ := newTestHandler(&repositoryMock{})
+
+	bodies := []string{
+		`{"market_hash_name": "", "direction": "below", "threshold": 10}`,
+		`{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "sideways", "threshold": 10}`,
+		`{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "above", "threshold": 0}`,
+		`{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "above", "threshold": 10, "app_id": 1}`,
+		`{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "above", "threshold": 10, "currency": "XXX"}`,
+		`{"market_hash_name": `,
+	}
+
+	for _, body := range bodies {
+		rec := createAlert(t, handler, body)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestCreateAlertForUnexistingUser(t *testing.T) {
+	handler, _ := newTestHandler(&repositoryMock{})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/2/alerts", strings.NewReader(`{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`))
+	req.SetPathValue("id", "2")
+
+	handler.CreateAlert(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestCreateAlertErrorFromRepository(t *testing.T) {
+	handler, _ := newTestHandler(&repositoryMock{err: errors.New("repository error")})
+
+	rec := createAlert(t, handler, `{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
+
+func TestUpdateAndDeleteAlert(t *testing.T) {
+	handler, _ := newTestHandler(&repositoryMock{})
+
+	createAlert(t, handler, `{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/1/alerts/1", strings.NewReader(`{"direction": "above", "threshold": 20, "active": false}`))
+	req.SetPathValue("id", "1")
+	req.SetPathValue("alert_id", "1")
+
+	handler.UpdateAlert(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var res AlertResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Direction != DirectionAbove || res.Threshold != 20 || res.Active {
+		t.Fatalf("expected updated alert, got %+v", res)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/users/1/alerts/1", nil)
+	req.SetPathValue("id", "1")
+	req.SetPathValue("alert_id", "1")
+
+	handler.DeleteAlert(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/users/1/alerts/1", nil)
+	req.SetPathValue("id", "1")
+	req.SetPathValue("alert_id", "1")
+
+	handler.GetAlert(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAlertFiresOncePerCrossing(t *testing.T) {
+	handler, svc := newTestHandler(&repositoryMock{})
+
+	createAlert(t, handler, `{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`)
+
+	ctx := context.Background()
+
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(12), time.Now())
+	if res := getTriggers(t, handler, "0"); len(res.Triggers) != 0 {
+		t.Fatalf("expected no triggers above threshold, got %d", len(res.Triggers))
+	}
+
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(9), time.Now())
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(8), time.Now())
+
+	res := getTriggers(t, handler, "0")
+	if len(res.Triggers) != 1 {
+		t.Fatalf("expected 1 trigger while price stays below threshold, got %d", len(res.Triggers))
+	}
+
+	if res.Triggers[0].Price != 9 {
+		t.Fatalf("expected trigger price 9, got %v", res.Triggers[0].Price)
+	}
+
+	// The price goes back above the threshold, so the next drop fires again
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(11), time.Now())
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(7), time.Now())
+
+	next := getTriggers(t, handler, "1")
+	if len(next.Triggers) != 1 || next.Triggers[0].Price != 7 {
+		t.Fatalf("expected 1 new trigger at price 7, got %+v", next.Triggers)
+	}
+
+	if next.LastId != 2 {
+		t.Fatalf("expected last_id 2, got %d", next.LastId)
+	}
+}
+
+func TestAlertKeptWhileItemIsMissing(t *testing.T) {
+	handler, svc := newTestHandler(&repositoryMock{})
+
+	createAlert(t, handler, `{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`)
+
+	ctx := context.Background()
+
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(9), time.Now())
+
+	// The item is missing from a partial refresh and then comes back at the same price
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, []item.GetItemsResponseDto{}, time.Now())
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, []item.GetItemsResponseDto{
+		{MarketHashName: "AK-47 | Redline (Field-Tested)"},
+	}, time.Now())
+	svc.OnCatalogRefresh(ctx, item.DefaultAppId, item.DefaultCurrency, catalogWithPrice(9), time.Now())
+
+	if res := getTriggers(t, handler, "0"); len(res.Triggers) != 1 {
+		t.Fatalf("expected the alert not to fire again after the item came back, got %d triggers", len(res.Triggers))
+	}
+}
+
+func TestAlertIgnoresOtherCatalogs(t *testing.T) {
+	handler, svc := newTestHandler(&repositoryMock{})
+
+	createAlert(t, handler, `{"market_hash_name": "AK-47 | Redline (Field-Tested)", "direction": "below", "threshold": 10}`)
+
+	svc.OnCatalogRefresh(context.Background(), item.DefaultAppId, "USD", catalogWithPrice(1), time.Now())
+
+	if res := getTriggers(t, handler, "0"); len(res.Triggers) != 0 {
+		t.Fatalf("expected no triggers for another currency, got %d", len(res.Triggers))
+	}
+}
+
+func TestGetTriggersWithInvalidQuery(t *testing.T) {
+	handler, _ := newTestHandler(&repositoryMock{})
+
+	for _, query := range []string{"after_id=-1", "after_id=abc", "limit=0", "limit=1001"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/alerts/triggered?"+query, nil)
+		req.SetPathValue("id", "1")
+
+		handler.GetTriggers(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
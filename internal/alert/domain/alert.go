@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+type Alert struct {
+	Id             int64
+	UserId         int64
+	AppId          int
+	Currency       string
+	MarketHashName string
+	Direction      string
+	Threshold      float64
+	Active         bool
+	Triggered      bool
+	CreatedAt      time.Time
+	UpdatedAt      *time.Time
+}
+
+type Trigger struct {
+	Id             int64
+	AlertId        int64
+	UserId         int64
+	MarketHashName string
+	Direction      string
+	Threshold      float64
+	Price          float64
+	CreatedAt      time.Time
+}
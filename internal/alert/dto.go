@@ -0,0 +1,63 @@
+package alert
+
+import "time"
+
+type CreateAlertRequestBody struct {
+	AppId          int     `json:"app_id"`
+	Currency       string  `json:"currency"`
+	MarketHashName string  `json:"market_hash_name"`
+	Direction      string  `json:"direction"`
+	Threshold      float64 `json:"threshold"`
+}
+
+type UpdateAlertRequestBody struct {
+	Direction string  `json:"direction"`
+	Threshold float64 `json:"threshold"`
+	Active    *bool   `json:"active"`
+}
+
+type CreateAlertRequestDTO struct {
+	UserId         int64
+	AppId          int
+	Currency       string
+	MarketHashName string
+	Direction      string
+	Threshold      float64
+}
+
+type UpdateAlertRequestDTO struct {
+	UserId    int64
+	AlertId   int64
+	Direction string
+	Threshold float64
+	Active    bool
+}
+
+type AlertResponseDTO struct {
+	Id             int64      `json:"id"`
+	UserId         int64      `json:"user_id"`
+	AppId          int        `json:"app_id"`
+	Currency       string     `json:"currency"`
+	MarketHashName string     `json:"market_hash_name"`
+	Direction      string     `json:"direction"`
+	Threshold      float64    `json:"threshold"`
+	Active         bool       `json:"active"`
+	Triggered      bool       `json:"triggered"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+}
+
+type TriggerResponseDTO struct {
+	Id             int64     `json:"id"`
+	AlertId        int64     `json:"alert_id"`
+	MarketHashName string    `json:"market_hash_name"`
+	Direction      string    `json:"direction"`
+	Threshold      float64   `json:"threshold"`
+	Price          float64   `json:"price"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type TriggersResponseDTO struct {
+	Triggers []TriggerResponseDTO `json:"triggers"`
+	LastId   int64                `json:"last_id"`
+}
@@ -0,0 +1,252 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	"github.com/bdzhalalov/kolikosoft-trade/pkg/render"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTriggersLimit = 100
+	MaxTriggersLimit     = 1000
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+func (h *Handler) CreateAlert(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var body CreateAlertRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.AppId == 0 {
+		body.AppId = item.DefaultAppId
+	}
+
+	if body.Currency == "" {
+		body.Currency = item.DefaultCurrency
+	}
+
+	key := item.CatalogKey{AppId: body.AppId, Currency: strings.ToUpper(body.Currency)}
+	if err := key.Validate(); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(body.MarketHashName) == "" {
+		render.JSON(w, "invalid market_hash_name: must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validateCondition(body.Direction, body.Threshold); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dto := CreateAlertRequestDTO{
+		UserId:         userId,
+		AppId:          key.AppId,
+		Currency:       key.Currency,
+		MarketHashName: body.MarketHashName,
+		Direction:      body.Direction,
+		Threshold:      body.Threshold,
+	}
+
+	res, e := h.service.CreateAlert(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusCreated)
+}
+
+func (h *Handler) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	res, e := h.service.GetAlerts(ctx, userId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) GetAlert(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, alertId, ok := h.parseAlertPath(w, r)
+	if !ok {
+		return
+	}
+
+	res, e := h.service.GetAlert(ctx, userId, alertId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) UpdateAlert(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, alertId, ok := h.parseAlertPath(w, r)
+	if !ok {
+		return
+	}
+
+	var body UpdateAlertRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validateCondition(body.Direction, body.Threshold); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dto := UpdateAlertRequestDTO{
+		UserId:    userId,
+		AlertId:   alertId,
+		Direction: body.Direction,
+		Threshold: body.Threshold,
+		Active:    body.Active == nil || *body.Active,
+	}
+
+	res, e := h.service.UpdateAlert(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, alertId, ok := h.parseAlertPath(w, r)
+	if !ok {
+		return
+	}
+
+	if e := h.service.DeleteAlert(ctx, userId, alertId); e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetTriggers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var afterId int64
+	if raw := r.URL.Query().Get("after_id"); raw != "" {
+		afterId, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || afterId < 0 {
+			render.JSON(w, "invalid after_id: must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := DefaultTriggersLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > MaxTriggersLimit {
+			render.JSON(w, fmt.Sprintf("invalid limit: must be between 1 and %d", MaxTriggersLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, e := h.service.GetTriggers(ctx, userId, afterId, limit)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) parseAlertPath(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	userId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	alertId, err := h.parseId(r, "alert_id")
+	if err != nil {
+		render.JSON(w, "invalid alert id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return userId, alertId, true
+}
+
+func (h *Handler) parseId(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid id")
+	}
+
+	return id, nil
+}
+
+func (h *Handler) validateCondition(direction string, threshold float64) error {
+	if direction != DirectionBelow && direction != DirectionAbove {
+		return errors.New("invalid direction: must be below or above")
+	}
+
+	if threshold <= 0 {
+		return errors.New("invalid threshold: must be greater than 0")
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/alert/domain"
+	"github.com/lib/pq"
+)
+
+const alertColumns = `
+	id, user_id, app_id, currency, market_hash_name, direction, threshold, active, is_triggered, created_at, updated_at
+`
+
+const triggerColumns = `
+	id, alert_id, user_id, market_hash_name, direction, threshold, price, created_at
+`
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAlert(row scanner) (domain.Alert, error) {
+	var a domain.Alert
+	err := row.Scan(
+		&a.Id,
+		&a.UserId,
+		&a.AppId,
+		&a.Currency,
+		&a.MarketHashName,
+		&a.Direction,
+		&a.Threshold,
+		&a.Active,
+		&a.Triggered,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	return a, err
+}
+
+func (r *Repository) UserExists(ctx context.Context, userId int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, userId).Scan(&exists)
+	return exists, err
+}
+
+func (r *Repository) CreateAlert(ctx context.Context, a domain.Alert) (domain.Alert, error) {
+	row := r.db.QueryRowContext(ctx, `
+		INSERT INTO price_alerts(user_id, app_id, currency, market_hash_name, direction, threshold, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+alertColumns,
+		a.UserId, a.AppId, a.Currency, a.MarketHashName, a.Direction, a.Threshold, a.Active,
+	)
+
+	return scanAlert(row)
+}
+
+func (r *Repository) GetUserAlerts(ctx context.Context, userId int64) ([]domain.Alert, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM price_alerts
+		WHERE user_id = $1
+		ORDER BY id
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanAlerts(rows)
+}
+
+func (r *Repository) GetUserAlert(ctx context.Context, userId int64, alertId int64) (domain.Alert, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM price_alerts
+		WHERE user_id = $1 AND id = $2
+	`, userId, alertId)
+
+	return scanAlert(row)
+}
+
+func (r *Repository) UpdateAlert(ctx context.Context, a domain.Alert) (domain.Alert, error) {
+	row := r.db.QueryRowContext(ctx, `
+		UPDATE price_alerts
+		SET direction = $3, threshold = $4, active = $5, is_triggered = FALSE
+		WHERE user_id = $1 AND id = $2
+		RETURNING `+alertColumns,
+		a.UserId, a.Id, a.Direction, a.Threshold, a.Active,
+	)
+
+	return scanAlert(row)
+}
+
+func (r *Repository) DeleteAlert(ctx context.Context, userId int64, alertId int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM price_alerts WHERE user_id = $1 AND id = $2`, userId, alertId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *Repository) GetActiveAlerts(ctx context.Context, appId int, currency string) ([]domain.Alert, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM price_alerts
+		WHERE app_id = $1 AND currency = $2 AND active
+	`, appId, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanAlerts(rows)
+}
+
+// SaveEvaluation records fired alerts and re-arms alerts whose condition is no
+// longer met, so each alert fires once per threshold crossing.
+func (r *Repository) SaveEvaluation(ctx context.Context, triggers []domain.Trigger, rearmedIds []int64) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	triggeredIds := make([]int64, 0, len(triggers))
+
+	for _, t := range triggers {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO price_alert_triggers(alert_id, user_id, market_hash_name, direction, threshold, price)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, t.AlertId, t.UserId, t.MarketHashName, t.Direction, t.Threshold, t.Price)
+		if err != nil {
+			return err
+		}
+
+		triggeredIds = append(triggeredIds, t.AlertId)
+	}
+
+	if len(triggeredIds) > 0 {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE price_alerts SET is_triggered = TRUE WHERE id = ANY($1)
+		`, pq.Array(triggeredIds))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(rearmedIds) > 0 {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE price_alerts SET is_triggered = FALSE WHERE id = ANY($1)
+		`, pq.Array(rearmedIds))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) GetUserTriggers(ctx context.Context, userId int64, afterId int64, limit int) ([]domain.Trigger, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+triggerColumns+`
+		FROM price_alert_triggers
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, userId, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var triggers []domain.Trigger
+
+	for rows.Next() {
+		var t domain.Trigger
+
+		err := rows.Scan(
+			&t.Id,
+			&t.AlertId,
+			&t.UserId,
+			&t.MarketHashName,
+			&t.Direction,
+			&t.Threshold,
+			&t.Price,
+			&t.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		triggers = append(triggers, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return triggers, nil
+}
+
+func (r *Repository) scanAlerts(rows *sql.Rows) ([]domain.Alert, error) {
+	defer rows.Close()
+
+	var alerts []domain.Alert
+
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		alerts = append(alerts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,12 @@
+package alert
+
+import "net/http"
+
+func RegisterRoutes(mux *http.ServeMux, h *Handler) {
+	mux.HandleFunc("POST /users/{id}/alerts", h.CreateAlert)
+	mux.HandleFunc("GET /users/{id}/alerts", h.GetAlerts)
+	mux.HandleFunc("GET /users/{id}/alerts/triggered", h.GetTriggers)
+	mux.HandleFunc("GET /users/{id}/alerts/{alert_id}", h.GetAlert)
+	mux.HandleFunc("PUT /users/{id}/alerts/{alert_id}", h.UpdateAlert)
+	mux.HandleFunc("DELETE /users/{id}/alerts/{alert_id}", h.DeleteAlert)
+}
@@ -0,0 +1,268 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/alert/domain"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	customError "github.com/bdzhalalov/kolikosoft-trade/pkg/error"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	DirectionBelow = "below"
+	DirectionAbove = "above"
+)
+
+type RepositoryInterface interface {
+	UserExists(ctx context.Context, userId int64) (bool, error)
+	CreateAlert(ctx context.Context, a domain.Alert) (domain.Alert, error)
+	GetUserAlerts(ctx context.Context, userId int64) ([]domain.Alert, error)
+	GetUserAlert(ctx context.Context, userId int64, alertId int64) (domain.Alert, error)
+	UpdateAlert(ctx context.Context, a domain.Alert) (domain.Alert, error)
+	DeleteAlert(ctx context.Context, userId int64, alertId int64) error
+	GetActiveAlerts(ctx context.Context, appId int, currency string) ([]domain.Alert, error)
+	SaveEvaluation(ctx context.Context, triggers []domain.Trigger, rearmedIds []int64) error
+	GetUserTriggers(ctx context.Context, userId int64, afterId int64, limit int) ([]domain.Trigger, error)
+}
+
+type Service struct {
+	logger     *logrus.Logger
+	repository RepositoryInterface
+}
+
+func NewService(logger *logrus.Logger, repository RepositoryInterface) *Service {
+	return &Service{
+		logger,
+		repository,
+	}
+}
+
+func (s *Service) CreateAlert(ctx context.Context, data CreateAlertRequestDTO) (AlertResponseDTO, *customError.BaseError) {
+	if e := s.checkUser(ctx, data.UserId); e != nil {
+		return AlertResponseDTO{}, e
+	}
+
+	res, err := s.repository.CreateAlert(ctx, domain.Alert{
+		UserId:         data.UserId,
+		AppId:          data.AppId,
+		Currency:       data.Currency,
+		MarketHashName: data.MarketHashName,
+		Direction:      data.Direction,
+		Threshold:      data.Threshold,
+		Active:         true,
+	})
+	if err != nil {
+		s.logger.Errorf("Error while creating price alert: %s", err)
+		return AlertResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	return s.getAlertDTO(res), nil
+}
+
+func (s *Service) GetAlerts(ctx context.Context, userId int64) ([]AlertResponseDTO, *customError.BaseError) {
+	if e := s.checkUser(ctx, userId); e != nil {
+		return []AlertResponseDTO{}, e
+	}
+
+	res, err := s.repository.GetUserAlerts(ctx, userId)
+	if err != nil {
+		s.logger.Errorf("Error while getting price alerts by user ID: %s", err)
+		return []AlertResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	DTOs := make([]AlertResponseDTO, 0, len(res))
+	for _, a := range res {
+		DTOs = append(DTOs, s.getAlertDTO(a))
+	}
+
+	return DTOs, nil
+}
+
+func (s *Service) GetAlert(ctx context.Context, userId int64, alertId int64) (AlertResponseDTO, *customError.BaseError) {
+	res, err := s.repository.GetUserAlert(ctx, userId, alertId)
+	if err != nil {
+		return AlertResponseDTO{}, s.handleAlertError(err, "Error while getting price alert by ID: %s")
+	}
+
+	return s.getAlertDTO(res), nil
+}
+
+func (s *Service) UpdateAlert(ctx context.Context, data UpdateAlertRequestDTO) (AlertResponseDTO, *customError.BaseError) {
+	res, err := s.repository.UpdateAlert(ctx, domain.Alert{
+		Id:        data.AlertId,
+		UserId:    data.UserId,
+		Direction: data.Direction,
+		Threshold: data.Threshold,
+		Active:    data.Active,
+	})
+	if err != nil {
+		return AlertResponseDTO{}, s.handleAlertError(err, "Error while updating price alert: %s")
+	}
+
+	return s.getAlertDTO(res), nil
+}
+
+func (s *Service) DeleteAlert(ctx context.Context, userId int64, alertId int64) *customError.BaseError {
+	if err := s.repository.DeleteAlert(ctx, userId, alertId); err != nil {
+		return s.handleAlertError(err, "Error while deleting price alert: %s")
+	}
+
+	return nil
+}
+
+func (s *Service) GetTriggers(
+	ctx context.Context,
+	userId int64,
+	afterId int64,
+	limit int,
+) (TriggersResponseDTO, *customError.BaseError) {
+	if e := s.checkUser(ctx, userId); e != nil {
+		return TriggersResponseDTO{}, e
+	}
+
+	res, err := s.repository.GetUserTriggers(ctx, userId, afterId, limit)
+	if err != nil {
+		s.logger.Errorf("Error while getting triggered price alerts by user ID: %s", err)
+		return TriggersResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	dto := TriggersResponseDTO{
+		Triggers: make([]TriggerResponseDTO, 0, len(res)),
+		LastId:   afterId,
+	}
+
+	for _, t := range res {
+		dto.Triggers = append(dto.Triggers, TriggerResponseDTO{
+			Id:             t.Id,
+			AlertId:        t.AlertId,
+			MarketHashName: t.MarketHashName,
+			Direction:      t.Direction,
+			Threshold:      t.Threshold,
+			Price:          t.Price,
+			CreatedAt:      t.CreatedAt,
+		})
+		dto.LastId = t.Id
+	}
+
+	return dto, nil
+}
+
+// OnCatalogRefresh evaluates active alerts of the refreshed catalog against
+// the tradable min price of their items. It talks to the database, so it is
+// registered behind an item.QueuedListener.
+func (s *Service) OnCatalogRefresh(
+	ctx context.Context,
+	appId int,
+	currency string,
+	items []item.GetItemsResponseDto,
+	_ time.Time,
+) {
+	alerts, err := s.repository.GetActiveAlerts(ctx, appId, currency)
+	if err != nil {
+		s.logger.Errorf("Error while getting active price alerts: %s", err)
+		return
+	}
+
+	if len(alerts) == 0 {
+		return
+	}
+
+	prices := make(map[string]*float64, len(items))
+	for i := range items {
+		prices[items[i].MarketHashName] = items[i].TradableMinPrice
+	}
+
+	var (
+		triggers   []domain.Trigger
+		rearmedIds []int64
+	)
+
+	for _, a := range alerts {
+		// An item missing from a refresh, e.g. when a provider failed, keeps
+		// the alert as it is instead of re-arming it
+		price := prices[a.MarketHashName]
+		if price == nil {
+			continue
+		}
+
+		matched := s.matches(a, *price)
+
+		switch {
+		case matched && !a.Triggered:
+			triggers = append(triggers, domain.Trigger{
+				AlertId:        a.Id,
+				UserId:         a.UserId,
+				MarketHashName: a.MarketHashName,
+				Direction:      a.Direction,
+				Threshold:      a.Threshold,
+				Price:          *price,
+			})
+		case !matched && a.Triggered:
+			rearmedIds = append(rearmedIds, a.Id)
+		}
+	}
+
+	if len(triggers) == 0 && len(rearmedIds) == 0 {
+		return
+	}
+
+	if err := s.repository.SaveEvaluation(ctx, triggers, rearmedIds); err != nil {
+		s.logger.Errorf("Error while saving price alerts evaluation: %s", err)
+		return
+	}
+
+	if len(triggers) > 0 {
+		s.logger.Infof("Triggered %d price alerts for app %d in %s", len(triggers), appId, currency)
+	}
+}
+
+func (s *Service) matches(a domain.Alert, price float64) bool {
+	if a.Direction == DirectionBelow {
+		return price < a.Threshold
+	}
+
+	return price > a.Threshold
+}
+
+func (s *Service) checkUser(ctx context.Context, userId int64) *customError.BaseError {
+	exists, err := s.repository.UserExists(ctx, userId)
+	if err != nil {
+		s.logger.Errorf("Error while getting user by ID: %s", err)
+		return (&customError.InternalServerError{}).New()
+	}
+
+	if !exists {
+		return (&customError.NotFoundError{}).New("User not found")
+	}
+
+	return nil
+}
+
+func (s *Service) handleAlertError(err error, message string) *customError.BaseError {
+	if errors.Is(err, sql.ErrNoRows) {
+		return (&customError.NotFoundError{}).New("Alert not found")
+	}
+
+	s.logger.Errorf(message, err)
+
+	return (&customError.InternalServerError{}).New()
+}
+
+func (s *Service) getAlertDTO(a domain.Alert) AlertResponseDTO {
+	return AlertResponseDTO{
+		Id:             a.Id,
+		UserId:         a.UserId,
+		AppId:          a.AppId,
+		Currency:       a.Currency,
+		MarketHashName: a.MarketHashName,
+		Direction:      a.Direction,
+		Threshold:      a.Threshold,
+		Active:         a.Active,
+		Triggered:      a.Triggered,
+		CreatedAt:      a.CreatedAt,
+		UpdatedAt:      a.UpdatedAt,
+	}
+}
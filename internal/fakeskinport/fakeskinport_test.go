@@ -0,0 +1,198 @@
+package fakeskinport
+
+import (
+	"encoding/json"
+	"github.com/andybalholm/brotli"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var logger = logrus.New()
+
+const (
+	tradableFixture   = `[{"market_hash_name": "AK-47 | Redline", "min_price": 10}]`
+	untradableFixture = `[{"market_hash_name": "AK-47 | Redline", "min_price": 9}]`
+)
+
+func newTestServer(t *testing.T, options Options) (*Server, *httptest.Server) {
+	t.Helper()
+
+	if options.FixturesDir == "" {
+		options.FixturesDir = t.TempDir()
+	}
+
+	if err := SaveFixture(options.FixturesDir, "items_730_EUR_tradable.json", []byte(tradableFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveFixture(options.FixturesDir, "items_730_EUR_untradable.json", []byte(untradableFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := New(options, &http.Client{}, logger)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, server
+}
+
+func get(t *testing.T, target string, acceptEncoding string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "br" {
+		reader = brotli.NewReader(resp.Body)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, string(body)
+}
+
+func TestServesFixturesWithBrotli(t *testing.T) {
+	_, server := newTestServer(t, Options{})
+
+	resp, body := get(t, server.URL+"/items?app_id=730&currency=EUR", "br;q=1.0, gzip;q=0.8")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "br" {
+		t.Fatalf("expected brotli encoded 200, got %d %q", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+
+	if body != tradableFixture {
+		t.Fatalf("expected tradable fixture, got %s", body)
+	}
+
+	resp, body = get(t, server.URL+"/items?app_id=730&currency=eur&tradable=0", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("expected identity encoding, got %q", resp.Header.Get("Content-Encoding"))
+	}
+
+	if body != untradableFixture {
+		t.Fatalf("expected untradable fixture, got %s", body)
+	}
+
+	if resp, _ := get(t, server.URL+"/items?app_id=570&currency=EUR", "br"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for missing fixture, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := get(t, server.URL+"/items?app_id=730&currency=../../etc", "br"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid currency, got %d", resp.StatusCode)
+	}
+}
+
+func TestInjectsFailuresAndLatency(t *testing.T) {
+	fake, server := newTestServer(t, Options{
+		Latency:       50 * time.Millisecond,
+		RetryAfter:    2 * time.Second,
+		TrackRequests: true,
+	})
+
+	fake.FailNext(http.StatusTooManyRequests, 1)
+	fake.FailNext(http.StatusBadGateway, 1)
+
+	startedAt := time.Now()
+
+	resp, _ := get(t, server.URL+"/items", "br")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("expected 429 with Retry-After 2, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	if time.Since(startedAt) < 50*time.Millisecond {
+		t.Fatal("expected latency to be injected")
+	}
+
+	if resp, _ := get(t, server.URL+"/items", "br"); resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := get(t, server.URL+"/items", "br"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after injected failures, got %d", resp.StatusCode)
+	}
+
+	untracked, always := newTestServer(t, Options{ErrorRate: 1, ErrorStatus: http.StatusInternalServerError})
+	if resp, _ := get(t, always.URL+"/items", "br"); resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500 with error rate 1, got %d", resp.StatusCode)
+	}
+
+	if len(fake.Requests()) != 3 {
+		t.Fatalf("expected 3 recorded requests, got %d", len(fake.Requests()))
+	}
+
+	if len(untracked.Requests()) != 0 {
+		t.Fatalf("expected no requests kept without TrackRequests, got %d", len(untracked.Requests()))
+	}
+}
+
+func TestRecordsUpstreamResponses(t *testing.T) {
+	const recorded = `[{"market_hash_name":"M4A4 | Howl","min_price":1900}]`
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/items" || r.URL.Query().Get("app_id") != "440" || r.Header.Get("Accept-Encoding") != "br" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "br")
+		writer := brotli.NewWriter(w)
+		_, _ = writer.Write([]byte(recorded))
+		_ = writer.Close()
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	_, server := newTestServer(t, Options{FixturesDir: dir, RecordURL: upstream.URL + "/v1/"})
+
+	resp, body := get(t, server.URL+"/items?app_id=440&currency=USD", "br")
+	if resp.StatusCode != http.StatusOK || body != recorded {
+		t.Fatalf("expected recorded response, got %d %s", resp.StatusCode, body)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "items_440_USD_tradable.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []map[string]any
+	if err := json.Unmarshal(saved, &items); err != nil || len(items) != 1 || items[0]["market_hash_name"] != "M4A4 | Howl" {
+		t.Fatalf("unexpected fixture: %s", saved)
+	}
+
+	// Replaying the recorded fixture does not need the upstream anymore
+	upstream.Close()
+
+	_, replay := newTestServer(t, Options{FixturesDir: dir})
+	if resp, _ := get(t, replay.URL+"/items?app_id=440&currency=USD", "br"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected recorded fixture to be served, got %d", resp.StatusCode)
+	}
+}
+
+func TestFixtureNameRejectsUnknownPaths(t *testing.T) {
+	if _, err := FixtureName("/users", nil); err == nil {
+		t.Fatal("expected unknown path to be rejected")
+	}
+
+	if name, err := FixtureName("/sales/history", map[string][]string{"currency": {"usd"}}); err != nil || name != "sales-history_730_USD.json" {
+		t.Fatalf("unexpected fixture name %q: %v", name, err)
+	}
+}
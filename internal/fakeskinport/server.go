@@ -0,0 +1,340 @@
+package fakeskinport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	// FixturesDir holds the recorded responses, see FixtureName
+	FixturesDir string
+	// Latency is added before every response
+	Latency time.Duration
+	// RateLimitRate and ErrorRate are the probabilities, from 0 to 1, of
+	// answering with 429 and ErrorStatus instead of the fixture.
+	RateLimitRate float64
+	ErrorRate     float64
+	ErrorStatus   int
+	RetryAfter    time.Duration
+	// RecordURL switches the server to recorder mode: requests are forwarded
+	// to this base URL and the responses are saved as fixtures.
+	RecordURL string
+	// TrackRequests keeps the URLs of served requests for Requests. It is
+	// meant for tests, a long running server would keep them forever.
+	TrackRequests bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		FixturesDir: "fixtures/skinport",
+		ErrorStatus: http.StatusServiceUnavailable,
+		RetryAfter:  time.Second,
+	}
+}
+
+type Server struct {
+	options Options
+	client  *http.Client
+	logger  *logrus.Logger
+
+	mu       sync.Mutex
+	failures []int
+	requests []*url.URL
+}
+
+func New(options Options, client *http.Client, logger *logrus.Logger) *Server {
+	return &Server{
+		options: options,
+		client:  client,
+		logger:  logger,
+	}
+}
+
+// FailNext makes the next count requests fail with status, before any random
+// error injection. It is meant for deterministic tests.
+func (s *Server) FailNext(status int, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for range count {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Requests returns the URLs of all requests served so far, when
+// Options.TrackRequests is set
+func (s *Server) Requests() []*url.URL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*url.URL(nil), s.requests...)
+}
+
+// FixtureName maps a SkinPort request to its fixture file. Items without the
+// tradable param, or with tradable=1, are the tradable listings.
+func FixtureName(path string, query url.Values) (string, error) {
+	appId := query.Get("app_id")
+	if appId == "" {
+		appId = "730"
+	}
+
+	currency := strings.ToUpper(query.Get("currency"))
+	if currency == "" {
+		currency = "EUR"
+	}
+
+	if _, err := strconv.Atoi(appId); err != nil {
+		return "", fmt.Errorf("invalid app_id: %s", appId)
+	}
+
+	if len(currency) != 3 || strings.ContainsAny(currency, `./\`) {
+		return "", fmt.Errorf("invalid currency: %s", currency)
+	}
+
+	switch strings.TrimSuffix(path, "/") {
+	case "/items":
+		listing := "tradable"
+		if tradable := query.Get("tradable"); tradable == "0" || tradable == "false" {
+			listing = "untradable"
+		}
+		return fmt.Sprintf("items_%s_%s_%s.json", appId, currency, listing), nil
+	case "/sales/history":
+		return fmt.Sprintf("sales-history_%s_%s.json", appId, currency), nil
+	default:
+		return "", errNotFound
+	}
+}
+
+// SaveFixture writes body as the fixture name in dir
+func SaveFixture(dir string, name string, body []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, name), body, 0o644)
+}
+
+var errNotFound = errors.New("not found")
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.options.TrackRequests {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL)
+		s.mu.Unlock()
+	}
+
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if !s.wait(r.Context()) {
+		return
+	}
+
+	if status, ok := s.injectedFailure(); ok {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.options.RetryAfter.Seconds())))
+		}
+		s.writeError(w, status, http.StatusText(status))
+		return
+	}
+
+	name, err := FixtureName(r.URL.Path, r.URL.Query())
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			s.writeError(w, http.StatusNotFound, "not found")
+		} else {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	var body []byte
+	if s.options.RecordURL != "" {
+		body, err = s.record(r, name)
+	} else {
+		body, err = os.ReadFile(filepath.Join(s.options.FixturesDir, name))
+	}
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("fixture %s not found", name))
+			return
+		}
+
+		var statusErr *upstreamStatusError
+		if errors.As(err, &statusErr) {
+			s.writeError(w, statusErr.status, statusErr.Error())
+			return
+		}
+
+		s.logger.Errorf("Error while serving %s: %s", name, err)
+		s.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.write(w, r, http.StatusOK, body)
+}
+
+func (s *Server) wait(ctx context.Context) bool {
+	if s.options.Latency <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(s.options.Latency)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (s *Server) injectedFailure() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		return status, true
+	}
+
+	if s.options.RateLimitRate > 0 && rand.Float64() < s.options.RateLimitRate {
+		return http.StatusTooManyRequests, true
+	}
+
+	if s.options.ErrorRate > 0 && rand.Float64() < s.options.ErrorRate {
+		return s.options.ErrorStatus, true
+	}
+
+	return 0, false
+}
+
+type upstreamStatusError struct {
+	status int
+	body   string
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream responded with status %d: %s", e.status, e.body)
+}
+
+// record forwards the request upstream and saves a successful response
+func (s *Server) record(r *http.Request, name string) ([]byte, error) {
+	target := strings.TrimSuffix(s.options.RecordURL, "/") + r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// SkinPort requires brotli for the items endpoints
+	req.Header.Set("Accept-Encoding", "br")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "br") {
+		reader = brotli.NewReader(resp.Body)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamStatusError{status: resp.StatusCode, body: string(body)}
+	}
+
+	if !json.Valid(body) {
+		return nil, errors.New("upstream responded with invalid JSON")
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return nil, err
+	}
+
+	if err := SaveFixture(s.options.FixturesDir, name, indented.Bytes()); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Recorded %s", name)
+
+	return body, nil
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	body, _ := json.Marshal(map[string]any{
+		"errors": []map[string]string{{"id": strconv.Itoa(status), "message": message}},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// write encodes the body with brotli when the client accepts it, like SkinPort
+func (s *Server) write(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	if !acceptsBrotli(r.Header.Get("Accept-Encoding")) {
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "br")
+	w.WriteHeader(status)
+
+	writer := brotli.NewWriter(w)
+	_, _ = writer.Write(body)
+	_ = writer.Close()
+}
+
+func acceptsBrotli(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "br") {
+			continue
+		}
+
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+
+	return false
+}
@@ -0,0 +1,201 @@
+package item
+
+import (
+	"context"
+	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item/domain"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+var CircuitOpenError = errors.New("circuit breaker is open")
+
+type CircuitBreakerOptions struct {
+	FailureThreshold int
+	CoolDown         time.Duration
+	HalfOpenRequests int
+}
+
+// CircuitBreaker stops calling the wrapped client after FailureThreshold
+// consecutive failures. Once CoolDown has passed, up to HalfOpenRequests
+// probe calls are let through and the circuit closes if all of them succeed.
+// Items and sales history are separate upstream endpoints, so each of them
+// has its own circuit.
+type CircuitBreaker struct {
+	client       ExternalAPIClient
+	items        *circuit
+	salesHistory *circuit
+}
+
+func NewCircuitBreaker(client ExternalAPIClient, logger *logrus.Logger, options CircuitBreakerOptions) *CircuitBreaker {
+	return &CircuitBreaker{
+		client:       client,
+		items:        newCircuit("items", logger, options),
+		salesHistory: newCircuit("sales history", logger, options),
+	}
+}
+
+func (b *CircuitBreaker) GetItems(ctx context.Context, params map[string]string) ([]domain.ClientResponseItem, error) {
+	if err := b.items.allow(); err != nil {
+		return nil, err
+	}
+
+	items, err := b.client.GetItems(ctx, params)
+	b.items.record(err, ctx.Err() != nil)
+
+	return items, err
+}
+
+func (b *CircuitBreaker) GetSalesHistory(ctx context.Context, params map[string]string) ([]domain.SalesHistoryItem, error) {
+	if err := b.salesHistory.allow(); err != nil {
+		return nil, err
+	}
+
+	history, err := b.client.GetSalesHistory(ctx, params)
+	b.salesHistory.record(err, ctx.Err() != nil)
+
+	return history, err
+}
+
+// Status reports the items circuit
+func (b *CircuitBreaker) Status() CircuitBreakerStatusDto {
+	return b.items.status()
+}
+
+func (b *CircuitBreaker) SalesHistoryStatus() CircuitBreakerStatusDto {
+	return b.salesHistory.status()
+}
+
+// isUpstreamFailure reports whether err means the upstream is unhealthy: a 5xx
+// or 429 response or a transport error. Other 4xx responses are caused by the
+// request, so they do not open the circuit.
+func isUpstreamFailure(err error) bool {
+	var statusErr *UpstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+type circuit struct {
+	name    string
+	logger  *logrus.Logger
+	options CircuitBreakerOptions
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	probes    int
+	lastError error
+}
+
+func newCircuit(name string, logger *logrus.Logger, options CircuitBreakerOptions) *circuit {
+	return &circuit{
+		name:    name,
+		logger:  logger,
+		options: options,
+		state:   CircuitClosed,
+	}
+}
+
+func (b *circuit) status() CircuitBreakerStatusDto {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitBreakerStatusDto{
+		State:    b.state,
+		Failures: b.failures,
+	}
+
+	if b.state != CircuitClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+
+	if b.lastError != nil {
+		lastError := b.lastError.Error()
+		status.LastError = &lastError
+	}
+
+	return status
+}
+
+func (b *circuit) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.options.CoolDown {
+			return CircuitOpenError
+		}
+		b.setState(CircuitHalfOpen)
+		b.probes = 1
+	case CircuitHalfOpen:
+		if b.probes >= b.options.HalfOpenRequests {
+			return CircuitOpenError
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+func (b *circuit) record(err error, callerDone bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Callers giving up is not a sign of an unhealthy upstream
+	if err != nil && callerDone {
+		if b.state == CircuitHalfOpen {
+			b.probes--
+		}
+		return
+	}
+
+	// The upstream answered, even if it rejected the request
+	if err == nil || !isUpstreamFailure(err) {
+		b.failures = 0
+		if b.state == CircuitHalfOpen {
+			b.probes--
+			if b.probes == 0 {
+				b.setState(CircuitClosed)
+			}
+		}
+		return
+	}
+
+	b.failures++
+	b.lastError = err
+
+	if b.state == CircuitHalfOpen || b.failures >= b.options.FailureThreshold {
+		b.openedAt = time.Now()
+		b.probes = 0
+		b.setState(CircuitOpen)
+	}
+}
+
+func (b *circuit) setState(state string) {
+	if b.state == state {
+		return
+	}
+
+	if state == CircuitOpen {
+		b.logger.Warnf("Circuit breaker for %s changed state from %s to %s after %d failures: %s", b.name, b.state, state, b.failures, b.lastError)
+	} else {
+		b.logger.Infof("Circuit breaker for %s changed state from %s to %s", b.name, b.state, state)
+	}
+
+	b.state = state
+}
@@ -0,0 +1,233 @@
+package item
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAppId    = 730
+	DefaultCurrency = "EUR"
+)
+
+var allowedAppIds = map[int]struct{}{
+	730:    {},
+	570:    {},
+	440:    {},
+	252490: {},
+}
+
+var allowedCurrencies = map[string]struct{}{
+	"AUD": {}, "BRL": {}, "CAD": {}, "CHF": {}, "CNY": {}, "CZK": {}, "DKK": {}, "EUR": {},
+	"GBP": {}, "HRK": {}, "NOK": {}, "PLN": {}, "RUB": {}, "SEK": {}, "TRY": {}, "USD": {},
+}
+
+type CatalogKey struct {
+	AppId    int
+	Currency string
+}
+
+func (k CatalogKey) Validate() error {
+	if _, ok := allowedAppIds[k.AppId]; !ok {
+		return errors.New("invalid app_id: must be one of 730, 570, 440, 252490")
+	}
+
+	if _, ok := allowedCurrencies[k.Currency]; !ok {
+		return fmt.Errorf("invalid currency: %s is not supported", k.Currency)
+	}
+
+	return nil
+}
+
+func (k CatalogKey) cacheKey() string {
+	return fmt.Sprintf("items:%d:%s", k.AppId, k.Currency)
+}
+
+func (k CatalogKey) salesHistoryCacheKey() string {
+	return fmt.Sprintf("sales-history:%d:%s", k.AppId, k.Currency)
+}
+
+func (k CatalogKey) params() map[string]string {
+	return map[string]string{
+		"app_id":   strconv.Itoa(k.AppId),
+		"currency": k.Currency,
+	}
+}
+
+func (k CatalogKey) untradableParams() map[string]string {
+	params := k.params()
+	params["tradable"] = "0"
+	return params
+}
+
+func ParseCatalogKeys(raw string) ([]CatalogKey, error) {
+	var keys []CatalogKey
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		appIdStr, currency, found := strings.Cut(part, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid catalog %q: expected app_id:currency", part)
+		}
+
+		appId, err := strconv.Atoi(appIdStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid catalog %q: app_id must be a number", part)
+		}
+
+		key := CatalogKey{AppId: appId, Currency: strings.ToUpper(currency)}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid catalog %q: %w", part, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// catalog is an immutable merged item list indexed by market_hash_name
+type catalog struct {
+	items []GetItemsResponseDto
+	index map[string]int
+
+	// unavailable lists the providers that failed while this catalog was fetched
+	unavailable []string
+}
+
+func newCatalog(items []GetItemsResponseDto) *catalog {
+	index := make(map[string]int, len(items))
+	for i := range items {
+		index[items[i].MarketHashName] = i
+	}
+
+	return &catalog{
+		items: items,
+		index: index,
+	}
+}
+
+func (c *catalog) find(marketHashName string) (GetItemsResponseDto, bool) {
+	i, ok := c.index[marketHashName]
+	if !ok {
+		return GetItemsResponseDto{}, false
+	}
+
+	return c.items[i], true
+}
+
+type catalogState struct {
+	catalog       *catalog
+	lastRefreshAt time.Time
+	lastError     error
+	lastErrorAt   time.Time
+}
+
+// catalogStore keeps the catalogs polled by the Refresher. Catalogs are never
+// modified after being stored, so readers can use them without locking.
+type catalogStore struct {
+	mu     sync.RWMutex
+	states map[CatalogKey]*catalogState
+	maxAge time.Duration
+}
+
+// newCatalogStore keeps serving a catalog for maxAge after its last successful
+// refresh, the same bound as a cached catalog that is fresh and then stale.
+func newCatalogStore(maxAge time.Duration) *catalogStore {
+	return &catalogStore{
+		states: make(map[CatalogKey]*catalogState),
+		maxAge: maxAge,
+	}
+}
+
+// load returns false once every poll has been failing for longer than maxAge,
+// so the catalog is refreshed on demand or the error is returned.
+func (s *catalogStore) load(key CatalogKey) (*catalog, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.states[key]
+	if !ok || state.catalog == nil || time.Since(state.lastRefreshAt) > s.maxAge {
+		return nil, false
+	}
+
+	return state.catalog, true
+}
+
+func (s *catalogStore) swap(key CatalogKey, c *catalog, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(key)
+	state.catalog = c
+	state.lastRefreshAt = at
+	state.lastError = nil
+}
+
+func (s *catalogStore) fail(key CatalogKey, err error, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(key)
+	state.lastError = err
+	state.lastErrorAt = at
+}
+
+func (s *catalogStore) state(key CatalogKey) *catalogState {
+	state, ok := s.states[key]
+	if !ok {
+		state = &catalogState{}
+		s.states[key] = state
+	}
+	return state
+}
+
+func (s *catalogStore) statuses() []CatalogStatusDto {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]CatalogStatusDto, 0, len(s.states))
+	for key, state := range s.states {
+		status := CatalogStatusDto{
+			AppId:    key.AppId,
+			Currency: key.Currency,
+		}
+
+		if state.catalog != nil {
+			status.ItemsCount = len(state.catalog.items)
+			status.UnavailableProviders = state.catalog.unavailable
+		}
+
+		if !state.lastRefreshAt.IsZero() {
+			lastRefreshAt := state.lastRefreshAt
+			status.LastRefreshAt = &lastRefreshAt
+		}
+
+		if state.lastError != nil {
+			lastError := state.lastError.Error()
+			lastErrorAt := state.lastErrorAt
+			status.LastError = &lastError
+			status.LastErrorAt = &lastErrorAt
+		}
+
+		out = append(out, status)
+	}
+
+	slices.SortFunc(out, func(a, b CatalogStatusDto) int {
+		if a.AppId != b.AppId {
+			return a.AppId - b.AppId
+		}
+		return strings.Compare(a.Currency, b.Currency)
+	})
+
+	return out
+}
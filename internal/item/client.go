@@ -1,25 +1,73 @@
 package item
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/andybalholm/brotli"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/item/domain"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const acceptEncoding = "br;q=1.0, gzip;q=0.8, deflate;q=0.6, identity;q=0.1"
+
+var BodyTooLargeError = errors.New("upstream response body is too large")
+
+type UpstreamStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *UpstreamStatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+type ClientOptions struct {
+	RequestTimeout time.Duration
+	MaxRetries     int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+	MaxBodySize    int64
+	// Limiter is taken for every attempt, retries included
+	Limiter *RateLimiter
+}
+
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		RequestTimeout: 10 * time.Second,
+		MaxRetries:     3,
+		BaseBackoff:    500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		MaxBodySize:    64 << 20,
+	}
+}
+
 type SkinPortClient struct {
 	client  *http.Client
 	baseURL string
+	options ClientOptions
 }
 
-func NewSkinPortClient(client *http.Client, baseURL string) *SkinPortClient {
+func NewSkinPortClient(client *http.Client, baseURL string, options ClientOptions) *SkinPortClient {
 	return &SkinPortClient{
 		client:  client,
 		baseURL: baseURL,
+		options: options,
 	}
 }
 
@@ -29,30 +77,200 @@ func (c *SkinPortClient) GetItems(ctx context.Context, params map[string]string)
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	var items []domain.ClientResponseItem
+	if err := c.get(ctx, requestUrl, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (c *SkinPortClient) GetSalesHistory(ctx context.Context, params map[string]string) ([]domain.SalesHistoryItem, error) {
+	requestUrl, err := c.buildURL(fmt.Sprintf("%s/sales/history", c.baseURL), params)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Accept-Encoding", "br")
+	var history []domain.SalesHistoryItem
+	if err := c.get(ctx, requestUrl, &history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// get performs the request and decodes the response into out, retrying
+// network errors, 429 and 5xx responses with exponential backoff.
+func (c *SkinPortClient) get(ctx context.Context, requestUrl string, out any) error {
+	for attempt := 0; ; attempt++ {
+		retryAfter, retryable, err := c.attempt(ctx, requestUrl, out)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= c.options.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(max(c.backoff(attempt), retryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *SkinPortClient) attempt(ctx context.Context, requestUrl string, out any) (time.Duration, bool, error) {
+	if c.options.Limiter != nil {
+		if err := c.options.Limiter.Wait(ctx); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if c.options.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, true, err
 	}
 	defer resp.Body.Close()
 
-	var body io.Reader = resp.Body
-	if resp.Header.Get("Content-Encoding") == "br" {
-		body = brotli.NewReader(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		statusErr := &UpstreamStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+
+		return parseRetryAfter(resp.Header.Get("Retry-After")), statusErr.retryable(), statusErr
 	}
 
-	var items []domain.ClientResponseItem
-	if err := json.NewDecoder(body).Decode(&items); err != nil {
+	body, err := decodeBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return 0, false, err
+	}
+
+	if c.options.MaxBodySize > 0 {
+		body = &limitedReader{reader: body, remaining: c.options.MaxBodySize}
+	}
+
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		// A timeout while reading the body is as transient as one while connecting
+		return 0, ctx.Err() != nil, err
+	}
+
+	return 0, false, nil
+}
+
+// backoff returns the exponential delay for the attempt with jitter in the
+// upper half, so concurrent clients do not retry in lockstep.
+func (c *SkinPortClient) backoff(attempt int) time.Duration {
+	delay := c.options.BaseBackoff << attempt
+	if delay <= 0 || delay > c.options.MaxBackoff {
+		delay = c.options.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// decodeBody unwraps the content codings in the reverse order they were applied
+func decodeBody(body io.Reader, contentEncoding string) (io.Reader, error) {
+	codings := strings.Split(contentEncoding, ",")
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+		case "br":
+			body = brotli.NewReader(body)
+		case "gzip", "x-gzip":
+			reader, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, err
+			}
+			body = reader
+		case "deflate":
+			reader, err := newDeflateReader(body)
+			if err != nil {
+				return nil, err
+			}
+			body = reader
+		default:
+			return nil, fmt.Errorf("unsupported content encoding: %s", coding)
+		}
+	}
+
+	return body, nil
+}
+
+// newDeflateReader accepts both zlib wrapped data, as the spec requires, and
+// raw deflate streams that some servers send instead.
+func newDeflateReader(body io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(body)
+
+	header, err := buffered.Peek(2)
+	if err != nil {
 		return nil, err
 	}
 
-	return items, nil
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+
+	return flate.NewReader(buffered), nil
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+
+	return 0
+}
+
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		var probe [1]byte
+		if n, err := r.reader.Read(probe[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, BodyTooLargeError
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	return n, err
 }
 
 func (c *SkinPortClient) buildURL(baseURL string, params map[string]string) (string, error) {
@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type ClientResponseItem struct {
 	MarketHashName string  `json:"market_hash_name"`
 	Version        *string `json:"version"`
@@ -15,3 +17,48 @@ type ClientResponseItem struct {
 	CreatedAt      int64   `json:"created_at"`
 	UpdatedAt      int64   `json:"updated_at"`
 }
+
+type SalesAggregate struct {
+	Min    *float64 `json:"min"`
+	Max    *float64 `json:"max"`
+	Avg    *float64 `json:"avg"`
+	Median *float64 `json:"median"`
+	Volume int      `json:"volume"`
+}
+
+type SalesHistoryItem struct {
+	MarketHashName string         `json:"market_hash_name"`
+	Version        *string        `json:"version"`
+	Currency       string         `json:"currency"`
+	ItemPage       string         `json:"item_page"`
+	MarketPage     string         `json:"market_page"`
+	Last24Hours    SalesAggregate `json:"last_24_hours"`
+	Last7Days      SalesAggregate `json:"last_7_days"`
+	Last30Days     SalesAggregate `json:"last_30_days"`
+	Last90Days     SalesAggregate `json:"last_90_days"`
+}
+
+type ItemPrice struct {
+	MarketHashName     string
+	Version            *string
+	ItemPage           string
+	MarketPage         string
+	SuggestedPrice     float64
+	TradableMinPrice   *float64
+	UntradableMinPrice *float64
+	MaxPrice           float64
+	MeanPrice          float64
+	MedianPrice        float64
+	Quantity           int
+}
+
+type PricePoint struct {
+	Time               time.Time
+	SuggestedPrice     float64
+	TradableMinPrice   *float64
+	UntradableMinPrice *float64
+	MaxPrice           float64
+	MeanPrice          float64
+	MedianPrice        float64
+	Quantity           int
+}
@@ -1,5 +1,7 @@
 package item
 
+import "time"
+
 type GetItemsResponseDto struct {
 	MarketHashName     string   `json:"market_hash_name"`
 	Version            *string  `json:"version"`
@@ -15,4 +17,198 @@ type GetItemsResponseDto struct {
 	Quantity           int      `json:"quantity"`
 	CreatedAt          int64    `json:"created_at"`
 	UpdatedAt          int64    `json:"updated_at"`
+
+	Providers map[string]ProviderPriceDto `json:"providers"`
+	BestPrice *BestPriceDto               `json:"best_price"`
+}
+
+type ProviderPriceDto struct {
+	SuggestedPrice     float64  `json:"suggested_price"`
+	TradableMinPrice   *float64 `json:"tradable_min_price"`
+	UntradableMinPrice *float64 `json:"untradable_min_price"`
+	Quantity           int      `json:"quantity"`
+	MarketPage         string   `json:"market_page"`
+}
+
+type BestPriceDto struct {
+	Provider string  `json:"provider"`
+	Price    float64 `json:"price"`
+	Tradable bool    `json:"tradable"`
+}
+
+type GetItemsQueryDto struct {
+	AppId              int
+	Currency           string
+	Search             string
+	Prefix             string
+	MinTradablePrice   *float64
+	MaxTradablePrice   *float64
+	MinUntradablePrice *float64
+	MaxUntradablePrice *float64
+	MinSuggestedPrice  *float64
+	MaxSuggestedPrice  *float64
+	MinQuantity        *int
+	Sort               string
+	Order              string
+	Limit              int
+	Offset             int
+}
+
+type GetItemsListResponseDto struct {
+	Items  []GetItemsResponseDto `json:"items"`
+	Total  int                   `json:"total"`
+	Limit  int                   `json:"limit"`
+	Offset int                   `json:"offset"`
+
+	UnavailableProviders []string `json:"unavailable_providers,omitempty"`
+}
+
+type GetItemsBatchRequestBody struct {
+	MarketHashNames []string `json:"market_hash_names"`
+}
+
+type GetItemsBatchResponseDto struct {
+	Items    []GetItemsResponseDto `json:"items"`
+	NotFound []string              `json:"not_found"`
+}
+
+type GetItemsSpreadQueryDto struct {
+	AppId            int
+	Currency         string
+	Basis            string
+	Sort             string
+	MinQuantity      *int
+	MinSpread        *float64
+	MinSpreadPercent *float64
+	Limit            int
+	Offset           int
+}
+
+type ItemSpreadDto struct {
+	MarketHashName          string   `json:"market_hash_name"`
+	Quantity                int      `json:"quantity"`
+	SuggestedPrice          float64  `json:"suggested_price"`
+	TradableMinPrice        *float64 `json:"tradable_min_price"`
+	UntradableMinPrice      *float64 `json:"untradable_min_price"`
+	UntradableSpread        *float64 `json:"untradable_spread"`
+	UntradableSpreadPercent *float64 `json:"untradable_spread_percent"`
+	SuggestedSpread         *float64 `json:"suggested_spread"`
+	SuggestedSpreadPercent  *float64 `json:"suggested_spread_percent"`
+}
+
+type GetItemsSpreadResponseDto struct {
+	Items  []ItemSpreadDto `json:"items"`
+	Basis  string          `json:"basis"`
+	Sort   string          `json:"sort"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+type PriceHistoryQueryDto struct {
+	AppId          int
+	Currency       string
+	MarketHashName string
+	Resolution     string
+	From           time.Time
+	To             time.Time
+}
+
+type PricePointDto struct {
+	Time               time.Time `json:"time"`
+	SuggestedPrice     float64   `json:"suggested_price"`
+	TradableMinPrice   *float64  `json:"tradable_min_price"`
+	UntradableMinPrice *float64  `json:"untradable_min_price"`
+	MaxPrice           float64   `json:"max_price"`
+	MeanPrice          float64   `json:"mean_price"`
+	MedianPrice        float64   `json:"median_price"`
+	Quantity           int       `json:"quantity"`
+}
+
+type PriceHistoryResponseDto struct {
+	MarketHashName string          `json:"market_hash_name"`
+	Currency       string          `json:"currency"`
+	Resolution     string          `json:"resolution"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	Points         []PricePointDto `json:"points"`
+}
+
+type CatalogStatusDto struct {
+	AppId         int        `json:"app_id"`
+	Currency      string     `json:"currency"`
+	ItemsCount    int        `json:"items_count"`
+	LastRefreshAt *time.Time `json:"last_refresh_at"`
+	LastError     *string    `json:"last_error"`
+	LastErrorAt   *time.Time `json:"last_error_at"`
+
+	UnavailableProviders []string `json:"unavailable_providers,omitempty"`
+}
+
+type CircuitBreakerStatusDto struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"consecutive_failures"`
+	OpenedAt  *time.Time `json:"opened_at"`
+	LastError *string    `json:"last_error"`
+}
+
+type ProviderStatusDto struct {
+	Name                 string                   `json:"name"`
+	Upstream             *CircuitBreakerStatusDto `json:"upstream"`
+	SalesHistoryUpstream *CircuitBreakerStatusDto `json:"sales_history_upstream"`
+}
+
+type ItemsStatusResponseDto struct {
+	Catalogs  []CatalogStatusDto       `json:"catalogs"`
+	Upstream  *CircuitBreakerStatusDto `json:"upstream"`
+	Providers []ProviderStatusDto      `json:"providers"`
+}
+
+type SalesHistoryQueryDto struct {
+	AppId           int
+	Currency        string
+	MarketHashNames []string
+}
+
+type SalesAggregateDto struct {
+	Min    *float64 `json:"min"`
+	Max    *float64 `json:"max"`
+	Avg    *float64 `json:"avg"`
+	Median *float64 `json:"median"`
+	Volume int      `json:"volume"`
+}
+
+type SalesHistoryResponseDto struct {
+	MarketHashName string            `json:"market_hash_name"`
+	Version        *string           `json:"version"`
+	Currency       string            `json:"currency"`
+	ItemPage       string            `json:"item_page"`
+	MarketPage     string            `json:"market_page"`
+	Last24Hours    SalesAggregateDto `json:"last_24_hours"`
+	Last7Days      SalesAggregateDto `json:"last_7_days"`
+	Last30Days     SalesAggregateDto `json:"last_30_days"`
+	Last90Days     SalesAggregateDto `json:"last_90_days"`
+}
+
+type ItemPriceStateDto struct {
+	SuggestedPrice     float64  `json:"suggested_price"`
+	TradableMinPrice   *float64 `json:"tradable_min_price"`
+	UntradableMinPrice *float64 `json:"untradable_min_price"`
+	Quantity           int      `json:"quantity"`
+}
+
+type ItemChangeDto struct {
+	MarketHashName string            `json:"market_hash_name"`
+	Before         ItemPriceStateDto `json:"before"`
+	After          ItemPriceStateDto `json:"after"`
+}
+
+type CatalogChangeEventDto struct {
+	Id          int64                 `json:"id"`
+	AppId       int                   `json:"app_id"`
+	Currency    string                `json:"currency"`
+	Added       []GetItemsResponseDto `json:"added"`
+	Removed     []string              `json:"removed"`
+	Changed     []ItemChangeDto       `json:"changed"`
+	RefreshedAt time.Time             `json:"refreshed_at"`
 }
@@ -0,0 +1,174 @@
+package item
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	changeFeedSize = 256
+	// changeFeedMaxItems bounds the added, removed and changed items kept in
+	// the log, a refresh of a large catalog can change most of its items
+	changeFeedMaxItems = 20000
+)
+
+// changeFeed keeps the last catalog of every key and a bounded log of the
+// diffs between successive refreshes, so stream clients can resume.
+type changeFeed struct {
+	mu     sync.Mutex
+	last   map[CatalogKey]*catalog
+	events []CatalogChangeEventDto
+	items  int
+	lastId int64
+	notify chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{
+		last:   make(map[CatalogKey]*catalog),
+		notify: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// publish records the diff against the previous catalog of the key. The first
+// catalog of a key is only remembered as the baseline.
+func (f *changeFeed) publish(key CatalogKey, c *catalog, refreshedAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prev, ok := f.last[key]
+	f.last[key] = c
+
+	if !ok || f.closed {
+		return
+	}
+
+	event := diffCatalogs(prev, c)
+	if len(event.Added) == 0 && len(event.Removed) == 0 && len(event.Changed) == 0 {
+		return
+	}
+
+	f.lastId++
+	event.Id = f.lastId
+	event.AppId = key.AppId
+	event.Currency = key.Currency
+	event.RefreshedAt = refreshedAt.UTC()
+
+	f.events = append(f.events, event)
+	f.items += changeEventItems(event)
+
+	// Drop the oldest events until the log fits both limits. The newest event
+	// is always kept, however large it is.
+	drop := 0
+	for len(f.events)-drop > 1 && (len(f.events)-drop > changeFeedSize || f.items > changeFeedMaxItems) {
+		f.items -= changeEventItems(f.events[drop])
+		drop++
+	}
+	f.events = slices.Delete(f.events, 0, drop)
+
+	// Wake up every waiting subscriber at once
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// since returns the events after lastId and a channel closed on the next
+// publish. ok is false when lastId is no longer in the log, so the client
+// missed events and has to reload the catalog.
+func (f *changeFeed) since(lastId int64) ([]CatalogChangeEventDto, <-chan struct{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if lastId > f.lastId {
+		return nil, f.notify, false
+	}
+
+	if lastId == f.lastId {
+		return nil, f.notify, true
+	}
+
+	if len(f.events) == 0 || lastId < f.events[0].Id-1 {
+		return nil, f.notify, false
+	}
+
+	start := int(lastId - (f.events[0].Id - 1))
+
+	return append([]CatalogChangeEventDto(nil), f.events[start:]...), f.notify, true
+}
+
+func (f *changeFeed) latestId() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.lastId
+}
+
+func (f *changeFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.closed {
+		f.closed = true
+		close(f.done)
+	}
+}
+
+func changeEventItems(event CatalogChangeEventDto) int {
+	return len(event.Added) + len(event.Removed) + len(event.Changed)
+}
+
+func diffCatalogs(prev *catalog, next *catalog) CatalogChangeEventDto {
+	var event CatalogChangeEventDto
+
+	for _, item := range next.items {
+		old, ok := prev.find(item.MarketHashName)
+		if !ok {
+			event.Added = append(event.Added, item)
+			continue
+		}
+
+		before, after := priceState(&old), priceState(&item)
+		if !samePriceState(before, after) {
+			event.Changed = append(event.Changed, ItemChangeDto{
+				MarketHashName: item.MarketHashName,
+				Before:         before,
+				After:          after,
+			})
+		}
+	}
+
+	for _, item := range prev.items {
+		if _, ok := next.find(item.MarketHashName); !ok {
+			event.Removed = append(event.Removed, item.MarketHashName)
+		}
+	}
+
+	return event
+}
+
+func priceState(item *GetItemsResponseDto) ItemPriceStateDto {
+	return ItemPriceStateDto{
+		SuggestedPrice:     item.SuggestedPrice,
+		TradableMinPrice:   item.TradableMinPrice,
+		UntradableMinPrice: item.UntradableMinPrice,
+		Quantity:           item.Quantity,
+	}
+}
+
+func samePriceState(a ItemPriceStateDto, b ItemPriceStateDto) bool {
+	return a.SuggestedPrice == b.SuggestedPrice &&
+		a.Quantity == b.Quantity &&
+		samePrice(a.TradableMinPrice, b.TradableMinPrice) &&
+		samePrice(a.UntradableMinPrice, b.UntradableMinPrice)
+}
+
+func samePrice(a *float64, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
@@ -2,18 +2,32 @@ package item
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/render"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamRetryInterval     = 5 * time.Second
+)
+
 type Handler struct {
-	service *Service
+	service   *Service
+	heartbeat time.Duration
 }
 
 func NewHandler(service *Service) *Handler {
 	return &Handler{
-		service: service,
+		service:   service,
+		heartbeat: streamHeartbeatInterval,
 	}
 }
 
@@ -21,10 +35,462 @@ func (h *Handler) GetItems(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	items, err := h.service.GetItems(ctx)
+	query, err := h.parseGetItemsQuery(r.URL.Query())
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, e := h.service.GetItems(ctx, query)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, items, http.StatusOK)
+}
+
+func (h *Handler) GetItemsSpread(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	query, err := h.parseSpreadQuery(r.URL.Query())
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, e := h.service.GetItemsSpread(ctx, query)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, items, http.StatusOK)
+}
+
+func (h *Handler) GetItem(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	marketHashName := r.PathValue("market_hash_name")
+	if marketHashName == "" {
+		render.JSON(w, "invalid market_hash_name", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.parseCatalogKey(r.URL.Query())
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, e := h.service.GetItem(ctx, key, marketHashName)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, item, http.StatusOK)
+}
+
+func (h *Handler) GetItemsBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	key, err := h.parseCatalogKey(r.URL.Query())
 	if err != nil {
-		render.JSON(w, err.Message, err.Code)
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body GetItemsBatchRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(body.MarketHashNames) == 0 || len(body.MarketHashNames) > MaxBatchSize {
+		render.JSON(w, fmt.Sprintf("invalid market_hash_names: must contain from 1 to %d names", MaxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	items, e := h.service.GetItemsBatch(ctx, key, body.MarketHashNames)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
 	}
 
 	render.JSON(w, items, http.StatusOK)
 }
+
+func (h *Handler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	marketHashName := r.PathValue("market_hash_name")
+	if marketHashName == "" {
+		render.JSON(w, "invalid market_hash_name", http.StatusBadRequest)
+		return
+	}
+
+	query, err := h.parsePriceHistoryQuery(r.URL.Query())
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.MarketHashName = marketHashName
+
+	history, e := h.service.GetPriceHistory(ctx, query)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, history, http.StatusOK)
+}
+
+func (h *Handler) GetSalesHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	values := r.URL.Query()
+
+	key, err := h.parseCatalogKey(values)
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := SalesHistoryQueryDto{
+		AppId:    key.AppId,
+		Currency: key.Currency,
+	}
+
+	for _, name := range values["market_hash_name"] {
+		if name = strings.TrimSpace(name); name != "" {
+			query.MarketHashNames = append(query.MarketHashNames, name)
+		}
+	}
+
+	history, e := h.service.GetSalesHistory(ctx, query)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, history, http.StatusOK)
+}
+
+func (h *Handler) GetStatus(w http.ResponseWriter, _ *http.Request) {
+	render.JSON(w, h.service.GetStatus(), http.StatusOK)
+}
+
+// StreamChanges pushes catalog diffs as Server-Sent Events. A client that
+// reconnects with Last-Event-ID gets the changes it missed, or a reset event
+// when they are no longer kept and the catalog has to be reloaded.
+func (h *Handler) StreamChanges(w http.ResponseWriter, r *http.Request) {
+	key, err := h.parseCatalogKey(r.URL.Query())
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastId := h.service.LatestChangeId()
+	if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+		lastId, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || lastId < 0 {
+			render.JSON(w, "invalid Last-Event-ID: must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetryInterval.Milliseconds()); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, notify, ok := h.service.ChangesSince(lastId)
+		if !ok {
+			lastId = h.service.LatestChangeId()
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", lastId); err != nil {
+				return
+			}
+			continue
+		}
+
+		for _, event := range events {
+			lastId = event.Id
+
+			if event.AppId != key.AppId || event.Currency != key.Currency {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", event.Id, data); err != nil {
+				return
+			}
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.service.StreamsDone():
+			return
+		case <-notify:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Handler) parseCatalogKey(values url.Values) (CatalogKey, error) {
+	key := CatalogKey{
+		AppId:    DefaultAppId,
+		Currency: DefaultCurrency,
+	}
+
+	if raw := values.Get("app_id"); raw != "" {
+		appId, err := strconv.Atoi(raw)
+		if err != nil {
+			return CatalogKey{}, errors.New("invalid app_id: must be one of 730, 570, 440, 252490")
+		}
+		key.AppId = appId
+	}
+
+	if raw := values.Get("currency"); raw != "" {
+		key.Currency = strings.ToUpper(raw)
+	}
+
+	return key, key.Validate()
+}
+
+func (h *Handler) parsePriceHistoryQuery(values url.Values) (PriceHistoryQueryDto, error) {
+	key, err := h.parseCatalogKey(values)
+	if err != nil {
+		return PriceHistoryQueryDto{}, err
+	}
+
+	query := PriceHistoryQueryDto{
+		AppId:      key.AppId,
+		Currency:   key.Currency,
+		Resolution: ResolutionHour,
+		To:         time.Now().UTC(),
+	}
+
+	if raw := values.Get("resolution"); raw != "" {
+		if raw != ResolutionRaw && raw != ResolutionHour && raw != ResolutionDay {
+			return PriceHistoryQueryDto{}, errors.New("invalid resolution: must be one of raw, hour, day")
+		}
+		query.Resolution = raw
+	}
+
+	if raw := values.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return PriceHistoryQueryDto{}, errors.New("invalid to: must be a RFC 3339 date")
+		}
+		query.To = to.UTC()
+	}
+
+	query.From = query.To.Add(-DefaultHistoryPeriod)
+	if raw := values.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return PriceHistoryQueryDto{}, errors.New("invalid from: must be a RFC 3339 date")
+		}
+		query.From = from.UTC()
+	}
+
+	if !query.From.Before(query.To) {
+		return PriceHistoryQueryDto{}, errors.New("invalid period: from must be before to")
+	}
+
+	if query.To.Sub(query.From) > MaxHistoryPeriod {
+		return PriceHistoryQueryDto{}, errors.New("invalid period: must not be longer than 366 days")
+	}
+
+	return query, nil
+}
+
+func (h *Handler) parseGetItemsQuery(values url.Values) (GetItemsQueryDto, error) {
+	key, err := h.parseCatalogKey(values)
+	if err != nil {
+		return GetItemsQueryDto{}, err
+	}
+
+	query := GetItemsQueryDto{
+		AppId:    key.AppId,
+		Currency: key.Currency,
+		Search:   values.Get("search"),
+		Prefix:   values.Get("prefix"),
+		Sort:     SortByName,
+		Order:    OrderAsc,
+		Limit:    DefaultLimit,
+	}
+
+	prices := []struct {
+		name  string
+		value **float64
+	}{
+		{"min_tradable_price", &query.MinTradablePrice},
+		{"max_tradable_price", &query.MaxTradablePrice},
+		{"min_untradable_price", &query.MinUntradablePrice},
+		{"max_untradable_price", &query.MaxUntradablePrice},
+		{"min_suggested_price", &query.MinSuggestedPrice},
+		{"max_suggested_price", &query.MaxSuggestedPrice},
+	}
+
+	for _, p := range prices {
+		raw := values.Get(p.name)
+		if raw == "" {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(price) || math.IsInf(price, 0) || price < 0 {
+			return GetItemsQueryDto{}, fmt.Errorf("invalid %s: must be a non-negative number", p.name)
+		}
+		*p.value = &price
+	}
+
+	if raw := values.Get("min_quantity"); raw != "" {
+		quantity, err := strconv.Atoi(raw)
+		if err != nil || quantity < 0 {
+			return GetItemsQueryDto{}, errors.New("invalid min_quantity: must be a non-negative integer")
+		}
+		query.MinQuantity = &quantity
+	}
+
+	if raw := values.Get("sort"); raw != "" {
+		switch raw {
+		case SortByName, SortByPrice, SortByQuantity, SortByUpdatedAt:
+			query.Sort = raw
+		default:
+			return GetItemsQueryDto{}, errors.New("invalid sort: must be one of name, price, quantity, updated_at")
+		}
+	}
+
+	if raw := values.Get("order"); raw != "" {
+		if raw != OrderAsc && raw != OrderDesc {
+			return GetItemsQueryDto{}, errors.New("invalid order: must be asc or desc")
+		}
+		query.Order = raw
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > MaxLimit {
+			return GetItemsQueryDto{}, fmt.Errorf("invalid limit: must be between 1 and %d", MaxLimit)
+		}
+		query.Limit = limit
+	}
+
+	if raw := values.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return GetItemsQueryDto{}, errors.New("invalid offset: must be a non-negative integer")
+		}
+		query.Offset = offset
+	}
+
+	return query, nil
+}
+
+func (h *Handler) parseSpreadQuery(values url.Values) (GetItemsSpreadQueryDto, error) {
+	key, err := h.parseCatalogKey(values)
+	if err != nil {
+		return GetItemsSpreadQueryDto{}, err
+	}
+
+	query := GetItemsSpreadQueryDto{
+		AppId:    key.AppId,
+		Currency: key.Currency,
+		Basis:    SpreadBasisUntradable,
+		Sort:     SpreadSortPercent,
+		Limit:    DefaultLimit,
+	}
+
+	if raw := values.Get("basis"); raw != "" {
+		if raw != SpreadBasisUntradable && raw != SpreadBasisSuggested {
+			return GetItemsSpreadQueryDto{}, errors.New("invalid basis: must be untradable or suggested")
+		}
+		query.Basis = raw
+	}
+
+	if raw := values.Get("sort"); raw != "" {
+		if raw != SpreadSortAbsolute && raw != SpreadSortPercent {
+			return GetItemsSpreadQueryDto{}, errors.New("invalid sort: must be absolute or percent")
+		}
+		query.Sort = raw
+	}
+
+	if raw := values.Get("min_quantity"); raw != "" {
+		quantity, err := strconv.Atoi(raw)
+		if err != nil || quantity < 0 {
+			return GetItemsSpreadQueryDto{}, errors.New("invalid min_quantity: must be a non-negative integer")
+		}
+		query.MinQuantity = &quantity
+	}
+
+	// The bounds apply to the magnitude of the spread
+	bounds := []struct {
+		name  string
+		value **float64
+	}{
+		{"min_spread", &query.MinSpread},
+		{"min_spread_percent", &query.MinSpreadPercent},
+	}
+
+	for _, b := range bounds {
+		raw := values.Get(b.name)
+		if raw == "" {
+			continue
+		}
+
+		bound, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(bound) || math.IsInf(bound, 0) || bound < 0 {
+			return GetItemsSpreadQueryDto{}, fmt.Errorf("invalid %s: must be a non-negative number", b.name)
+		}
+		*b.value = &bound
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > MaxLimit {
+			return GetItemsSpreadQueryDto{}, fmt.Errorf("invalid limit: must be between 1 and %d", MaxLimit)
+		}
+		query.Limit = limit
+	}
+
+	if raw := values.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return GetItemsSpreadQueryDto{}, errors.New("invalid offset: must be a non-negative integer")
+		}
+		query.Offset = offset
+	}
+
+	return query, nil
+}
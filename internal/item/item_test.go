@@ -1,15 +1,33 @@
 package item
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/fakeskinport"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/item/domain"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/cache"
 	"github.com/jaswdr/faker/v2"
 	"github.com/sirupsen/logrus"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func getFakeItems() []domain.ClientResponseItem {
@@ -39,14 +57,139 @@ func getFakeItems() []domain.ClientResponseItem {
 }
 
 type externalClientMock struct {
-	err error
+	err          error
+	tradable     []domain.ClientResponseItem
+	untradable   []domain.ClientResponseItem
+	salesHistory []domain.SalesHistoryItem
+	mu           sync.Mutex
+	params       []map[string]string
 }
 
 func (c *externalClientMock) GetItems(_ context.Context, params map[string]string) ([]domain.ClientResponseItem, error) {
+	c.mu.Lock()
+	c.params = append(c.params, params)
+	c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	if c.tradable == nil && c.untradable == nil {
+		return getFakeItems(), nil
+	}
+
+	if params["tradable"] == "0" {
+		return c.untradable, nil
+	}
+	return c.tradable, nil
+}
+
+func (c *externalClientMock) GetSalesHistory(_ context.Context, params map[string]string) ([]domain.SalesHistoryItem, error) {
+	c.mu.Lock()
+	c.params = append(c.params, params)
+	c.mu.Unlock()
+
 	if c.err != nil {
 		return nil, c.err
 	}
-	return getFakeItems(), nil
+	return c.salesHistory, nil
+}
+
+func getCatalogMock() *externalClientMock {
+	return &externalClientMock{
+		tradable: []domain.ClientResponseItem{
+			{MarketHashName: "AK-47 | Redline", SuggestedPrice: 12, MinPrice: 10, Quantity: 40, UpdatedAt: 3},
+			{MarketHashName: "AWP | Asiimov", SuggestedPrice: 90, MinPrice: 80, Quantity: 5, UpdatedAt: 1},
+			{MarketHashName: "AK-47 | Vulcan", SuggestedPrice: 70, MinPrice: 65, Quantity: 12, UpdatedAt: 2},
+		},
+		untradable: []domain.ClientResponseItem{
+			{MarketHashName: "AK-47 | Redline", SuggestedPrice: 12, MinPrice: 9, Quantity: 40, UpdatedAt: 3},
+			{MarketHashName: "M4A4 | Howl", SuggestedPrice: 2000, MinPrice: 1900, Quantity: 1, UpdatedAt: 4},
+		},
+	}
+}
+
+type repositoryMock struct {
+	mu        sync.Mutex
+	snapshots [][]domain.ItemPrice
+	history   []domain.PricePoint
+	err       error
+	block     bool
+	saved     chan error
+}
+
+func (r *repositoryMock) SaveSnapshot(ctx context.Context, _ int, _ string, prices []domain.ItemPrice, _ time.Time) error {
+	err := r.saveSnapshot(ctx, prices)
+	if r.saved != nil {
+		r.saved <- err
+	}
+
+	return err
+}
+
+func (r *repositoryMock) saveSnapshot(ctx context.Context, prices []domain.ItemPrice) error {
+	if r.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.snapshots = append(r.snapshots, prices)
+	return nil
+}
+
+func (r *repositoryMock) GetPriceHistory(
+	_ context.Context,
+	_ int,
+	_ string,
+	_ string,
+	_ string,
+	_ time.Time,
+	_ time.Time,
+) ([]domain.PricePoint, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.history, nil
+}
+
+func newTestService(client ExternalAPIClient, c *cache.Cache) *Service {
+	return newTestServiceWithRepository(client, &repositoryMock{}, c)
+}
+
+func newTestServiceWithRepository(client ExternalAPIClient, repository RepositoryInterface, c *cache.Cache) *Service {
+	providers := NewProviderRegistry()
+	_ = providers.Register(DefaultProviderName, client)
+
+	return NewService(providers, repository, logger, c, CacheOptions{
+		ItemsTTL:        5 * time.Minute,
+		ItemsStaleTTL:   time.Hour,
+		SalesHistoryTTL: 10 * time.Minute,
+	})
+}
+
+func getItemsList(t *testing.T, handler *Handler, target string) (GetItemsListResponseDto, int) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+
+	handler.GetItems(rec, req)
+
+	var response GetItemsListResponseDto
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return response, rec.Code
 }
 
 var (
@@ -55,11 +198,7 @@ var (
 )
 
 func TestGetItemsHandlerOK(t *testing.T) {
-	svc := &Service{
-		client: &externalClientMock{},
-		logger: logger,
-		cache:  c,
-	}
+	svc := newTestService(&externalClientMock{}, c)
 
 	handler := NewHandler(svc)
 
@@ -74,11 +213,7 @@ func TestGetItemsHandlerOK(t *testing.T) {
 }
 
 func TestGetItemsHandlerWithError(t *testing.T) {
-	svc := &Service{
-		client: &externalClientMock{err: errors.New("some error from client")},
-		logger: logger,
-		cache:  cache.New(),
-	}
+	svc := newTestService(&externalClientMock{err: errors.New("some error from client")}, cache.New())
 
 	handler := NewHandler(svc)
 	rec := httptest.NewRecorder()
@@ -92,11 +227,7 @@ func TestGetItemsHandlerWithError(t *testing.T) {
 }
 
 func TestGetItemsFromCacheOK(t *testing.T) {
-	svc := &Service{
-		client: &externalClientMock{},
-		logger: logger,
-		cache:  c,
-	}
+	svc := newTestService(&externalClientMock{}, c)
 
 	handler := NewHandler(svc)
 	rec := httptest.NewRecorder()
@@ -108,10 +239,1857 @@ func TestGetItemsFromCacheOK(t *testing.T) {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
 
-	_, exists := c.Get("items")
+	_, exists := c.Get("items:730:EUR")
 	if !exists {
 		t.Fatalf("items not found in cache")
 	}
 }
 
-//TODO: Add tests for the service logic (merging two lists, caching time)
+func TestGetItemsFilterAndSort(t *testing.T) {
+	svc := newTestService(getCatalogMock(), cache.New())
+
+	handler := NewHandler(svc)
+
+	response, code := getItemsList(t, handler, "/api/v1/items/list?prefix=ak-47&sort=price&order=desc")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if response.Total != 2 {
+		t.Fatalf("expected 2 items, got %d", response.Total)
+	}
+
+	if response.Items[0].MarketHashName != "AK-47 | Vulcan" || response.Items[1].MarketHashName != "AK-47 | Redline" {
+		t.Fatalf("unexpected order: %s, %s", response.Items[0].MarketHashName, response.Items[1].MarketHashName)
+	}
+
+	response, _ = getItemsList(t, handler, "/api/v1/items/list?search=redline&max_untradable_price=9")
+	if response.Total != 1 || *response.Items[0].UntradableMinPrice != 9 {
+		t.Fatalf("expected merged Redline item, got %+v", response.Items)
+	}
+
+	response, _ = getItemsList(t, handler, "/api/v1/items/list?min_tradable_price=1")
+	if response.Total != 3 {
+		t.Fatalf("expected items without tradable price to be filtered out, got %d", response.Total)
+	}
+
+	response, _ = getItemsList(t, handler, "/api/v1/items/list?min_quantity=10&min_suggested_price=50")
+	if response.Total != 1 || response.Items[0].MarketHashName != "AK-47 | Vulcan" {
+		t.Fatalf("expected only Vulcan, got %+v", response.Items)
+	}
+}
+
+func TestGetItemsPagination(t *testing.T) {
+	svc := newTestService(getCatalogMock(), cache.New())
+
+	handler := NewHandler(svc)
+
+	response, code := getItemsList(t, handler, "/api/v1/items/list?sort=updated_at&limit=2&offset=1")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if response.Total != 4 || response.Limit != 2 || response.Offset != 1 {
+		t.Fatalf("unexpected pagination metadata: %+v", response)
+	}
+
+	if len(response.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(response.Items))
+	}
+
+	if response.Items[0].UpdatedAt != 2 || response.Items[1].UpdatedAt != 3 {
+		t.Fatalf("unexpected page: %+v", response.Items)
+	}
+
+	response, _ = getItemsList(t, handler, "/api/v1/items/list?offset=10")
+	if response.Total != 4 || len(response.Items) != 0 {
+		t.Fatalf("expected empty page with total 4, got %+v", response)
+	}
+}
+
+func TestGetItemsWithInvalidQuery(t *testing.T) {
+	svc := newTestService(getCatalogMock(), cache.New())
+
+	handler := NewHandler(svc)
+
+	for _, target := range []string{
+		"/api/v1/items/list?sort=rarity",
+		"/api/v1/items/list?order=up",
+		"/api/v1/items/list?limit=0",
+		"/api/v1/items/list?limit=5000",
+		"/api/v1/items/list?offset=-1",
+		"/api/v1/items/list?min_tradable_price=abc",
+		"/api/v1/items/list?min_tradable_price=NaN",
+		"/api/v1/items/list?max_suggested_price=Inf",
+		"/api/v1/items/list?max_untradable_price=-Infinity",
+		"/api/v1/items/list?min_quantity=-3",
+		"/api/v1/items/list?app_id=1",
+		"/api/v1/items/list?currency=XYZ",
+	} {
+		if _, code := getItemsList(t, handler, target); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, code)
+		}
+	}
+}
+
+func TestGetItemsPassesAppIdAndCurrency(t *testing.T) {
+	client := getCatalogMock()
+	ch := cache.New()
+	svc := newTestService(client, ch)
+
+	handler := NewHandler(svc)
+
+	if _, code := getItemsList(t, handler, "/api/v1/items/list?app_id=570&currency=usd"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(client.params) != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", len(client.params))
+	}
+
+	for _, params := range client.params {
+		if params["app_id"] != "570" || params["currency"] != "USD" {
+			t.Fatalf("unexpected upstream params: %v", params)
+		}
+	}
+
+	if _, exists := ch.Get("items:570:USD"); !exists {
+		t.Fatalf("items not found in cache for app_id 570 and currency USD")
+	}
+
+	getItemsList(t, handler, "/api/v1/items/list?app_id=570&currency=USD")
+	if len(client.params) != 2 {
+		t.Fatalf("expected cached response, got %d upstream calls", len(client.params))
+	}
+
+	getItemsList(t, handler, "/api/v1/items/list?app_id=570&currency=EUR")
+	if len(client.params) != 4 {
+		t.Fatalf("expected separate cache entry per currency, got %d upstream calls", len(client.params))
+	}
+}
+
+type slowClientMock struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (c *slowClientMock) GetItems(_ context.Context, _ map[string]string) ([]domain.ClientResponseItem, error) {
+	c.calls.Add(1)
+	<-c.release
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return getCatalogMock().tradable, nil
+}
+
+func (c *slowClientMock) GetSalesHistory(_ context.Context, _ map[string]string) ([]domain.SalesHistoryItem, error) {
+	return nil, nil
+}
+
+func TestGetItemsCoalescesConcurrentRefreshes(t *testing.T) {
+	client := &slowClientMock{release: make(chan struct{})}
+	handler := NewHandler(newTestService(client, cache.New()))
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, code := getItemsList(t, handler, "/api/v1/items/list")
+			codes <- code
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+	}
+
+	if calls := client.calls.Load(); calls != 2 {
+		t.Fatalf("expected 2 upstream calls for a single refresh, got %d", calls)
+	}
+}
+
+func TestGetItemsServesStaleOnError(t *testing.T) {
+	client := &slowClientMock{release: make(chan struct{}), err: errors.New("upstream is down")}
+	close(client.release)
+
+	ch := cache.New()
+	stale := newCatalog([]GetItemsResponseDto{{MarketHashName: "AK-47 | Redline"}})
+	ch.SetWithStale("items:730:EUR", stale, -time.Second, time.Hour)
+
+	handler := NewHandler(newTestService(client, ch))
+
+	response, code := getItemsList(t, handler, "/api/v1/items/list")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if response.Total != 1 || response.Items[0].MarketHashName != "AK-47 | Redline" {
+		t.Fatalf("expected stale items, got %+v", response.Items)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for client.calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if client.calls.Load() == 0 {
+		t.Fatalf("expected background refresh of stale items")
+	}
+}
+
+func TestGetItemsStaleWindowExpired(t *testing.T) {
+	client := &externalClientMock{err: errors.New("upstream is down")}
+
+	ch := cache.New()
+	ch.SetWithStale("items:730:EUR", newCatalog([]GetItemsResponseDto{{MarketHashName: "AK-47 | Redline"}}), -time.Hour, time.Minute)
+
+	handler := NewHandler(newTestService(client, ch))
+
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", code)
+	}
+}
+
+func TestRefresherServesCatalogFromMemory(t *testing.T) {
+	client := getCatalogMock()
+	svc := newTestService(client, cache.New())
+	refresher := NewRefresher(svc, logger, []CatalogKey{{AppId: 730, Currency: "EUR"}}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		refresher.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(svc.GetCatalogStatus()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("refresher did not stop on context cancellation")
+	}
+
+	client.err = errors.New("upstream is down")
+
+	handler := NewHandler(svc)
+	response, code := getItemsList(t, handler, "/api/v1/items/list")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if response.Total != 4 {
+		t.Fatalf("expected 4 items from memory, got %d", response.Total)
+	}
+
+	if err := svc.pollCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"}); err == nil {
+		t.Fatalf("expected refresh error")
+	}
+
+	status := svc.GetCatalogStatus()
+	if len(status) != 1 || status[0].LastRefreshAt == nil || status[0].LastError == nil || status[0].ItemsCount != 4 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code != http.StatusOK {
+		t.Fatalf("expected last good catalog after failed refresh, got %d", code)
+	}
+}
+
+func TestPolledCatalogExpiresWhenPollsKeepFailing(t *testing.T) {
+	client := getCatalogMock()
+	providers := NewProviderRegistry()
+	_ = providers.Register(DefaultProviderName, client)
+	svc := NewService(providers, &repositoryMock{}, logger, cache.New(), CacheOptions{
+		ItemsTTL:      10 * time.Millisecond,
+		ItemsStaleTTL: 10 * time.Millisecond,
+	})
+
+	key := CatalogKey{AppId: 730, Currency: "EUR"}
+	if err := svc.pollCatalog(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	client.err = errors.New("upstream is down")
+
+	handler := NewHandler(svc)
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code != http.StatusOK {
+		t.Fatalf("expected polled catalog from memory, got %d", code)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if err := svc.pollCatalog(context.Background(), key); err == nil {
+		t.Fatalf("expected refresh error")
+	}
+
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code == http.StatusOK {
+		t.Fatalf("expected polled catalog to expire after the stale bound")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(2, 200*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected third call to wait for a token, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+type parallelClientMock struct {
+	arrived     atomic.Int32
+	bothStarted chan struct{}
+	failWith    error
+	cancelled   atomic.Bool
+}
+
+func newParallelClientMock(failWith error) *parallelClientMock {
+	return &parallelClientMock{bothStarted: make(chan struct{}), failWith: failWith}
+}
+
+func (c *parallelClientMock) GetItems(ctx context.Context, params map[string]string) ([]domain.ClientResponseItem, error) {
+	if c.arrived.Add(1) == 2 {
+		close(c.bothStarted)
+	}
+
+	if params["tradable"] != "0" {
+		// Tradable call waits until the untradable call has started too
+		select {
+		case <-c.bothStarted:
+		case <-time.After(time.Second):
+			return nil, errors.New("calls were not made concurrently")
+		}
+
+		if c.failWith != nil {
+			return nil, c.failWith
+		}
+		return getCatalogMock().tradable, nil
+	}
+
+	if c.failWith != nil {
+		<-ctx.Done()
+		c.cancelled.Store(true)
+		return nil, ctx.Err()
+	}
+	return getCatalogMock().untradable, nil
+}
+
+func (c *parallelClientMock) GetSalesHistory(_ context.Context, _ map[string]string) ([]domain.SalesHistoryItem, error) {
+	return nil, nil
+}
+
+func TestFetchCatalogRunsRequestsInParallel(t *testing.T) {
+	client := newParallelClientMock(nil)
+	svc := newTestService(client, cache.New())
+
+	c, err := svc.fetchCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.items) != 4 {
+		t.Fatalf("expected 4 merged items, got %d", len(c.items))
+	}
+}
+
+func TestFetchCatalogCancelsOnError(t *testing.T) {
+	upstreamErr := errors.New("upstream is down")
+	client := newParallelClientMock(upstreamErr)
+	svc := newTestService(client, cache.New())
+
+	_, err := svc.fetchCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"})
+	if !errors.Is(err, upstreamErr) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+
+	if !client.cancelled.Load() {
+		t.Fatalf("expected untradable request to be cancelled")
+	}
+}
+
+func TestBuildResponseMergesLists(t *testing.T) {
+	svc := newTestService(getCatalogMock(), cache.New())
+	mock := getCatalogMock()
+
+	items := svc.buildResponse(mock.tradable, mock.untradable)
+	if len(items) != 4 {
+		t.Fatalf("expected 4 merged items, got %d", len(items))
+	}
+
+	for _, item := range items {
+		switch item.MarketHashName {
+		case "AK-47 | Redline":
+			if *item.TradableMinPrice != 10 || *item.UntradableMinPrice != 9 {
+				t.Fatalf("unexpected prices for merged item: %+v", item)
+			}
+		case "M4A4 | Howl":
+			if item.TradableMinPrice != nil || *item.UntradableMinPrice != 1900 {
+				t.Fatalf("unexpected prices for untradable item: %+v", item)
+			}
+		case "AWP | Asiimov":
+			if *item.TradableMinPrice != 80 || item.UntradableMinPrice != nil {
+				t.Fatalf("unexpected prices for tradable item: %+v", item)
+			}
+		}
+	}
+}
+
+func newTestSkinPortClient(serverURL string) *SkinPortClient {
+	return NewSkinPortClient(&http.Client{}, serverURL, ClientOptions{
+		RequestTimeout: time.Second,
+		MaxRetries:     3,
+		BaseBackoff:    time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		MaxBodySize:    1 << 20,
+	})
+}
+
+func TestSkinPortClientRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "<html>Bad Gateway</html>", http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(getCatalogMock().tradable)
+	}))
+	defer server.Close()
+
+	items, err := newTestSkinPortClient(server.URL).GetItems(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 3 || calls.Load() != 3 {
+		t.Fatalf("expected 3 items after 3 calls, got %d items after %d calls", len(items), calls.Load())
+	}
+}
+
+func TestSkinPortClientReturnsStatusError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "<html>Not Found</html>", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestSkinPortClient(server.URL).GetItems(context.Background(), nil)
+
+	var statusErr *UpstreamStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 status error, got %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected client errors not to be retried, got %d calls", calls.Load())
+	}
+}
+
+func TestSkinPortClientGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := newTestSkinPortClient(server.URL).GetItems(context.Background(), nil)
+
+	var statusErr *UpstreamStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 status error, got %v", err)
+	}
+
+	if calls.Load() != 4 {
+		t.Fatalf("expected 1 call and 3 retries, got %d calls", calls.Load())
+	}
+}
+
+func TestSkinPortClientHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(getCatalogMock().tradable)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	if _, err := newTestSkinPortClient(server.URL).GetItems(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected client to wait for Retry-After, took %s", elapsed)
+	}
+}
+
+func TestSkinPortClientRetriesWithinRateLimit(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(status)
+		}))
+
+		client := newTestSkinPortClient(server.URL)
+		client.options.MaxRetries = 10
+		client.options.Limiter = NewRateLimiter(2, time.Minute)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		_, err := client.GetItems(ctx, nil)
+		cancel()
+		server.Close()
+
+		if err == nil {
+			t.Fatalf("%d: expected an error", status)
+		}
+
+		if calls.Load() != 2 {
+			t.Fatalf("%d: expected retries to stay within 2 tokens, got %d upstream calls", status, calls.Load())
+		}
+	}
+}
+
+func TestSkinPortClientRequestTimeout(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		_ = json.NewEncoder(w).Encode(getCatalogMock().tradable)
+	}))
+	defer server.Close()
+
+	client := newTestSkinPortClient(server.URL)
+	client.options.RequestTimeout = 50 * time.Millisecond
+
+	if _, err := client.GetItems(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls.Load() != 2 {
+		t.Fatalf("expected timed out request to be retried, got %d calls", calls.Load())
+	}
+}
+
+func TestSkinPortClientBodySizeLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(getCatalogMock().tradable)
+	}))
+	defer server.Close()
+
+	client := newTestSkinPortClient(server.URL)
+	client.options.MaxBodySize = 64
+
+	if _, err := client.GetItems(context.Background(), nil); !errors.Is(err, BodyTooLargeError) {
+		t.Fatalf("expected body too large error, got %v", err)
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	client := getCatalogMock()
+	client.err = &UpstreamStatusError{StatusCode: http.StatusBadGateway}
+
+	breaker := NewCircuitBreaker(client, logger, CircuitBreakerOptions{
+		FailureThreshold: 2,
+		CoolDown:         50 * time.Millisecond,
+		HalfOpenRequests: 1,
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.GetItems(context.Background(), nil); !errors.Is(err, client.err) {
+			t.Fatalf("expected upstream error, got %v", err)
+		}
+	}
+
+	if state := breaker.Status().State; state != CircuitOpen {
+		t.Fatalf("expected open circuit, got %s", state)
+	}
+
+	if _, err := breaker.GetItems(context.Background(), nil); !errors.Is(err, CircuitOpenError) {
+		t.Fatalf("expected circuit open error, got %v", err)
+	}
+
+	if len(client.params) != 2 {
+		t.Fatalf("expected open circuit to fail fast, got %d upstream calls", len(client.params))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := breaker.GetItems(context.Background(), nil); !errors.Is(err, client.err) {
+		t.Fatalf("expected half-open probe to reach upstream, got %v", err)
+	}
+
+	if state := breaker.Status().State; state != CircuitOpen {
+		t.Fatalf("expected failed probe to reopen circuit, got %s", state)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	client.err = nil
+
+	if _, err := breaker.GetItems(context.Background(), nil); err != nil {
+		t.Fatalf("expected successful probe, got %v", err)
+	}
+
+	status := breaker.Status()
+	if status.State != CircuitClosed || status.Failures != 0 {
+		t.Fatalf("expected closed circuit after successful probe, got %+v", status)
+	}
+}
+
+func TestCircuitBreakerCountsOnlyUpstreamFailures(t *testing.T) {
+	client := getCatalogMock()
+	breaker := NewCircuitBreaker(client, logger, CircuitBreakerOptions{
+		FailureThreshold: 2,
+		CoolDown:         time.Hour,
+		HalfOpenRequests: 1,
+	})
+
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusForbidden} {
+		client.err = &UpstreamStatusError{StatusCode: status}
+
+		for i := 0; i < 2; i++ {
+			if _, err := breaker.GetItems(context.Background(), nil); !errors.Is(err, client.err) {
+				t.Fatalf("expected %d error, got %v", status, err)
+			}
+		}
+	}
+
+	if status := breaker.Status(); status.State != CircuitClosed || status.Failures != 0 {
+		t.Fatalf("expected 4xx responses not to count as failures, got %+v", status)
+	}
+
+	failures := []error{
+		&UpstreamStatusError{StatusCode: http.StatusTooManyRequests},
+		&url.Error{Op: "Get", URL: "https://api.skinport.com/v1/items", Err: errors.New("connection refused")},
+	}
+	for _, err := range failures {
+		client.err = err
+		_, _ = breaker.GetItems(context.Background(), nil)
+	}
+
+	if state := breaker.Status().State; state != CircuitOpen {
+		t.Fatalf("expected 429 and transport errors to open the circuit, got %s", state)
+	}
+
+	// Sales history has its own circuit
+	client.err = nil
+	if _, err := breaker.GetSalesHistory(context.Background(), nil); err != nil {
+		t.Fatalf("expected sales history to reach upstream, got %v", err)
+	}
+
+	if state := breaker.SalesHistoryStatus().State; state != CircuitClosed {
+		t.Fatalf("expected closed sales history circuit, got %s", state)
+	}
+
+	client.err = &UpstreamStatusError{StatusCode: http.StatusServiceUnavailable}
+	for i := 0; i < 2; i++ {
+		_, _ = breaker.GetSalesHistory(context.Background(), nil)
+	}
+
+	if state := breaker.SalesHistoryStatus().State; state != CircuitOpen {
+		t.Fatalf("expected open sales history circuit, got %s", state)
+	}
+}
+
+func TestGetItemsWithOpenCircuit(t *testing.T) {
+	client := &externalClientMock{err: &UpstreamStatusError{StatusCode: http.StatusServiceUnavailable}}
+	breaker := NewCircuitBreaker(client, logger, CircuitBreakerOptions{
+		FailureThreshold: 1,
+		CoolDown:         time.Hour,
+		HalfOpenRequests: 1,
+	})
+
+	if _, err := breaker.GetItems(context.Background(), nil); !errors.Is(err, client.err) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+
+	handler := NewHandler(newTestService(breaker, cache.New()))
+
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.GetStatus(rec, httptest.NewRequest(http.MethodGet, "/api/v1/items/status", nil))
+
+	var status ItemsStatusResponseDto
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Upstream == nil || status.Upstream.State != CircuitOpen {
+		t.Fatalf("expected open circuit in status, got %+v", status.Upstream)
+	}
+
+	if salesHistory := status.Providers[0].SalesHistoryUpstream; salesHistory == nil || salesHistory.State != CircuitClosed {
+		t.Fatalf("expected closed sales history circuit in status, got %+v", salesHistory)
+	}
+}
+
+func TestSkinPortClientDecodesContentEncodings(t *testing.T) {
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"br": func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriter(w)
+		},
+		"gzip": func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		"deflate": func(w io.Writer) io.WriteCloser {
+			return zlib.NewWriter(w)
+		},
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			writer, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return writer
+		},
+		"identity": nil,
+		"":         nil,
+	}
+
+	for name, encoder := range encoders {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != acceptEncoding {
+					t.Errorf("unexpected Accept-Encoding: %s", r.Header.Get("Accept-Encoding"))
+				}
+
+				if encoder == nil {
+					w.Header().Set("Content-Encoding", name)
+					_ = json.NewEncoder(w).Encode(getCatalogMock().tradable)
+					return
+				}
+
+				w.Header().Set("Content-Encoding", strings.TrimPrefix(name, "raw-"))
+				writer := encoder(w)
+				_ = json.NewEncoder(writer).Encode(getCatalogMock().tradable)
+				_ = writer.Close()
+			}))
+			defer server.Close()
+
+			items, err := newTestSkinPortClient(server.URL).GetItems(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(items) != 3 || items[0].MarketHashName != "AK-47 | Redline" {
+				t.Fatalf("unexpected items: %+v", items)
+			}
+		})
+	}
+}
+
+func TestSkinPortClientUnsupportedEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "compress")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	if _, err := newTestSkinPortClient(server.URL).GetItems(context.Background(), nil); err == nil {
+		t.Fatalf("expected unsupported encoding error")
+	}
+}
+
+func getSalesHistoryMock() []domain.SalesHistoryItem {
+	avg := 10.5
+	return []domain.SalesHistoryItem{
+		{MarketHashName: "AWP | Asiimov", Currency: "EUR", Last24Hours: domain.SalesAggregate{Avg: &avg, Volume: 3}},
+		{MarketHashName: "AK-47 | Redline", Currency: "EUR", Last7Days: domain.SalesAggregate{Volume: 12}},
+		{MarketHashName: "M4A4 | Howl", Currency: "EUR"},
+	}
+}
+
+func TestGetSalesHistory(t *testing.T) {
+	client := &externalClientMock{salesHistory: getSalesHistoryMock()}
+	handler := NewHandler(newTestService(client, cache.New()))
+
+	get := func(target string) ([]SalesHistoryResponseDto, int) {
+		rec := httptest.NewRecorder()
+		handler.GetSalesHistory(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		var response []SalesHistoryResponseDto
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return response, rec.Code
+	}
+
+	response, code := get("/api/v1/items/sales-history?currency=usd")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if len(response) != 3 || response[0].MarketHashName != "AK-47 | Redline" {
+		t.Fatalf("expected 3 entries sorted by name, got %+v", response)
+	}
+
+	if client.params[0]["currency"] != "USD" || client.params[0]["app_id"] != "730" {
+		t.Fatalf("unexpected upstream params: %v", client.params[0])
+	}
+
+	response, _ = get("/api/v1/items/sales-history?currency=USD&market_hash_name=AWP+%7C+Asiimov&market_hash_name=Unknown")
+	if len(response) != 1 || *response[0].Last24Hours.Avg != 10.5 || response[0].Last24Hours.Volume != 3 {
+		t.Fatalf("expected filtered Asiimov entry, got %+v", response)
+	}
+
+	if len(client.params) != 1 {
+		t.Fatalf("expected sales history to be cached, got %d upstream calls", len(client.params))
+	}
+
+	if _, code := get("/api/v1/items/sales-history?app_id=42"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+}
+
+func TestSkinPortClientGetSalesHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sales/history" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(getSalesHistoryMock())
+	}))
+	defer server.Close()
+
+	history, err := newTestSkinPortClient(server.URL).GetSalesHistory(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 3 || *history[0].Last24Hours.Avg != 10.5 {
+		t.Fatalf("unexpected sales history: %+v", history)
+	}
+}
+
+func TestGetItemByMarketHashName(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewHandler(newTestService(getCatalogMock(), cache.New())))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/AK-47%20%7C%20Redline", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var item GetItemsResponseDto
+	if err := json.NewDecoder(rec.Body).Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+
+	if item.MarketHashName != "AK-47 | Redline" || *item.TradableMinPrice != 10 || *item.UntradableMinPrice != 9 {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/Unknown", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/list", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /items/list to keep working, got %d", rec.Code)
+	}
+}
+
+func TestGetItemsBatch(t *testing.T) {
+	handler := NewHandler(newTestService(getCatalogMock(), cache.New()))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/items/batch",
+		strings.NewReader(`{"market_hash_names": ["M4A4 | Howl", "Unknown", "AWP | Asiimov"]}`),
+	)
+
+	handler.GetItemsBatch(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response GetItemsBatchResponseDto
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.Items) != 2 || response.Items[0].MarketHashName != "M4A4 | Howl" || response.Items[1].MarketHashName != "AWP | Asiimov" {
+		t.Fatalf("unexpected items: %+v", response.Items)
+	}
+
+	if len(response.NotFound) != 1 || response.NotFound[0] != "Unknown" {
+		t.Fatalf("unexpected not found names: %v", response.NotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.GetItemsBatch(rec, httptest.NewRequest(http.MethodPost, "/api/v1/items/batch", strings.NewReader(`{"market_hash_names": []}`)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func newTestSnapshotWriter(repository *repositoryMock, options QueuedListenerOptions) (*QueuedListener, context.CancelFunc) {
+	writer := NewQueuedListener("items snapshot", NewSnapshotWriter(repository, logger), logger, options)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go writer.Run(ctx)
+
+	return writer, cancel
+}
+
+func TestRefreshSavesSnapshot(t *testing.T) {
+	repository := &repositoryMock{saved: make(chan error, 4)}
+	writer, stop := newTestSnapshotWriter(repository, DefaultQueuedListenerOptions())
+	defer stop()
+
+	svc := newTestServiceWithRepository(getCatalogMock(), repository, cache.New())
+	svc.AddListener(writer)
+
+	if err := svc.pollCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+
+	handlerService := newTestServiceWithRepository(getCatalogMock(), repository, cache.New())
+	handlerService.AddListener(writer)
+
+	handler := NewHandler(handlerService)
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := waitSnapshot(t, repository); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(repository.snapshots) != 2 {
+		t.Fatalf("expected a snapshot per refresh, got %d", len(repository.snapshots))
+	}
+
+	if len(repository.snapshots[0]) != 4 {
+		t.Fatalf("expected 4 items in snapshot, got %d", len(repository.snapshots[0]))
+	}
+
+	repository.mu.Lock()
+	repository.err = errors.New("database is down")
+	repository.mu.Unlock()
+
+	if err := svc.pollCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"}); err != nil {
+		t.Fatalf("expected snapshot errors not to fail refresh, got %v", err)
+	}
+
+	if err := waitSnapshot(t, repository); err == nil {
+		t.Fatal("expected snapshot error")
+	}
+}
+
+func TestQueuedListenerDoesNotBlockRefresh(t *testing.T) {
+	repository := &repositoryMock{block: true, saved: make(chan error, 4)}
+	writer, stop := newTestSnapshotWriter(repository, QueuedListenerOptions{
+		QueueSize: 1,
+		Timeout:   50 * time.Millisecond,
+	})
+	defer stop()
+
+	svc := newTestServiceWithRepository(getCatalogMock(), repository, cache.New())
+	svc.AddListener(writer)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := svc.pollCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Fatalf("expected refresh not to wait for snapshots, took %s", elapsed)
+	}
+
+	if err := waitSnapshot(t, repository); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected snapshot to time out, got %v", err)
+	}
+}
+
+type recordedStatement struct {
+	query string
+	args  []driver.Value
+}
+
+// recordingConn is a database/sql driver connection that records every
+// statement, so repository SQL can be checked without a running Postgres.
+type recordingConn struct {
+	mu         sync.Mutex
+	statements []recordedStatement
+	committed  bool
+}
+
+func (c *recordingConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *recordingConn) Driver() driver.Driver                        { return nil }
+func (c *recordingConn) Prepare(string) (driver.Stmt, error)          { return nil, driver.ErrSkip }
+func (c *recordingConn) Close() error                                 { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)                    { return c, nil }
+func (c *recordingConn) Rollback() error                              { return nil }
+
+func (c *recordingConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.committed = true
+	return nil
+}
+
+func (c *recordingConn) record(query string, args []driver.NamedValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg.Value)
+	}
+
+	c.statements = append(c.statements, recordedStatement{query: query, args: values})
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(query, args)
+	return &recordingRows{}, nil
+}
+
+type recordingRows struct {
+	done bool
+}
+
+func (r *recordingRows) Columns() []string { return []string{"id"} }
+func (r *recordingRows) Close() error      { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+func TestRepositorySaveSnapshot(t *testing.T) {
+	conn := &recordingConn{}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+
+	version := "Factory New"
+	tradable := 9.5
+	takenAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	err := NewRepository(db).SaveSnapshot(context.Background(), 730, "EUR", []domain.ItemPrice{
+		{
+			MarketHashName:   "AK-47 | Redline",
+			Version:          &version,
+			ItemPage:         "https://skinport.com/item/ak-47-redline",
+			MarketPage:       "https://skinport.com/market/730?r=ak-47-redline",
+			SuggestedPrice:   12,
+			TradableMinPrice: &tradable,
+			MaxPrice:         15,
+			MeanPrice:        11,
+			MedianPrice:      10.5,
+			Quantity:         40,
+		},
+		{
+			MarketHashName: "M4A4 | \"Howl\"",
+			SuggestedPrice: 2000,
+			MaxPrice:       2100,
+			MeanPrice:      1950,
+			MedianPrice:    1900,
+			Quantity:       1,
+		},
+	}, takenAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conn.committed {
+		t.Fatal("expected snapshot transaction to be committed")
+	}
+
+	if len(conn.statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(conn.statements))
+	}
+
+	for i, statement := range conn.statements {
+		highest := 0
+		for _, match := range placeholderPattern.FindAllStringSubmatch(statement.query, -1) {
+			n, _ := strconv.Atoi(match[1])
+			highest = max(highest, n)
+		}
+
+		if highest != len(statement.args) {
+			t.Fatalf("statement %d uses %d placeholders but got %d args", i, highest, len(statement.args))
+		}
+	}
+
+	items, snapshot, prices := conn.statements[0], conn.statements[1], conn.statements[2]
+
+	expectedItems := []driver.Value{
+		int64(730),
+		`{"AK-47 | Redline","M4A4 | \"Howl\""}`,
+		`{"Factory New",NULL}`,
+		`{"https://skinport.com/item/ak-47-redline",""}`,
+		`{"https://skinport.com/market/730?r=ak-47-redline",""}`,
+	}
+	if !slices.Equal(items.args, expectedItems) {
+		t.Fatalf("unexpected items args %v", items.args)
+	}
+
+	expectedSnapshot := []driver.Value{int64(730), "EUR", int64(2), takenAt}
+	if !slices.Equal(snapshot.args, expectedSnapshot) {
+		t.Fatalf("unexpected snapshot args %v", snapshot.args)
+	}
+
+	expectedPrices := []driver.Value{
+		int64(1),
+		int64(730),
+		"EUR",
+		takenAt,
+		`{"AK-47 | Redline","M4A4 | \"Howl\""}`,
+		"{12,2000}",
+		"{9.5,NULL}",
+		"{NULL,NULL}",
+		"{15,2100}",
+		"{11,1950}",
+		"{10.5,1900}",
+		"{40,1}",
+	}
+	if !slices.Equal(prices.args, expectedPrices) {
+		t.Fatalf("unexpected prices args %v", prices.args)
+	}
+}
+
+func waitSnapshot(t *testing.T, repository *repositoryMock) error {
+	t.Helper()
+
+	select {
+	case err := <-repository.saved:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("snapshot was not saved")
+		return nil
+	}
+}
+
+func TestGetPriceHistory(t *testing.T) {
+	price := 9.5
+	repository := &repositoryMock{
+		history: []domain.PricePoint{
+			{Time: time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), TradableMinPrice: &price, Quantity: 3},
+			{Time: time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC), Quantity: 4},
+		},
+	}
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewHandler(newTestServiceWithRepository(getCatalogMock(), repository, cache.New())))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(
+		http.MethodGet,
+		"/items/AK-47%20%7C%20Redline/history?resolution=day&from=2026-01-01T00:00:00Z&to=2026-01-02T00:00:00Z",
+		nil,
+	))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response PriceHistoryResponseDto
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.MarketHashName != "AK-47 | Redline" || response.Resolution != ResolutionDay || len(response.Points) != 2 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+
+	if *response.Points[0].TradableMinPrice != 9.5 || response.Points[1].TradableMinPrice != nil {
+		t.Fatalf("unexpected points: %+v", response.Points)
+	}
+
+	for _, target := range []string{
+		"/items/AK-47/history?resolution=minute",
+		"/items/AK-47/history?from=yesterday",
+		"/items/AK-47/history?from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z",
+		"/items/AK-47/history?from=2020-01-01T00:00:00Z&to=2026-01-01T00:00:00Z",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+type listenerMock struct {
+	mu    sync.Mutex
+	calls []CatalogKey
+	items int
+}
+
+func (l *listenerMock) OnCatalogRefresh(_ context.Context, appId int, currency string, items []GetItemsResponseDto, _ time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls = append(l.calls, CatalogKey{AppId: appId, Currency: currency})
+	l.items = len(items)
+}
+
+func TestRefreshNotifiesListeners(t *testing.T) {
+	listener := &listenerMock{}
+	svc := newTestService(getCatalogMock(), cache.New())
+	svc.AddListener(listener)
+
+	if err := svc.pollCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listener.calls) != 1 || listener.calls[0] != (CatalogKey{AppId: 730, Currency: "EUR"}) {
+		t.Fatalf("expected one notification for 730:EUR, got %v", listener.calls)
+	}
+
+	if listener.items != 4 {
+		t.Fatalf("expected 4 items in notification, got %d", listener.items)
+	}
+
+	svc = newTestService(&externalClientMock{err: errors.New("upstream is down")}, cache.New())
+	svc.AddListener(listener)
+
+	if err := svc.pollCatalog(context.Background(), CatalogKey{AppId: 730, Currency: "EUR"}); err == nil {
+		t.Fatal("expected refresh error")
+	}
+
+	if len(listener.calls) != 1 {
+		t.Fatalf("expected failed refresh not to notify listeners, got %d calls", len(listener.calls))
+	}
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSEEvent reads the next event, skipping comments and the retry field
+func readSSEEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error while reading stream: %s", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if event.event != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openStream(t *testing.T, url string, lastEventId string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url+"/items/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	return resp
+}
+
+func TestStreamChanges(t *testing.T) {
+	client := getCatalogMock()
+	svc := newTestService(client, cache.New())
+	key := CatalogKey{AppId: 730, Currency: "EUR"}
+
+	if err := svc.pollCatalog(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewHandler(svc))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp := openStream(t, server.URL, "")
+	defer resp.Body.Close()
+
+	client.mu.Lock()
+	client.tradable = []domain.ClientResponseItem{
+		{MarketHashName: "AK-47 | Redline", SuggestedPrice: 12, MinPrice: 11, Quantity: 40, UpdatedAt: 5},
+		{MarketHashName: "AWP | Asiimov", SuggestedPrice: 90, MinPrice: 80, Quantity: 5, UpdatedAt: 1},
+		{MarketHashName: "Glock-18 | Fade", SuggestedPrice: 550, MinPrice: 500, Quantity: 2, UpdatedAt: 5},
+	}
+	client.mu.Unlock()
+
+	if err := svc.pollCatalog(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	event := readSSEEvent(t, bufio.NewReader(resp.Body))
+	if event.event != "change" || event.id != "1" {
+		t.Fatalf("expected change event with id 1, got %+v", event)
+	}
+
+	var change CatalogChangeEventDto
+	if err := json.Unmarshal([]byte(event.data), &change); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(change.Added) != 1 || change.Added[0].MarketHashName != "Glock-18 | Fade" {
+		t.Fatalf("expected Glock-18 | Fade to be added, got %+v", change.Added)
+	}
+
+	if len(change.Removed) != 1 || change.Removed[0] != "AK-47 | Vulcan" {
+		t.Fatalf("expected AK-47 | Vulcan to be removed, got %v", change.Removed)
+	}
+
+	if len(change.Changed) != 1 || change.Changed[0].MarketHashName != "AK-47 | Redline" ||
+		*change.Changed[0].Before.TradableMinPrice != 10 || *change.Changed[0].After.TradableMinPrice != 11 {
+		t.Fatalf("expected AK-47 | Redline price change 10 -> 11, got %+v", change.Changed)
+	}
+
+	// A client reconnecting after the event it missed gets it replayed
+	resumed := openStream(t, server.URL, "0")
+	defer resumed.Body.Close()
+
+	if event := readSSEEvent(t, bufio.NewReader(resumed.Body)); event.event != "change" || event.id != "1" {
+		t.Fatalf("expected replayed change event with id 1, got %+v", event)
+	}
+
+	// Unknown ids can't be resumed, so the client is asked to reload
+	reset := openStream(t, server.URL, "42")
+	defer reset.Body.Close()
+
+	if event := readSSEEvent(t, bufio.NewReader(reset.Body)); event.event != "reset" || event.id != "1" {
+		t.Fatalf("expected reset event with id 1, got %+v", event)
+	}
+}
+
+func TestStreamHeartbeatAndShutdown(t *testing.T) {
+	svc := newTestService(getCatalogMock(), cache.New())
+
+	handler := NewHandler(svc)
+	handler.heartbeat = 10 * time.Millisecond
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, handler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp := openStream(t, server.URL, "")
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == ": heartbeat\n" {
+			break
+		}
+	}
+
+	svc.CloseStreams()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(reader)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected stream to end cleanly, got %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected stream to end after CloseStreams")
+	}
+}
+
+func TestStreamWithInvalidLastEventId(t *testing.T) {
+	handler := NewHandler(newTestService(getCatalogMock(), cache.New()))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/items/stream", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+
+	handler.StreamChanges(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestChangeFeedEvictsOldEvents(t *testing.T) {
+	feed := newChangeFeed()
+	key := CatalogKey{AppId: 730, Currency: "EUR"}
+
+	for i := 0; i <= changeFeedSize+1; i++ {
+		feed.publish(key, newCatalog([]GetItemsResponseDto{{MarketHashName: "AK-47 | Redline", Quantity: i}}), time.Now())
+	}
+
+	if latest := feed.latestId(); latest != changeFeedSize+1 {
+		t.Fatalf("expected latest id %d, got %d", changeFeedSize+1, latest)
+	}
+
+	if _, _, ok := feed.since(0); ok {
+		t.Fatal("expected evicted events not to be resumable")
+	}
+
+	events, _, ok := feed.since(1)
+	if !ok || len(events) != changeFeedSize || events[0].Id != 2 {
+		t.Fatalf("expected %d events starting from id 2, got %d", changeFeedSize, len(events))
+	}
+}
+
+func TestChangeFeedBoundsKeptItems(t *testing.T) {
+	feed := newChangeFeed()
+	key := CatalogKey{AppId: 730, Currency: "EUR"}
+
+	newItems := func(quantity int) *catalog {
+		items := make([]GetItemsResponseDto, 0, changeFeedMaxItems/2)
+		for i := range changeFeedMaxItems / 2 {
+			items = append(items, GetItemsResponseDto{MarketHashName: strconv.Itoa(i), Quantity: quantity})
+		}
+		return newCatalog(items)
+	}
+
+	// Every refresh changes half of the item limit
+	for i := 0; i <= 3; i++ {
+		feed.publish(key, newItems(i), time.Now())
+	}
+
+	if _, _, ok := feed.since(0); ok {
+		t.Fatal("expected oversized events to be evicted")
+	}
+
+	events, _, ok := feed.since(1)
+	if !ok || len(events) != 2 || events[0].Id != 2 {
+		t.Fatalf("expected the last 2 events, got %d", len(events))
+	}
+
+	if feed.items != changeFeedMaxItems {
+		t.Fatalf("expected %d kept items, got %d", changeFeedMaxItems, feed.items)
+	}
+
+	// A single event over the limit is still kept
+	huge := make([]GetItemsResponseDto, 0, changeFeedMaxItems+1)
+	for i := range changeFeedMaxItems + 1 {
+		huge = append(huge, GetItemsResponseDto{MarketHashName: "new " + strconv.Itoa(i)})
+	}
+	feed.publish(key, newCatalog(huge), time.Now())
+
+	events, _, ok = feed.since(3)
+	if !ok || len(events) != 1 || events[0].Id != 4 {
+		t.Fatalf("expected only the newest event, got %d", len(events))
+	}
+}
+
+func getItemsSpread(t *testing.T, handler *Handler, target string) (GetItemsSpreadResponseDto, int) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.GetItemsSpread(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var response GetItemsSpreadResponseDto
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return response, rec.Code
+}
+
+func spreadNames(items []ItemSpreadDto) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.MarketHashName)
+	}
+	return names
+}
+
+func TestGetItemsSpread(t *testing.T) {
+	handler := NewHandler(newTestService(getCatalogMock(), cache.New()))
+
+	response, code := getItemsSpread(t, handler, "/api/v1/items/spread")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// Only Redline has both tradable and untradable listings
+	if response.Total != 1 || response.Items[0].MarketHashName != "AK-47 | Redline" {
+		t.Fatalf("unexpected items: %v", spreadNames(response.Items))
+	}
+
+	redline := response.Items[0]
+	if *redline.UntradableSpread != 1 || *redline.UntradableSpreadPercent != 11.11 {
+		t.Fatalf("expected untradable spread 1 (11.11%%), got %v (%v%%)", *redline.UntradableSpread, *redline.UntradableSpreadPercent)
+	}
+
+	if *redline.SuggestedSpread != 2 || *redline.SuggestedSpreadPercent != 16.67 {
+		t.Fatalf("expected suggested spread 2 (16.67%%), got %v (%v%%)", *redline.SuggestedSpread, *redline.SuggestedSpreadPercent)
+	}
+
+	tests := []struct {
+		target   string
+		expected []string
+	}{
+		{"/api/v1/items/spread?basis=suggested", []string{"AK-47 | Redline", "AWP | Asiimov", "AK-47 | Vulcan"}},
+		{"/api/v1/items/spread?basis=suggested&sort=absolute", []string{"AWP | Asiimov", "AK-47 | Vulcan", "AK-47 | Redline"}},
+		{"/api/v1/items/spread?basis=suggested&min_quantity=10", []string{"AK-47 | Redline", "AK-47 | Vulcan"}},
+		{"/api/v1/items/spread?basis=suggested&min_spread=5", []string{"AWP | Asiimov", "AK-47 | Vulcan"}},
+		{"/api/v1/items/spread?basis=suggested&min_spread_percent=10", []string{"AK-47 | Redline", "AWP | Asiimov"}},
+		{"/api/v1/items/spread?basis=suggested&limit=1&offset=1", []string{"AWP | Asiimov"}},
+	}
+
+	for _, tt := range tests {
+		response, code := getItemsSpread(t, handler, tt.target)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.target, code)
+		}
+
+		if names := spreadNames(response.Items); !slices.Equal(names, tt.expected) {
+			t.Fatalf("%s: expected %v, got %v", tt.target, tt.expected, names)
+		}
+	}
+
+	for _, target := range []string{
+		"/api/v1/items/spread?basis=median",
+		"/api/v1/items/spread?sort=name",
+		"/api/v1/items/spread?min_quantity=-1",
+		"/api/v1/items/spread?min_spread=abc",
+		"/api/v1/items/spread?min_spread=-5",
+		"/api/v1/items/spread?min_spread_percent=NaN",
+		"/api/v1/items/spread?limit=0",
+	} {
+		if _, code := getItemsSpread(t, handler, target); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, code)
+		}
+	}
+}
+
+func TestGetItemsSpreadRanksByMagnitude(t *testing.T) {
+	client := &externalClientMock{
+		tradable: []domain.ClientResponseItem{
+			{MarketHashName: "AK-47 | Redline", SuggestedPrice: 12, MinPrice: 10, Quantity: 40},
+			{MarketHashName: "AWP | Asiimov", SuggestedPrice: 90, MinPrice: 120, Quantity: 5},
+			{MarketHashName: "AK-47 | Vulcan", SuggestedPrice: 70, MinPrice: 65, Quantity: 12},
+		},
+		untradable: []domain.ClientResponseItem{},
+	}
+
+	handler := NewHandler(newTestService(client, cache.New()))
+
+	tests := []struct {
+		target   string
+		expected []string
+	}{
+		{"/api/v1/items/spread?basis=suggested&sort=absolute", []string{"AWP | Asiimov", "AK-47 | Vulcan", "AK-47 | Redline"}},
+		{"/api/v1/items/spread?basis=suggested", []string{"AWP | Asiimov", "AK-47 | Redline", "AK-47 | Vulcan"}},
+		{"/api/v1/items/spread?basis=suggested&min_spread=20", []string{"AWP | Asiimov"}},
+		{"/api/v1/items/spread?basis=suggested&min_spread_percent=10", []string{"AWP | Asiimov", "AK-47 | Redline"}},
+	}
+
+	for _, tt := range tests {
+		response, code := getItemsSpread(t, handler, tt.target)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.target, code)
+		}
+
+		if names := spreadNames(response.Items); !slices.Equal(names, tt.expected) {
+			t.Fatalf("%s: expected %v, got %v", tt.target, tt.expected, names)
+		}
+
+		if asiimov := response.Items[0]; *asiimov.SuggestedSpread != -30 {
+			t.Fatalf("%s: expected negative spread -30, got %v", tt.target, *asiimov.SuggestedSpread)
+		}
+	}
+}
+
+func newMultiProviderService(t *testing.T, clients map[string]ExternalAPIClient, names ...string) *Service {
+	t.Helper()
+
+	providers := NewProviderRegistry()
+	for _, name := range names {
+		if err := providers.Register(name, clients[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewService(providers, &repositoryMock{}, logger, cache.New(), CacheOptions{
+		ItemsTTL:      5 * time.Minute,
+		ItemsStaleTTL: time.Hour,
+	})
+}
+
+func TestItemsAggregatedAcrossProviders(t *testing.T) {
+	other := &externalClientMock{
+		tradable: []domain.ClientResponseItem{
+			{MarketHashName: "AK-47 | Redline", SuggestedPrice: 11, MinPrice: 8.5, Quantity: 3, UpdatedAt: 7},
+			{MarketHashName: "Glock-18 | Fade", SuggestedPrice: 550, MinPrice: 500, Quantity: 2, UpdatedAt: 1},
+		},
+		untradable: []domain.ClientResponseItem{},
+	}
+
+	svc := newMultiProviderService(t, map[string]ExternalAPIClient{
+		"skinport": getCatalogMock(),
+		"other":    other,
+	}, "skinport", "other")
+
+	handler := NewHandler(svc)
+
+	response, code := getItemsList(t, handler, "/api/v1/items/list")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if response.Total != 5 || len(response.UnavailableProviders) != 0 {
+		t.Fatalf("expected 5 items from both providers, got %d (unavailable %v)", response.Total, response.UnavailableProviders)
+	}
+
+	redline := response.Items[slices.IndexFunc(response.Items, func(item GetItemsResponseDto) bool {
+		return item.MarketHashName == "AK-47 | Redline"
+	})]
+
+	if len(redline.Providers) != 2 || *redline.Providers["skinport"].TradableMinPrice != 10 || *redline.Providers["other"].TradableMinPrice != 8.5 {
+		t.Fatalf("unexpected per-provider prices: %+v", redline.Providers)
+	}
+
+	if *redline.TradableMinPrice != 8.5 || *redline.UntradableMinPrice != 9 || redline.Quantity != 43 || redline.SuggestedPrice != 12 {
+		t.Fatalf("unexpected merged item: %+v", redline)
+	}
+
+	if redline.BestPrice == nil || *redline.BestPrice != (BestPriceDto{Provider: "other", Price: 8.5, Tradable: true}) {
+		t.Fatalf("expected best price 8.5 from other, got %+v", redline.BestPrice)
+	}
+
+	status := svc.GetStatus()
+	if len(status.Providers) != 2 || status.Providers[0].Name != "skinport" || status.Providers[1].Name != "other" {
+		t.Fatalf("unexpected providers status: %+v", status.Providers)
+	}
+}
+
+func TestItemsWithoutProviders(t *testing.T) {
+	svc := newMultiProviderService(t, nil)
+	handler := NewHandler(svc)
+
+	if _, code := getItemsList(t, handler, "/api/v1/items/list"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without providers, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.GetSalesHistory(rec, httptest.NewRequest(http.MethodGet, "/api/v1/items/sales-history", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 sales history without providers, got %d", rec.Code)
+	}
+
+	status := svc.GetStatus()
+	if len(status.Providers) != 0 || status.Upstream != nil {
+		t.Fatalf("expected empty providers status, got %+v", status)
+	}
+}
+
+func TestItemsServedWhenOneProviderFails(t *testing.T) {
+	svc := newMultiProviderService(t, map[string]ExternalAPIClient{
+		"skinport": getCatalogMock(),
+		"broken":   &externalClientMock{err: errors.New("marketplace is down")},
+	}, "broken", "skinport")
+
+	response, code := getItemsList(t, NewHandler(svc), "/api/v1/items/list")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if response.Total != 4 || !slices.Equal(response.UnavailableProviders, []string{"broken"}) {
+		t.Fatalf("expected 4 items without broken provider, got %d (unavailable %v)", response.Total, response.UnavailableProviders)
+	}
+
+	svc = newMultiProviderService(t, map[string]ExternalAPIClient{
+		"skinport": &externalClientMock{err: errors.New("skinport is down")},
+		"broken":   &externalClientMock{err: errors.New("marketplace is down")},
+	}, "skinport", "broken")
+
+	if _, code := getItemsList(t, NewHandler(svc), "/api/v1/items/list"); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when every provider fails, got %d", code)
+	}
+}
+
+func TestProviderRegistry(t *testing.T) {
+	providers := NewProviderRegistry()
+
+	if err := providers.Register("skinport", getCatalogMock()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := providers.Register("skinport", getCatalogMock()); err == nil {
+		t.Fatal("expected duplicate provider to be rejected")
+	}
+
+	if err := providers.Register("", getCatalogMock()); err == nil {
+		t.Fatal("expected empty provider name to be rejected")
+	}
+
+	configs, err := ParseProviders(" mirror=https://mirror.example.com/v1/ , local=http://localhost:8090")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ProviderConfig{
+		{Name: "mirror", BaseURL: "https://mirror.example.com/v1"},
+		{Name: "local", BaseURL: "http://localhost:8090"},
+	}
+	if !slices.Equal(configs, expected) {
+		t.Fatalf("expected %v, got %v", expected, configs)
+	}
+
+	configs, err = ParseProviders("mirror=https://mirror.example.com;rate_limit=20; rate_window=1m ;half_open_requests=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []ProviderConfig{{
+		Name:             "mirror",
+		BaseURL:          "https://mirror.example.com",
+		RateLimit:        20,
+		RateWindow:       time.Minute,
+		HalfOpenRequests: 1,
+	}}
+	if !slices.Equal(configs, expected) {
+		t.Fatalf("expected %v, got %v", expected, configs)
+	}
+
+	for _, raw := range []string{
+		"mirror",
+		"=https://mirror.example.com",
+		"mirror=mirror.example.com",
+		"mirror=https://mirror.example.com;rate_limit=0",
+		"mirror=https://mirror.example.com;rate_window=soon",
+		"mirror=https://mirror.example.com;half_open_requests=-1",
+		"mirror=https://mirror.example.com;timeout=5s",
+	} {
+		if _, err := ParseProviders(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestSkinPortClientAgainstFakeSkinPort(t *testing.T) {
+	fake := fakeskinport.New(fakeskinport.Options{
+		FixturesDir:   "../../fixtures/skinport",
+		RetryAfter:    0,
+		TrackRequests: true,
+	}, &http.Client{}, logger)
+	fake.FailNext(http.StatusTooManyRequests, 1)
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	svc := newTestService(newTestSkinPortClient(server.URL), cache.New())
+
+	response, code := getItemsList(t, NewHandler(svc), "/api/v1/items/list")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200 after retrying 429, got %d", code)
+	}
+
+	if response.Total != 4 {
+		t.Fatalf("expected 4 items from fixtures, got %d", response.Total)
+	}
+
+	if len(fake.Requests()) != 3 {
+		t.Fatalf("expected 2 items requests and 1 retry, got %d", len(fake.Requests()))
+	}
+}
+
+//TODO: Add tests for caching time
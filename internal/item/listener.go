@@ -0,0 +1,95 @@
+package item
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type QueuedListenerOptions struct {
+	QueueSize int
+	Timeout   time.Duration
+}
+
+func DefaultQueuedListenerOptions() QueuedListenerOptions {
+	return QueuedListenerOptions{
+		QueueSize: 16,
+		Timeout:   30 * time.Second,
+	}
+}
+
+type catalogRefresh struct {
+	key         CatalogKey
+	items       []GetItemsResponseDto
+	refreshedAt time.Time
+}
+
+// QueuedListener runs a listener in the background. Listeners are notified
+// inside the refresh that users of /items may be waiting on, so anything that
+// talks to the database has to be queued instead of run there.
+type QueuedListener struct {
+	name     string
+	listener CatalogListener
+	logger   *logrus.Logger
+	options  QueuedListenerOptions
+	queue    chan catalogRefresh
+}
+
+func NewQueuedListener(
+	name string,
+	listener CatalogListener,
+	logger *logrus.Logger,
+	options QueuedListenerOptions,
+) *QueuedListener {
+	return &QueuedListener{
+		name:     name,
+		listener: listener,
+		logger:   logger,
+		options:  options,
+		queue:    make(chan catalogRefresh, options.QueueSize),
+	}
+}
+
+// OnCatalogRefresh queues the refresh. When the queue is full the refresh is
+// dropped rather than blocking the caller.
+func (l *QueuedListener) OnCatalogRefresh(
+	_ context.Context,
+	appId int,
+	currency string,
+	items []GetItemsResponseDto,
+	refreshedAt time.Time,
+) {
+	r := catalogRefresh{
+		key:         CatalogKey{AppId: appId, Currency: currency},
+		items:       items,
+		refreshedAt: refreshedAt,
+	}
+
+	select {
+	case l.queue <- r:
+	default:
+		l.logger.Warnf("The %s queue is full, dropping refresh of %s", l.name, r.key.cacheKey())
+	}
+}
+
+// Run passes queued refreshes to the listener until ctx is done
+func (l *QueuedListener) Run(ctx context.Context) {
+	l.logger.Infof("Starting %s worker", l.name)
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.logger.Infof("The %s worker stopped", l.name)
+			return
+		case r := <-l.queue:
+			l.notify(ctx, r)
+		}
+	}
+}
+
+func (l *QueuedListener) notify(ctx context.Context, r catalogRefresh) {
+	ctx, cancel := context.WithTimeout(ctx, l.options.Timeout)
+	defer cancel()
+
+	l.listener.OnCatalogRefresh(ctx, r.key.AppId, r.key.Currency, r.items, r.refreshedAt)
+}
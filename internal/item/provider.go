@@ -0,0 +1,219 @@
+package item
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultProviderName = "skinport"
+
+var NoProvidersError = errors.New("no items providers registered")
+
+type Provider struct {
+	Name   string
+	Client ExternalAPIClient
+}
+
+// ProviderRegistry holds the marketplaces items are aggregated from. The first
+// registered provider is the primary one: the sales history is served by it
+// alone and is not aggregated.
+type ProviderRegistry struct {
+	providers []Provider
+}
+
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{}
+}
+
+// Register must be called before the registry is passed to the service
+func (r *ProviderRegistry) Register(name string, client ExternalAPIClient) error {
+	if name == "" {
+		return errors.New("provider name must not be empty")
+	}
+
+	for _, p := range r.providers {
+		if p.Name == name {
+			return fmt.Errorf("provider %s is already registered", name)
+		}
+	}
+
+	r.providers = append(r.providers, Provider{Name: name, Client: client})
+
+	return nil
+}
+
+func (r *ProviderRegistry) Providers() []Provider {
+	return r.providers
+}
+
+// primary returns false when no provider is registered
+func (r *ProviderRegistry) primary() (Provider, bool) {
+	if len(r.providers) == 0 {
+		return Provider{}, false
+	}
+
+	return r.providers[0], true
+}
+
+// ProviderConfig describes an additional marketplace. Zero options fall back
+// to the SkinPort settings.
+type ProviderConfig struct {
+	Name             string
+	BaseURL          string
+	RateLimit        int
+	RateWindow       time.Duration
+	HalfOpenRequests int
+}
+
+// ParseProviders parses comma separated name=base_url pairs of additional
+// SkinPort compatible marketplaces. Each pair can be followed by semicolon
+// separated options: rate_limit, rate_window and half_open_requests, e.g.
+// mirror=https://mirror.example.com;rate_limit=20;rate_window=1m.
+func ParseProviders(raw string) ([]ProviderConfig, error) {
+	var configs []ProviderConfig
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ";")
+
+		name, baseURL, ok := strings.Cut(fields[0], "=")
+		name, baseURL = strings.TrimSpace(name), strings.TrimSpace(baseURL)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid provider %q: must be name=base_url", part)
+		}
+
+		u, err := url.Parse(baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid provider %q: base_url must be an absolute http or https URL", part)
+		}
+
+		config := ProviderConfig{Name: name, BaseURL: strings.TrimSuffix(baseURL, "/")}
+
+		for _, field := range fields[1:] {
+			if err := config.setOption(field); err != nil {
+				return nil, fmt.Errorf("invalid provider %q: %w", part, err)
+			}
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func (c *ProviderConfig) setOption(raw string) error {
+	key, value, _ := strings.Cut(raw, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+	switch key {
+	case "rate_limit", "half_open_requests":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a positive integer", key)
+		}
+
+		if key == "rate_limit" {
+			c.RateLimit = n
+		} else {
+			c.HalfOpenRequests = n
+		}
+	case "rate_window":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a positive duration", key)
+		}
+		c.RateWindow = d
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+
+	return nil
+}
+
+// mergeProviders combines the items of every provider by market_hash_name. Min
+// prices are the lowest across providers and quantities are summed; the other
+// fields come from the first provider, in registry order, listing the item.
+func mergeProviders(names []string, results [][]GetItemsResponseDto) []GetItemsResponseDto {
+	merged := make(map[string]*GetItemsResponseDto)
+	order := make([]string, 0)
+
+	for i, name := range names {
+		for _, item := range results[i] {
+			price := ProviderPriceDto{
+				SuggestedPrice:     item.SuggestedPrice,
+				TradableMinPrice:   item.TradableMinPrice,
+				UntradableMinPrice: item.UntradableMinPrice,
+				Quantity:           item.Quantity,
+				MarketPage:         item.MarketPage,
+			}
+
+			existing, ok := merged[item.MarketHashName]
+			if !ok {
+				item.Providers = map[string]ProviderPriceDto{name: price}
+				merged[item.MarketHashName] = &item
+				order = append(order, item.MarketHashName)
+				continue
+			}
+
+			existing.Providers[name] = price
+			existing.TradableMinPrice = minPrice(existing.TradableMinPrice, item.TradableMinPrice)
+			existing.UntradableMinPrice = minPrice(existing.UntradableMinPrice, item.UntradableMinPrice)
+			existing.Quantity += item.Quantity
+			existing.UpdatedAt = max(existing.UpdatedAt, item.UpdatedAt)
+		}
+	}
+
+	out := make([]GetItemsResponseDto, 0, len(merged))
+	for _, marketHashName := range order {
+		item := merged[marketHashName]
+		item.BestPrice = bestPrice(names, item.Providers)
+		out = append(out, *item)
+	}
+
+	return out
+}
+
+// bestPrice picks the cheapest listing across providers, preferring the
+// earlier provider on a tie.
+func bestPrice(names []string, prices map[string]ProviderPriceDto) *BestPriceDto {
+	var best *BestPriceDto
+
+	for _, name := range names {
+		price, ok := prices[name]
+		if !ok {
+			continue
+		}
+
+		candidates := []struct {
+			value    *float64
+			tradable bool
+		}{
+			{price.TradableMinPrice, true},
+			{price.UntradableMinPrice, false},
+		}
+
+		for _, c := range candidates {
+			if c.value != nil && (best == nil || *c.value < best.Price) {
+				best = &BestPriceDto{Provider: name, Price: *c.value, Tradable: c.tradable}
+			}
+		}
+	}
+
+	return best
+}
+
+func minPrice(a *float64, b *float64) *float64 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+
+	return a
+}
@@ -0,0 +1,148 @@
+package item
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SortByName      = "name"
+	SortByPrice     = "price"
+	SortByQuantity  = "quantity"
+	SortByUpdatedAt = "updated_at"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+
+	DefaultLimit = 100
+	MaxLimit     = 1000
+	MaxBatchSize = 100
+
+	DefaultHistoryPeriod = 7 * 24 * time.Hour
+	MaxHistoryPeriod     = 366 * 24 * time.Hour
+)
+
+func applyQuery(items []GetItemsResponseDto, query GetItemsQueryDto) GetItemsListResponseDto {
+	filtered := make([]GetItemsResponseDto, 0, len(items))
+	for i := range items {
+		if matchesQuery(&items[i], query) {
+			filtered = append(filtered, items[i])
+		}
+	}
+
+	sortItems(filtered, query.Sort, query.Order)
+
+	total := len(filtered)
+	start := min(query.Offset, total)
+	end := min(start+query.Limit, total)
+
+	return GetItemsListResponseDto{
+		Items:  filtered[start:end],
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+}
+
+func matchesQuery(item *GetItemsResponseDto, query GetItemsQueryDto) bool {
+	name := strings.ToLower(item.MarketHashName)
+
+	if query.Search != "" && !strings.Contains(name, strings.ToLower(query.Search)) {
+		return false
+	}
+
+	if query.Prefix != "" && !strings.HasPrefix(name, strings.ToLower(query.Prefix)) {
+		return false
+	}
+
+	if !inRange(item.TradableMinPrice, query.MinTradablePrice, query.MaxTradablePrice) {
+		return false
+	}
+
+	if !inRange(item.UntradableMinPrice, query.MinUntradablePrice, query.MaxUntradablePrice) {
+		return false
+	}
+
+	if !inRange(&item.SuggestedPrice, query.MinSuggestedPrice, query.MaxSuggestedPrice) {
+		return false
+	}
+
+	if query.MinQuantity != nil && item.Quantity < *query.MinQuantity {
+		return false
+	}
+
+	return true
+}
+
+// inRange reports whether value is within [from, to]. A missing price never
+// matches a range that has at least one bound set.
+func inRange(value *float64, from *float64, to *float64) bool {
+	if from == nil && to == nil {
+		return true
+	}
+
+	if value == nil {
+		return false
+	}
+
+	if from != nil && *value < *from {
+		return false
+	}
+
+	if to != nil && *value > *to {
+		return false
+	}
+
+	return true
+}
+
+func sortItems(items []GetItemsResponseDto, sortBy string, order string) {
+	slices.SortFunc(items, func(a, b GetItemsResponseDto) int {
+		var result int
+
+		switch sortBy {
+		case SortByPrice:
+			pa, pb := lowestPrice(&a), lowestPrice(&b)
+			// Items without any price always go last, regardless of order
+			if (pa == nil) != (pb == nil) {
+				if pa == nil {
+					return 1
+				}
+				return -1
+			}
+			if pa != nil {
+				result = cmp.Compare(*pa, *pb)
+			}
+		case SortByQuantity:
+			result = cmp.Compare(a.Quantity, b.Quantity)
+		case SortByUpdatedAt:
+			result = cmp.Compare(a.UpdatedAt, b.UpdatedAt)
+		}
+
+		// Names are unique within the catalog, so they give a stable tie-break
+		if result == 0 {
+			result = strings.Compare(a.MarketHashName, b.MarketHashName)
+		}
+
+		if order == OrderDesc {
+			return -result
+		}
+		return result
+	})
+}
+
+// lowestPrice returns the cheapest min price across tradable and untradable listings
+func lowestPrice(item *GetItemsResponseDto) *float64 {
+	switch {
+	case item.TradableMinPrice == nil:
+		return item.UntradableMinPrice
+	case item.UntradableMinPrice == nil:
+		return item.TradableMinPrice
+	case *item.UntradableMinPrice < *item.TradableMinPrice:
+		return item.UntradableMinPrice
+	default:
+		return item.TradableMinPrice
+	}
+}
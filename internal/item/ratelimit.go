@@ -0,0 +1,53 @@
+package item
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter keeps upstream calls within the limit of requests per window
+// using a token bucket, so bursts up to the limit are allowed.
+type RateLimiter struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64
+	last     time.Time
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		capacity: float64(limit),
+		tokens:   float64(limit),
+		rate:     float64(limit) / window.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// Wait takes a token, waiting for one to be refilled when the bucket is empty
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package item
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type Refresher struct {
+	service  *Service
+	logger   *logrus.Logger
+	keys     []CatalogKey
+	interval time.Duration
+}
+
+func NewRefresher(service *Service, logger *logrus.Logger, keys []CatalogKey, interval time.Duration) *Refresher {
+	return &Refresher{
+		service:  service,
+		logger:   logger,
+		keys:     keys,
+		interval: interval,
+	}
+}
+
+// Run polls the upstream for every configured catalog until ctx is done
+func (r *Refresher) Run(ctx context.Context) {
+	r.logger.Infof("Starting items refresher with interval %s", r.interval)
+
+	r.refreshAll(ctx)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Items refresher stopped")
+			return
+		case <-ticker.C:
+			r.refreshAll(ctx)
+		}
+	}
+}
+
+func (r *Refresher) refreshAll(ctx context.Context) {
+	for _, key := range r.keys {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := r.service.pollCatalog(ctx, key); err != nil {
+			r.logger.Errorf("Error while refreshing items for %s: %s", key.cacheKey(), err)
+		}
+	}
+}
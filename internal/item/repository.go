@@ -0,0 +1,201 @@
+package item
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item/domain"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	ResolutionRaw  = "raw"
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+var resolutionBuckets = map[string]string{
+	ResolutionRaw:  "p.created_at",
+	ResolutionHour: "date_trunc('hour', p.created_at)",
+	ResolutionDay:  "date_trunc('day', p.created_at)",
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+func (r *Repository) SaveSnapshot(
+	ctx context.Context,
+	appId int,
+	currency string,
+	prices []domain.ItemPrice,
+	takenAt time.Time,
+) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var (
+		names       = make([]string, len(prices))
+		versions    = make([]*string, len(prices))
+		itemPages   = make([]string, len(prices))
+		marketPages = make([]string, len(prices))
+		suggested   = make([]float64, len(prices))
+		tradable    = make([]*float64, len(prices))
+		untradable  = make([]*float64, len(prices))
+		maxPrices   = make([]float64, len(prices))
+		mean        = make([]float64, len(prices))
+		median      = make([]float64, len(prices))
+		quantities  = make([]int64, len(prices))
+	)
+
+	for i, p := range prices {
+		names[i] = p.MarketHashName
+		versions[i] = p.Version
+		itemPages[i] = p.ItemPage
+		marketPages[i] = p.MarketPage
+		suggested[i] = p.SuggestedPrice
+		tradable[i] = p.TradableMinPrice
+		untradable[i] = p.UntradableMinPrice
+		maxPrices[i] = p.MaxPrice
+		mean[i] = p.MeanPrice
+		median[i] = p.MedianPrice
+		quantities[i] = int64(p.Quantity)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO items(app_id, market_hash_name, version, item_page, market_page)
+		SELECT $1::int, i.market_hash_name, i.version, i.item_page, i.market_page
+		FROM unnest($2::text[], $3::text[], $4::text[], $5::text[])
+			AS i(market_hash_name, version, item_page, market_page)
+		ON CONFLICT (app_id, market_hash_name) DO UPDATE
+		SET version = EXCLUDED.version, item_page = EXCLUDED.item_page, market_page = EXCLUDED.market_page
+		WHERE (items.version, items.item_page, items.market_page)
+			IS DISTINCT FROM (EXCLUDED.version, EXCLUDED.item_page, EXCLUDED.market_page)
+	`, appId, pq.Array(names), pq.Array(versions), pq.Array(itemPages), pq.Array(marketPages))
+	if err != nil {
+		return err
+	}
+
+	var snapshotId int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO item_snapshots(app_id, currency, items_count, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, appId, currency, len(prices), takenAt).Scan(&snapshotId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO item_prices(
+			snapshot_id, item_id, currency, suggested_price, tradable_min_price, untradable_min_price,
+			max_price, mean_price, median_price, quantity, created_at
+		)
+		SELECT $1::bigint, items.id, $3::varchar, p.suggested_price, p.tradable_min_price, p.untradable_min_price,
+			p.max_price, p.mean_price, p.median_price, p.quantity, $4::timestamp
+		FROM unnest(
+			$5::text[], $6::float8[], $7::float8[], $8::float8[], $9::float8[], $10::float8[], $11::float8[], $12::int[]
+		) AS p(market_hash_name, suggested_price, tradable_min_price, untradable_min_price,
+			max_price, mean_price, median_price, quantity)
+		JOIN items ON items.app_id = $2 AND items.market_hash_name = p.market_hash_name
+	`,
+		snapshotId, appId, currency, takenAt,
+		pq.Array(names), pq.Array(suggested), pq.Array(tradable), pq.Array(untradable),
+		pq.Array(maxPrices), pq.Array(mean), pq.Array(median), pq.Array(quantities),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) GetPriceHistory(
+	ctx context.Context,
+	appId int,
+	currency string,
+	marketHashName string,
+	resolution string,
+	from time.Time,
+	to time.Time,
+) ([]domain.PricePoint, error) {
+	bucket, ok := resolutionBuckets[resolution]
+	if !ok {
+		return nil, fmt.Errorf("unsupported resolution: %s", resolution)
+	}
+
+	query := `
+		SELECT ` + bucket + ` AS bucket,
+			AVG(p.suggested_price),
+			MIN(p.tradable_min_price),
+			MIN(p.untradable_min_price),
+			MAX(p.max_price),
+			AVG(p.mean_price),
+			AVG(p.median_price),
+			ROUND(AVG(p.quantity))::int
+		FROM item_prices p
+		JOIN items ON items.id = p.item_id
+		WHERE items.app_id = $1
+			AND items.market_hash_name = $2
+			AND p.currency = $3
+			AND p.created_at >= $4
+			AND p.created_at < $5
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, appId, marketHashName, currency, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []domain.PricePoint
+
+	for rows.Next() {
+		var (
+			p          domain.PricePoint
+			tradable   sql.NullFloat64
+			untradable sql.NullFloat64
+		)
+
+		err := rows.Scan(
+			&p.Time,
+			&p.SuggestedPrice,
+			&tradable,
+			&untradable,
+			&p.MaxPrice,
+			&p.MeanPrice,
+			&p.MedianPrice,
+			&p.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if tradable.Valid {
+			p.TradableMinPrice = &tradable.Float64
+		}
+		if untradable.Valid {
+			p.UntradableMinPrice = &untradable.Float64
+		}
+
+		history = append(history, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
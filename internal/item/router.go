@@ -4,4 +4,11 @@ import "net/http"
 
 func RegisterRoutes(mux *http.ServeMux, h *Handler) {
 	mux.HandleFunc("GET /items/list", h.GetItems)
+	mux.HandleFunc("GET /items/spread", h.GetItemsSpread)
+	mux.HandleFunc("GET /items/sales-history", h.GetSalesHistory)
+	mux.HandleFunc("GET /items/status", h.GetStatus)
+	mux.HandleFunc("GET /items/stream", h.StreamChanges)
+	mux.HandleFunc("POST /items/batch", h.GetItemsBatch)
+	mux.HandleFunc("GET /items/{market_hash_name}", h.GetItem)
+	mux.HandleFunc("GET /items/{market_hash_name}/history", h.GetPriceHistory)
 }
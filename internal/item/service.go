@@ -2,54 +2,501 @@ package item
 
 import (
 	"context"
+	"errors"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/item/domain"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/cache"
 	customError "github.com/bdzhalalov/kolikosoft-trade/pkg/error"
+	"github.com/bdzhalalov/kolikosoft-trade/pkg/singleflight"
 	"github.com/sirupsen/logrus"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 type ExternalAPIClient interface {
 	GetItems(ctx context.Context, params map[string]string) ([]domain.ClientResponseItem, error)
+	GetSalesHistory(ctx context.Context, params map[string]string) ([]domain.SalesHistoryItem, error)
+}
+
+type RepositoryInterface interface {
+	GetPriceHistory(
+		ctx context.Context,
+		appId int,
+		currency string,
+		marketHashName string,
+		resolution string,
+		from time.Time,
+		to time.Time,
+	) ([]domain.PricePoint, error)
+}
+
+type CatalogListener interface {
+	OnCatalogRefresh(ctx context.Context, appId int, currency string, items []GetItemsResponseDto, refreshedAt time.Time)
+}
+
+type upstreamStatusReporter interface {
+	Status() CircuitBreakerStatusDto
+	SalesHistoryStatus() CircuitBreakerStatusDto
+}
+
+const refreshTimeout = 30 * time.Second
+
+type CacheOptions struct {
+	ItemsTTL        time.Duration
+	ItemsStaleTTL   time.Duration
+	SalesHistoryTTL time.Duration
 }
 
 type Service struct {
-	client ExternalAPIClient
-	logger *logrus.Logger
-	cache  *cache.Cache
+	providers  *ProviderRegistry
+	repository RepositoryInterface
+	logger     *logrus.Logger
+	cache      *cache.Cache
+	options    CacheOptions
+	refresh    singleflight.Group
+	catalogs   *catalogStore
+	feed       *changeFeed
+
+	listeners []CatalogListener
 }
 
-func NewService(client ExternalAPIClient, logger *logrus.Logger, cache *cache.Cache) *Service {
+func NewService(
+	providers *ProviderRegistry,
+	repository RepositoryInterface,
+	logger *logrus.Logger,
+	cache *cache.Cache,
+	options CacheOptions,
+) *Service {
 	return &Service{
-		client: client,
-		logger: logger,
-		cache:  cache,
+		providers:  providers,
+		repository: repository,
+		logger:     logger,
+		cache:      cache,
+		options:    options,
+		catalogs:   newCatalogStore(options.ItemsTTL + options.ItemsStaleTTL),
+		feed:       newChangeFeed(),
 	}
 }
 
-func (s *Service) GetItems(ctx context.Context) ([]GetItemsResponseDto, *customError.BaseError) {
-	items, exists := s.cache.Get("items")
+// AddListener registers a listener notified after every catalog refresh. It
+// must be called before the service starts serving requests.
+func (s *Service) AddListener(listener CatalogListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// ChangesSince returns catalog changes after lastId and a channel closed when
+// the next change is published. ok is false when the changes after lastId are
+// no longer kept.
+func (s *Service) ChangesSince(lastId int64) ([]CatalogChangeEventDto, <-chan struct{}, bool) {
+	return s.feed.since(lastId)
+}
+
+func (s *Service) LatestChangeId() int64 {
+	return s.feed.latestId()
+}
+
+// StreamsDone is closed by CloseStreams
+func (s *Service) StreamsDone() <-chan struct{} {
+	return s.feed.done
+}
+
+// CloseStreams ends all open change streams, so the server can shut down
+// without waiting for long-lived connections.
+func (s *Service) CloseStreams() {
+	s.feed.close()
+}
+
+func (s *Service) GetItems(ctx context.Context, query GetItemsQueryDto) (GetItemsListResponseDto, *customError.BaseError) {
+	c, err := s.getCatalog(ctx, CatalogKey{AppId: query.AppId, Currency: query.Currency})
+	if err != nil {
+		return GetItemsListResponseDto{}, err
+	}
+
+	res := applyQuery(c.items, query)
+	res.UnavailableProviders = c.unavailable
+
+	return res, nil
+}
+
+func (s *Service) GetItemsSpread(ctx context.Context, query GetItemsSpreadQueryDto) (GetItemsSpreadResponseDto, *customError.BaseError) {
+	c, err := s.getCatalog(ctx, CatalogKey{AppId: query.AppId, Currency: query.Currency})
+	if err != nil {
+		return GetItemsSpreadResponseDto{}, err
+	}
+
+	return applySpreadQuery(c.items, query), nil
+}
+
+func (s *Service) GetItem(ctx context.Context, key CatalogKey, marketHashName string) (GetItemsResponseDto, *customError.BaseError) {
+	c, err := s.getCatalog(ctx, key)
+	if err != nil {
+		return GetItemsResponseDto{}, err
+	}
+
+	item, ok := c.find(marketHashName)
+	if !ok {
+		return GetItemsResponseDto{}, (&customError.NotFoundError{}).New("Item not found")
+	}
+
+	return item, nil
+}
+
+func (s *Service) GetItemsBatch(ctx context.Context, key CatalogKey, marketHashNames []string) (GetItemsBatchResponseDto, *customError.BaseError) {
+	c, err := s.getCatalog(ctx, key)
+	if err != nil {
+		return GetItemsBatchResponseDto{}, err
+	}
+
+	res := GetItemsBatchResponseDto{
+		Items:    make([]GetItemsResponseDto, 0, len(marketHashNames)),
+		NotFound: make([]string, 0),
+	}
+
+	for _, name := range marketHashNames {
+		if item, ok := c.find(name); ok {
+			res.Items = append(res.Items, item)
+		} else {
+			res.NotFound = append(res.NotFound, name)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Service) GetPriceHistory(
+	ctx context.Context,
+	query PriceHistoryQueryDto,
+) (PriceHistoryResponseDto, *customError.BaseError) {
+	points, err := s.repository.GetPriceHistory(
+		ctx,
+		query.AppId,
+		query.Currency,
+		query.MarketHashName,
+		query.Resolution,
+		query.From,
+		query.To,
+	)
+	if err != nil {
+		s.logger.Errorf("Error while getting price history: %s", err)
+		return PriceHistoryResponseDto{}, (&customError.InternalServerError{}).New()
+	}
+
+	res := PriceHistoryResponseDto{
+		MarketHashName: query.MarketHashName,
+		Currency:       query.Currency,
+		Resolution:     query.Resolution,
+		From:           query.From,
+		To:             query.To,
+		Points:         make([]PricePointDto, 0, len(points)),
+	}
+
+	for _, p := range points {
+		res.Points = append(res.Points, PricePointDto(p))
+	}
+
+	return res, nil
+}
+
+func (s *Service) GetSalesHistory(
+	ctx context.Context,
+	query SalesHistoryQueryDto,
+) ([]SalesHistoryResponseDto, *customError.BaseError) {
+	key := CatalogKey{AppId: query.AppId, Currency: query.Currency}
+	cacheKey := key.salesHistoryCacheKey()
+
+	history, exists := s.cache.Get(cacheKey)
 	if !exists {
-		tradableItems, err := s.client.GetItems(ctx, nil)
-		if err != nil {
-			s.logger.Errorf("Error while getting tradable items: %s", err)
+		select {
+		case res := <-s.refresh.DoChan(cacheKey, func() (any, error) { return s.fetchSalesHistory(ctx, key, cacheKey) }):
+			if errors.Is(res.Err, CircuitOpenError) || errors.Is(res.Err, NoProvidersError) {
+				return nil, (&customError.ServiceUnavailableError{}).New("items provider is temporarily unavailable")
+			}
+			if res.Err != nil {
+				return nil, (&customError.InternalServerError{}).New()
+			}
+			history = res.Value
+		case <-ctx.Done():
+			s.logger.Errorf("Error while waiting for sales history: %s", ctx.Err())
 			return nil, (&customError.InternalServerError{}).New()
 		}
+	}
+
+	return filterSalesHistory(history.([]SalesHistoryResponseDto), query.MarketHashNames), nil
+}
+
+func (s *Service) fetchSalesHistory(ctx context.Context, key CatalogKey, cacheKey string) ([]SalesHistoryResponseDto, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	defer cancel()
+
+	primary, ok := s.providers.primary()
+	if !ok {
+		return nil, NoProvidersError
+	}
+
+	history, err := primary.Client.GetSalesHistory(ctx, key.params())
+	if err != nil {
+		s.logger.Errorf("Error while getting sales history: %s", err)
+		return nil, err
+	}
+
+	result := make([]SalesHistoryResponseDto, 0, len(history))
+	for _, h := range history {
+		if h.MarketHashName == "" {
+			continue
+		}
 
-		untradableItems, err := s.client.GetItems(ctx, map[string]string{
-			"tradable": "0",
+		result = append(result, SalesHistoryResponseDto{
+			MarketHashName: h.MarketHashName,
+			Version:        h.Version,
+			Currency:       h.Currency,
+			ItemPage:       h.ItemPage,
+			MarketPage:     h.MarketPage,
+			Last24Hours:    SalesAggregateDto(h.Last24Hours),
+			Last7Days:      SalesAggregateDto(h.Last7Days),
+			Last30Days:     SalesAggregateDto(h.Last30Days),
+			Last90Days:     SalesAggregateDto(h.Last90Days),
 		})
-		if err != nil {
-			s.logger.Errorf("Error while getting untradable items: %s", err)
+	}
+
+	slices.SortFunc(result, func(a, b SalesHistoryResponseDto) int {
+		return strings.Compare(a.MarketHashName, b.MarketHashName)
+	})
+
+	s.cache.Set(cacheKey, result, s.options.SalesHistoryTTL)
+
+	return result, nil
+}
+
+func filterSalesHistory(history []SalesHistoryResponseDto, names []string) []SalesHistoryResponseDto {
+	if len(names) == 0 {
+		return history
+	}
+
+	out := make([]SalesHistoryResponseDto, 0, len(names))
+	for _, name := range names {
+		if i, found := slices.BinarySearchFunc(history, name, func(h SalesHistoryResponseDto, name string) int {
+			return strings.Compare(h.MarketHashName, name)
+		}); found {
+			out = append(out, history[i])
+		}
+	}
+
+	return out
+}
+
+func (s *Service) GetStatus() ItemsStatusResponseDto {
+	res := ItemsStatusResponseDto{
+		Catalogs:  s.GetCatalogStatus(),
+		Providers: make([]ProviderStatusDto, 0, len(s.providers.Providers())),
+	}
+
+	for _, p := range s.providers.Providers() {
+		provider := ProviderStatusDto{Name: p.Name}
+
+		if reporter, ok := p.Client.(upstreamStatusReporter); ok {
+			status, salesHistoryStatus := reporter.Status(), reporter.SalesHistoryStatus()
+			provider.Upstream = &status
+			provider.SalesHistoryUpstream = &salesHistoryStatus
+		}
+
+		res.Providers = append(res.Providers, provider)
+	}
+
+	// Upstream keeps reporting the primary provider
+	if len(res.Providers) > 0 {
+		res.Upstream = res.Providers[0].Upstream
+	}
+
+	return res
+}
+
+func (s *Service) GetCatalogStatus() []CatalogStatusDto {
+	return s.catalogs.statuses()
+}
+
+func (s *Service) getCatalog(ctx context.Context, key CatalogKey) (*catalog, *customError.BaseError) {
+	if c, ok := s.catalogs.load(key); ok {
+		return c, nil
+	}
+
+	c, fresh, exists := s.cache.GetStale(key.cacheKey())
+	if exists {
+		if !fresh {
+			s.refreshInBackground(ctx, key)
+		}
+		return c.(*catalog), nil
+	}
+
+	select {
+	case res := <-s.refresh.DoChan(key.cacheKey(), func() (any, error) { return s.refreshCatalog(ctx, key) }):
+		if errors.Is(res.Err, CircuitOpenError) || errors.Is(res.Err, NoProvidersError) {
+			return nil, (&customError.ServiceUnavailableError{}).New("items provider is temporarily unavailable")
+		}
+		if res.Err != nil {
 			return nil, (&customError.InternalServerError{}).New()
 		}
+		return res.Value.(*catalog), nil
+	case <-ctx.Done():
+		s.logger.Errorf("Error while waiting for items refresh: %s", ctx.Err())
+		return nil, (&customError.InternalServerError{}).New()
+	}
+}
+
+func (s *Service) refreshInBackground(ctx context.Context, key CatalogKey) {
+	s.refresh.DoChan(key.cacheKey(), func() (any, error) {
+		c, err := s.refreshCatalog(ctx, key)
+		if err != nil {
+			s.logger.Warnf("Serving stale items for %s until refresh succeeds", key.cacheKey())
+		}
+		return c, err
+	})
+}
+
+// refreshCatalog is shared by all requests waiting for the same key, so it
+// must not depend on the cancellation of the request that started it.
+func (s *Service) refreshCatalog(ctx context.Context, key CatalogKey) (*catalog, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	defer cancel()
+
+	result, err := s.fetchCatalog(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.SetWithStale(key.cacheKey(), result, s.options.ItemsTTL, s.options.ItemsStaleTTL)
+	s.afterRefresh(ctx, key, result, time.Now())
+
+	return result, nil
+}
+
+// pollCatalog fetches the catalog and swaps it in the in-memory store. On
+// failure the previous catalog stays available.
+func (s *Service) pollCatalog(ctx context.Context, key CatalogKey) error {
+	result, err := s.fetchCatalog(ctx, key)
+	if err != nil {
+		s.catalogs.fail(key, err, time.Now())
+		return err
+	}
+
+	refreshedAt := time.Now()
+	s.catalogs.swap(key, result, refreshedAt)
+	s.afterRefresh(ctx, key, result, refreshedAt)
+
+	return nil
+}
+
+// afterRefresh runs the work that must happen for every freshly fetched catalog
+func (s *Service) afterRefresh(ctx context.Context, key CatalogKey, c *catalog, refreshedAt time.Time) {
+	s.feed.publish(key, c, refreshedAt)
+
+	for _, listener := range s.listeners {
+		listener.OnCatalogRefresh(ctx, key.AppId, key.Currency, c.items, refreshedAt)
+	}
+}
+
+// fetchCatalog requests the items of every provider concurrently and merges
+// them. A failing provider is left out; only when all of them fail the first
+// error is returned as is.
+func (s *Service) fetchCatalog(ctx context.Context, key CatalogKey) (*catalog, error) {
+	providers := s.providers.Providers()
+	if len(providers) == 0 {
+		return nil, NoProvidersError
+	}
+
+	var (
+		wg      sync.WaitGroup
+		names   = make([]string, len(providers))
+		results = make([][]GetItemsResponseDto, len(providers))
+		errs    = make([]error, len(providers))
+	)
+
+	for i, p := range providers {
+		names[i] = p.Name
+		wg.Go(func() {
+			results[i], errs[i] = s.fetchProviderItems(ctx, p, key)
+		})
+	}
+
+	wg.Wait()
+
+	var (
+		firstErr    error
+		unavailable []string
+	)
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+		unavailable = append(unavailable, names[i])
+	}
+
+	if len(unavailable) == len(providers) {
+		return nil, firstErr
+	}
+
+	if len(unavailable) > 0 {
+		s.logger.Warnf("Items for %s are served without providers: %s", key.cacheKey(), strings.Join(unavailable, ", "))
+	}
+
+	c := newCatalog(mergeProviders(names, results))
+	c.unavailable = unavailable
+
+	return c, nil
+}
+
+// fetchProviderItems requests tradable and untradable items concurrently. The
+// first failure cancels the other request and is returned as is.
+func (s *Service) fetchProviderItems(ctx context.Context, p Provider, key CatalogKey) ([]GetItemsResponseDto, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg              sync.WaitGroup
+		once            sync.Once
+		firstErr        error
+		tradableItems   []domain.ClientResponseItem
+		untradableItems []domain.ClientResponseItem
+	)
+
+	fail := func(err error, message string) {
+		once.Do(func() {
+			firstErr = err
+			s.logger.Errorf(message, p.Name, err)
+			cancel()
+		})
+	}
+
+	wg.Go(func() {
+		items, err := p.Client.GetItems(ctx, key.params())
+		if err != nil {
+			fail(err, "Error while getting tradable items from %s: %s")
+			return
+		}
+		tradableItems = items
+	})
 
-		result := s.buildResponse(tradableItems, untradableItems)
-		s.cache.Set("items", result, 5*time.Minute)
+	wg.Go(func() {
+		items, err := p.Client.GetItems(ctx, key.untradableParams())
+		if err != nil {
+			fail(err, "Error while getting untradable items from %s: %s")
+			return
+		}
+		untradableItems = items
+	})
 
-		return result, nil
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
 	}
-	return items.([]GetItemsResponseDto), nil
+
+	return s.buildResponse(tradableItems, untradableItems), nil
 }
 
 func (s *Service) buildResponse(tradable []domain.ClientResponseItem, untradable []domain.ClientResponseItem) []GetItemsResponseDto {
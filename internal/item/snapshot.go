@@ -0,0 +1,56 @@
+package item
+
+import (
+	"context"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item/domain"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type SnapshotRepositoryInterface interface {
+	SaveSnapshot(ctx context.Context, appId int, currency string, prices []domain.ItemPrice, takenAt time.Time) error
+}
+
+// SnapshotWriter saves refreshed catalogs to the price history. It talks to
+// the database, so it is registered behind a QueuedListener.
+type SnapshotWriter struct {
+	repository SnapshotRepositoryInterface
+	logger     *logrus.Logger
+}
+
+func NewSnapshotWriter(repository SnapshotRepositoryInterface, logger *logrus.Logger) *SnapshotWriter {
+	return &SnapshotWriter{
+		repository: repository,
+		logger:     logger,
+	}
+}
+
+func (w *SnapshotWriter) OnCatalogRefresh(
+	ctx context.Context,
+	appId int,
+	currency string,
+	items []GetItemsResponseDto,
+	refreshedAt time.Time,
+) {
+	prices := make([]domain.ItemPrice, 0, len(items))
+	for _, item := range items {
+		prices = append(prices, domain.ItemPrice{
+			MarketHashName:     item.MarketHashName,
+			Version:            item.Version,
+			ItemPage:           item.ItemPage,
+			MarketPage:         item.MarketPage,
+			SuggestedPrice:     item.SuggestedPrice,
+			TradableMinPrice:   item.TradableMinPrice,
+			UntradableMinPrice: item.UntradableMinPrice,
+			MaxPrice:           item.MaxPrice,
+			MeanPrice:          item.MeanPrice,
+			MedianPrice:        item.MedianPrice,
+			Quantity:           item.Quantity,
+		})
+	}
+
+	key := CatalogKey{AppId: appId, Currency: currency}
+	if err := w.repository.SaveSnapshot(ctx, appId, currency, prices, refreshedAt.UTC()); err != nil {
+		w.logger.Errorf("Error while saving items snapshot for %s: %s", key.cacheKey(), err)
+	}
+}
@@ -0,0 +1,135 @@
+package item
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	// SpreadBasisUntradable compares tradable listings with untradable ones:
+	// tradable_min_price - untradable_min_price, relative to the untradable price.
+	SpreadBasisUntradable = "untradable"
+	// SpreadBasisSuggested compares tradable listings with the suggested price:
+	// suggested_price - tradable_min_price, relative to the suggested price.
+	SpreadBasisSuggested = "suggested"
+
+	SpreadSortAbsolute = "absolute"
+	SpreadSortPercent  = "percent"
+)
+
+func applySpreadQuery(items []GetItemsResponseDto, query GetItemsSpreadQueryDto) GetItemsSpreadResponseDto {
+	spreads := make([]ItemSpreadDto, 0)
+
+	for i := range items {
+		item := &items[i]
+
+		if query.MinQuantity != nil && item.Quantity < *query.MinQuantity {
+			continue
+		}
+
+		spread := itemSpread(item)
+
+		absolute, percent := spread.basis(query.Basis)
+		if absolute == nil {
+			continue
+		}
+
+		// Spreads are negative when the tradable listing is above the reference
+		// price, so they are compared by magnitude
+		if query.MinSpread != nil && math.Abs(*absolute) < *query.MinSpread {
+			continue
+		}
+
+		if query.MinSpreadPercent != nil && math.Abs(*percent) < *query.MinSpreadPercent {
+			continue
+		}
+
+		spreads = append(spreads, spread)
+	}
+
+	slices.SortFunc(spreads, func(a, b ItemSpreadDto) int {
+		aAbsolute, aPercent := a.basis(query.Basis)
+		bAbsolute, bPercent := b.basis(query.Basis)
+
+		// The widest spread goes first whatever its sign
+		var result int
+		if query.Sort == SpreadSortAbsolute {
+			result = cmp.Compare(math.Abs(*bAbsolute), math.Abs(*aAbsolute))
+		} else {
+			result = cmp.Compare(math.Abs(*bPercent), math.Abs(*aPercent))
+		}
+
+		if result == 0 {
+			result = strings.Compare(a.MarketHashName, b.MarketHashName)
+		}
+		return result
+	})
+
+	total := len(spreads)
+	start := min(query.Offset, total)
+	end := min(start+query.Limit, total)
+
+	return GetItemsSpreadResponseDto{
+		Items:  spreads[start:end],
+		Basis:  query.Basis,
+		Sort:   query.Sort,
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+}
+
+// itemSpread computes both spreads; a spread is nil when one of its prices is missing
+func itemSpread(item *GetItemsResponseDto) ItemSpreadDto {
+	spread := ItemSpreadDto{
+		MarketHashName:     item.MarketHashName,
+		Quantity:           item.Quantity,
+		SuggestedPrice:     item.SuggestedPrice,
+		TradableMinPrice:   item.TradableMinPrice,
+		UntradableMinPrice: item.UntradableMinPrice,
+	}
+
+	if item.TradableMinPrice == nil {
+		return spread
+	}
+
+	if item.UntradableMinPrice != nil && *item.UntradableMinPrice > 0 {
+		spread.UntradableSpread, spread.UntradableSpreadPercent = spreadOf(
+			*item.TradableMinPrice,
+			*item.UntradableMinPrice,
+			*item.UntradableMinPrice,
+		)
+	}
+
+	if item.SuggestedPrice > 0 {
+		spread.SuggestedSpread, spread.SuggestedSpreadPercent = spreadOf(
+			item.SuggestedPrice,
+			*item.TradableMinPrice,
+			item.SuggestedPrice,
+		)
+	}
+
+	return spread
+}
+
+func (s *ItemSpreadDto) basis(basis string) (*float64, *float64) {
+	if basis == SpreadBasisSuggested {
+		return s.SuggestedSpread, s.SuggestedSpreadPercent
+	}
+
+	return s.UntradableSpread, s.UntradableSpreadPercent
+}
+
+// spreadOf returns a - b and the same difference in percent of base
+func spreadOf(a float64, b float64, base float64) (*float64, *float64) {
+	absolute := round2(a - b)
+	percent := round2((a - b) / base * 100)
+
+	return &absolute, &percent
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
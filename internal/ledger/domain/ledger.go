@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+type Account struct {
+	Id        int64
+	Code      string
+	Type      string
+	UserId    *int64
+	Balance   int64
+	CreatedAt time.Time
+}
+
+// AccountEntry is a journal entry as seen from a single account
+type AccountEntry struct {
+	Id        int64
+	Type      string
+	Reference string
+	Amount    int64
+	CreatedAt time.Time
+}
+
+// Mismatch is a user whose materialized balance differs from the ledger
+type Mismatch struct {
+	UserId        int64
+	Balance       int64
+	LedgerBalance int64
+}
+
+type Reconciliation struct {
+	UsersChecked int64
+	Mismatches   []Mismatch
+	// Imbalance is the sum of every posting, non-zero only if the ledger itself is broken
+	Imbalance int64
+	CheckedAt time.Time
+}
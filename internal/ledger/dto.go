@@ -0,0 +1,34 @@
+package ledger
+
+import "time"
+
+type AccountResponseDTO struct {
+	Code      string    `json:"code"`
+	Type      string    `json:"type"`
+	UserId    *int64    `json:"user_id"`
+	Balance   int64     `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AccountEntryResponseDTO struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Reference string    `json:"reference"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MismatchResponseDTO struct {
+	UserId        int64 `json:"user_id"`
+	Balance       int64 `json:"balance"`
+	LedgerBalance int64 `json:"ledger_balance"`
+	Difference    int64 `json:"difference"`
+}
+
+type ReconciliationResponseDTO struct {
+	Consistent   bool                  `json:"consistent"`
+	UsersChecked int64                 `json:"users_checked"`
+	Mismatches   []MismatchResponseDTO `json:"mismatches"`
+	Imbalance    int64                 `json:"imbalance"`
+	CheckedAt    time.Time             `json:"checked_at"`
+}
@@ -0,0 +1,88 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/pkg/render"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultEntriesLimit = 100
+	MaxEntriesLimit     = 1000
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+func (h *Handler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	accountType := r.URL.Query().Get("type")
+	switch accountType {
+	case "", AccountTypeUser, AccountTypeSystem, AccountTypeFee, AccountTypeRevenue:
+	default:
+		render.JSON(w, "invalid type: must be one of user, system, fee, revenue", http.StatusBadRequest)
+		return
+	}
+
+	res, e := h.service.GetAccounts(ctx, accountType)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) GetAccountEntries(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	code := r.PathValue("code")
+	if code == "" {
+		render.JSON(w, "invalid account code", http.StatusBadRequest)
+		return
+	}
+
+	limit := DefaultEntriesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > MaxEntriesLimit {
+			render.JSON(w, fmt.Sprintf("invalid limit: must be between 1 and %d", MaxEntriesLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, e := h.service.GetAccountEntries(ctx, code, limit)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	res, e := h.service.Reconcile(ctx)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,105 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+const (
+	AccountTypeUser    = "user"
+	AccountTypeSystem  = "system"
+	AccountTypeFee     = "fee"
+	AccountTypeRevenue = "revenue"
+
+	AccountCash    = "system:cash"
+	AccountFees    = "system:fees"
+	AccountRevenue = "system:revenue"
+
+	EntryOpeningBalance = "opening_balance"
+	EntryDeposit        = "deposit"
+	EntryWithdrawal     = "withdrawal"
+	EntryTransfer       = "transfer"
+	EntryRefund         = "refund"
+)
+
+var (
+	UnbalancedEntryError = errors.New("ledger entry is not balanced")
+	UnknownAccountError  = errors.New("unknown ledger account")
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx, so entries can be posted
+// in the same transaction as the balance change they record.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type Posting struct {
+	Account string
+	Amount  int64
+}
+
+func UserAccount(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+// Move returns the postings moving amount from one account to another
+func Move(from string, to string, amount int64) []Posting {
+	return []Posting{
+		{Account: from, Amount: -amount},
+		{Account: to, Amount: amount},
+	}
+}
+
+// Post writes an immutable journal entry and returns its ID. The postings must
+// sum up to zero; the database checks it again on commit.
+func Post(ctx context.Context, db Querier, entryType string, reference string, postings []Posting) (int64, error) {
+	if len(postings) < 2 {
+		return 0, UnbalancedEntryError
+	}
+
+	var sum int64
+	for _, p := range postings {
+		if p.Amount == 0 {
+			return 0, UnbalancedEntryError
+		}
+		sum += p.Amount
+	}
+
+	if sum != 0 {
+		return 0, UnbalancedEntryError
+	}
+
+	var entryId int64
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO ledger_entries(type, reference)
+		VALUES ($1, $2)
+		RETURNING id
+	`, entryType, reference).Scan(&entryId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range postings {
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO ledger_postings(entry_id, account_id, amount)
+			SELECT $1, id, $3 FROM ledger_accounts WHERE code = $2
+		`, entryId, p.Account, p.Amount)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		if n != 1 {
+			return 0, UnknownAccountError
+		}
+	}
+
+	return entryId, nil
+}
@@ -0,0 +1,327 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/ledger/domain"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var logger = logrus.New()
+
+type repositoryMock struct {
+	err        error
+	accounts   []domain.Account
+	entries    map[int64][]domain.AccountEntry
+	mismatches []domain.Mismatch
+	imbalance  int64
+}
+
+func newRepositoryMock() *repositoryMock {
+	userId := int64(1)
+
+	return &repositoryMock{
+		accounts: []domain.Account{
+			{Id: 1, Code: AccountCash, Type: AccountTypeSystem, Balance: -150},
+			{Id: 2, Code: AccountFees, Type: AccountTypeFee},
+			{Id: 3, Code: AccountRevenue, Type: AccountTypeRevenue},
+			{Id: 4, Code: UserAccount(userId), Type: AccountTypeUser, UserId: &userId, Balance: 150},
+		},
+		entries: map[int64][]domain.AccountEntry{
+			4: {
+				{Id: 2, Type: EntryWithdrawal, Reference: "balance_withdrawals:1", Amount: -50, CreatedAt: time.Now()},
+				{Id: 1, Type: EntryOpeningBalance, Reference: UserAccount(userId), Amount: 200, CreatedAt: time.Now()},
+			},
+		},
+	}
+}
+
+func (r *repositoryMock) GetAccounts(_ context.Context, accountType string) ([]domain.Account, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var accounts []domain.Account
+	for _, a := range r.accounts {
+		if accountType == "" || a.Type == accountType {
+			accounts = append(accounts, a)
+		}
+	}
+
+	return accounts, nil
+}
+
+func (r *repositoryMock) GetAccount(_ context.Context, code string) (domain.Account, error) {
+	if r.err != nil {
+		return domain.Account{}, r.err
+	}
+
+	for _, a := range r.accounts {
+		if a.Code == code {
+			return a, nil
+		}
+	}
+
+	return domain.Account{}, sql.ErrNoRows
+}
+
+func (r *repositoryMock) GetAccountEntries(_ context.Context, accountId int64, limit int) ([]domain.AccountEntry, error) {
+	entries := r.entries[accountId]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func (r *repositoryMock) Reconcile(_ context.Context) (domain.Reconciliation, error) {
+	if r.err != nil {
+		return domain.Reconciliation{}, r.err
+	}
+
+	return domain.Reconciliation{
+		UsersChecked: 1,
+		Mismatches:   r.mismatches,
+		Imbalance:    r.imbalance,
+		CheckedAt:    time.Now(),
+	}, nil
+}
+
+func newTestHandler(repository *repositoryMock) *Handler {
+	return NewHandler(NewService(logger, repository))
+}
+
+func TestMoveIsBalanced(t *testing.T) {
+	postings := Move(UserAccount(1), AccountCash, 50)
+
+	if len(postings) != 2 {
+		t.Fatalf("expected 2 postings, got %d", len(postings))
+	}
+
+	if postings[0].Account != "user:1" || postings[0].Amount != -50 {
+		t.Fatalf("expected user:1 to be debited by 50, got %+v", postings[0])
+	}
+
+	if postings[1].Account != AccountCash || postings[1].Amount != 50 {
+		t.Fatalf("expected %s to be credited by 50, got %+v", AccountCash, postings[1])
+	}
+}
+
+func TestPostRejectsUnbalancedEntry(t *testing.T) {
+	cases := map[string][]Posting{
+		"single posting": {{Account: AccountCash, Amount: 10}},
+		"non-zero sum":   {{Account: AccountCash, Amount: -10}, {Account: UserAccount(1), Amount: 20}},
+		"zero amount":    {{Account: AccountCash, Amount: 0}, {Account: UserAccount(1), Amount: 0}},
+	}
+
+	for name, postings := range cases {
+		// Validation happens before the database is touched
+		_, err := Post(context.Background(), nil, EntryDeposit, "test", postings)
+		if !errors.Is(err, UnbalancedEntryError) {
+			t.Fatalf("%s: expected unbalanced entry error, got %v", name, err)
+		}
+	}
+}
+
+func TestGetAccountsOk(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/accounts", nil)
+
+	handler.GetAccounts(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response []AccountResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response) != 4 {
+		t.Fatalf("expected 4 accounts, got %d", len(response))
+	}
+
+	var sum int64
+	for _, a := range response {
+		sum += a.Balance
+	}
+
+	if sum != 0 {
+		t.Fatalf("expected account balances to sum up to 0, got %d", sum)
+	}
+}
+
+func TestGetAccountsFilteredByType(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/accounts?type=user", nil)
+
+	handler.GetAccounts(rec, req)
+
+	var response []AccountResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response) != 1 || response[0].UserId == nil || *response[0].UserId != 1 {
+		t.Fatalf("expected only the wallet of user 1, got %+v", response)
+	}
+}
+
+func TestGetAccountsWithInvalidType(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/accounts?type=test", nil)
+
+	handler.GetAccounts(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestGetAccountEntriesOk(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/accounts/user:1/entries", nil)
+	req.SetPathValue("code", "user:1")
+
+	handler.GetAccountEntries(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response []AccountEntryResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response) != 2 || response[0].Amount != -50 {
+		t.Fatalf("expected 2 entries with the withdrawal first, got %+v", response)
+	}
+}
+
+func TestGetAccountEntriesForUnknownAccount(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/accounts/user:2/entries", nil)
+	req.SetPathValue("code", "user:2")
+
+	handler.GetAccountEntries(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestGetAccountEntriesWithInvalidLimit(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/accounts/user:1/entries?limit=0", nil)
+	req.SetPathValue("code", "user:1")
+
+	handler.GetAccountEntries(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestReconcileConsistent(t *testing.T) {
+	handler := newTestHandler(newRepositoryMock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/reconciliation", nil)
+
+	handler.Reconcile(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response ReconciliationResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if !response.Consistent || len(response.Mismatches) != 0 {
+		t.Fatalf("expected consistent ledger, got %+v", response)
+	}
+}
+
+func TestReconcileMismatch(t *testing.T) {
+	repository := newRepositoryMock()
+	repository.mismatches = []domain.Mismatch{{UserId: 1, Balance: 200, LedgerBalance: 150}}
+
+	handler := newTestHandler(repository)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/reconciliation", nil)
+
+	handler.Reconcile(rec, req)
+
+	var response ReconciliationResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Consistent {
+		t.Fatal("expected inconsistent ledger")
+	}
+
+	if len(response.Mismatches) != 1 || response.Mismatches[0].Difference != 50 {
+		t.Fatalf("expected a mismatch of 50 for user 1, got %+v", response.Mismatches)
+	}
+}
+
+func TestReconcileUnbalancedLedger(t *testing.T) {
+	repository := newRepositoryMock()
+	repository.imbalance = 10
+
+	handler := newTestHandler(repository)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/reconciliation", nil)
+
+	handler.Reconcile(rec, req)
+
+	var response ReconciliationResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Consistent || response.Imbalance != 10 {
+		t.Fatalf("expected unbalanced ledger, got %+v", response)
+	}
+}
+
+func TestReconcileErrorFromRepository(t *testing.T) {
+	repository := newRepositoryMock()
+	repository.err = errors.New("some error from repository")
+
+	handler := newTestHandler(repository)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ledger/reconciliation", nil)
+
+	handler.Reconcile(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package ledger
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type Reconciler struct {
+	service  *Service
+	logger   *logrus.Logger
+	interval time.Duration
+}
+
+func NewReconciler(service *Service, logger *logrus.Logger, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		service:  service,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run periodically checks that user balances match the ledger until ctx is done
+func (r *Reconciler) Run(ctx context.Context) {
+	r.logger.Infof("Starting ledger reconciler with interval %s", r.interval)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Ledger reconciler stopped")
+			return
+		case <-ticker.C:
+			r.check(ctx)
+		}
+	}
+}
+
+func (r *Reconciler) check(ctx context.Context) {
+	res, e := r.service.Reconcile(ctx)
+	if e != nil {
+		return
+	}
+
+	if res.Imbalance != 0 {
+		r.logger.Errorf("Ledger is not balanced: postings sum up to %d", res.Imbalance)
+	}
+
+	for _, m := range res.Mismatches {
+		r.logger.Errorf(
+			"User %d balance %d does not match ledger balance %d",
+			m.UserId, m.Balance, m.LedgerBalance,
+		)
+	}
+}
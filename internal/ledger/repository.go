@@ -0,0 +1,156 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/ledger/domain"
+	"time"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+func (r *Repository) GetAccounts(ctx context.Context, accountType string) ([]domain.Account, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, a.code, a.type, a.user_id, COALESCE(SUM(p.amount), 0), a.created_at
+		FROM ledger_accounts a
+		LEFT JOIN ledger_postings p ON p.account_id = a.id
+		WHERE $1::varchar = '' OR a.type = $1::varchar
+		GROUP BY a.id
+		ORDER BY a.id
+	`, accountType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []domain.Account
+
+	for rows.Next() {
+		var a domain.Account
+
+		err := rows.Scan(&a.Id, &a.Code, &a.Type, &a.UserId, &a.Balance, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (r *Repository) GetAccount(ctx context.Context, code string) (domain.Account, error) {
+	var a domain.Account
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT a.id, a.code, a.type, a.user_id, COALESCE(SUM(p.amount), 0), a.created_at
+		FROM ledger_accounts a
+		LEFT JOIN ledger_postings p ON p.account_id = a.id
+		WHERE a.code = $1
+		GROUP BY a.id
+	`, code).Scan(&a.Id, &a.Code, &a.Type, &a.UserId, &a.Balance, &a.CreatedAt)
+	if err != nil {
+		return domain.Account{}, err
+	}
+
+	return a, nil
+}
+
+func (r *Repository) GetAccountEntries(ctx context.Context, accountId int64, limit int) ([]domain.AccountEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.id, e.type, e.reference, p.amount, e.created_at
+		FROM ledger_postings p
+		JOIN ledger_entries e ON e.id = p.entry_id
+		WHERE p.account_id = $1
+		ORDER BY e.id DESC
+		LIMIT $2
+	`, accountId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []domain.AccountEntry
+
+	for rows.Next() {
+		var e domain.AccountEntry
+
+		err := rows.Scan(&e.Id, &e.Type, &e.Reference, &e.Amount, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Reconcile compares users.balance with the sum of postings on every user
+// account. It runs in a single snapshot, so concurrent balance changes never
+// show up as mismatches.
+func (r *Repository) Reconcile(ctx context.Context) (domain.Reconciliation, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return domain.Reconciliation{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res := domain.Reconciliation{CheckedAt: time.Now()}
+
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&res.UsersChecked)
+	if err != nil {
+		return domain.Reconciliation{}, err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM ledger_postings`).Scan(&res.Imbalance)
+	if err != nil {
+		return domain.Reconciliation{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT u.id, u.balance, COALESCE(SUM(p.amount), 0) AS ledger_balance
+		FROM users u
+		LEFT JOIN ledger_accounts a ON a.user_id = u.id
+		LEFT JOIN ledger_postings p ON p.account_id = a.id
+		GROUP BY u.id, u.balance
+		HAVING u.balance <> COALESCE(SUM(p.amount), 0)
+		ORDER BY u.id
+	`)
+	if err != nil {
+		return domain.Reconciliation{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m domain.Mismatch
+
+		if err := rows.Scan(&m.UserId, &m.Balance, &m.LedgerBalance); err != nil {
+			return domain.Reconciliation{}, err
+		}
+
+		res.Mismatches = append(res.Mismatches, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return domain.Reconciliation{}, err
+	}
+
+	return res, tx.Commit()
+}
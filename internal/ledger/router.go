@@ -0,0 +1,9 @@
+package ledger
+
+import "net/http"
+
+func RegisterRoutes(mux *http.ServeMux, h *Handler) {
+	mux.HandleFunc("GET /ledger/accounts", h.GetAccounts)
+	mux.HandleFunc("GET /ledger/accounts/{code}/entries", h.GetAccountEntries)
+	mux.HandleFunc("GET /ledger/reconciliation", h.Reconcile)
+}
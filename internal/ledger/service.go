@@ -0,0 +1,112 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/ledger/domain"
+	customError "github.com/bdzhalalov/kolikosoft-trade/pkg/error"
+	"github.com/sirupsen/logrus"
+)
+
+type RepositoryInterface interface {
+	GetAccounts(ctx context.Context, accountType string) ([]domain.Account, error)
+	GetAccount(ctx context.Context, code string) (domain.Account, error)
+	GetAccountEntries(ctx context.Context, accountId int64, limit int) ([]domain.AccountEntry, error)
+	Reconcile(ctx context.Context) (domain.Reconciliation, error)
+}
+
+type Service struct {
+	logger     *logrus.Logger
+	repository RepositoryInterface
+}
+
+func NewService(logger *logrus.Logger, repository RepositoryInterface) *Service {
+	return &Service{
+		logger,
+		repository,
+	}
+}
+
+func (s *Service) GetAccounts(ctx context.Context, accountType string) ([]AccountResponseDTO, *customError.BaseError) {
+	res, err := s.repository.GetAccounts(ctx, accountType)
+	if err != nil {
+		s.logger.Errorf("Error while getting ledger accounts: %s", err)
+		return []AccountResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	DTOs := make([]AccountResponseDTO, 0, len(res))
+	for _, a := range res {
+		DTOs = append(DTOs, s.getAccountDTO(a))
+	}
+
+	return DTOs, nil
+}
+
+func (s *Service) GetAccountEntries(ctx context.Context, code string, limit int) ([]AccountEntryResponseDTO, *customError.BaseError) {
+	account, err := s.repository.GetAccount(ctx, code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []AccountEntryResponseDTO{}, (&customError.NotFoundError{}).New("Account not found")
+		}
+
+		s.logger.Errorf("Error while getting ledger account: %s", err)
+		return []AccountEntryResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	res, err := s.repository.GetAccountEntries(ctx, account.Id, limit)
+	if err != nil {
+		s.logger.Errorf("Error while getting ledger entries: %s", err)
+		return []AccountEntryResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	DTOs := make([]AccountEntryResponseDTO, 0, len(res))
+	for _, e := range res {
+		DTOs = append(DTOs, AccountEntryResponseDTO{
+			Id:        e.Id,
+			Type:      e.Type,
+			Reference: e.Reference,
+			Amount:    e.Amount,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	return DTOs, nil
+}
+
+func (s *Service) Reconcile(ctx context.Context) (ReconciliationResponseDTO, *customError.BaseError) {
+	res, err := s.repository.Reconcile(ctx)
+	if err != nil {
+		s.logger.Errorf("Error while reconciling ledger: %s", err)
+		return ReconciliationResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	dto := ReconciliationResponseDTO{
+		Consistent:   len(res.Mismatches) == 0 && res.Imbalance == 0,
+		UsersChecked: res.UsersChecked,
+		Mismatches:   make([]MismatchResponseDTO, 0, len(res.Mismatches)),
+		Imbalance:    res.Imbalance,
+		CheckedAt:    res.CheckedAt,
+	}
+
+	for _, m := range res.Mismatches {
+		dto.Mismatches = append(dto.Mismatches, MismatchResponseDTO{
+			UserId:        m.UserId,
+			Balance:       m.Balance,
+			LedgerBalance: m.LedgerBalance,
+			Difference:    m.Balance - m.LedgerBalance,
+		})
+	}
+
+	return dto, nil
+}
+
+func (s *Service) getAccountDTO(a domain.Account) AccountResponseDTO {
+	return AccountResponseDTO{
+		Code:      a.Code,
+		Type:      a.Type,
+		UserId:    a.UserId,
+		Balance:   a.Balance,
+		CreatedAt: a.CreatedAt,
+	}
+}
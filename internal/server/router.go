@@ -1,18 +1,30 @@
 package server
 
 import (
+	"github.com/bdzhalalov/kolikosoft-trade/internal/alert"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/ledger"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/user"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook"
 	"net/http"
 )
 
-func Router(itemHandler *item.Handler, userHandler *user.Handler) http.Handler {
+func Router(
+	itemHandler *item.Handler,
+	userHandler *user.Handler,
+	alertHandler *alert.Handler,
+	webhookHandler *webhook.Handler,
+	ledgerHandler *ledger.Handler,
+) http.Handler {
 	rootRouter := http.NewServeMux()
 
 	apiRouter := http.NewServeMux()
 
 	item.RegisterRoutes(apiRouter, itemHandler)
 	user.RegisterRoutes(apiRouter, userHandler)
+	alert.RegisterRoutes(apiRouter, alertHandler)
+	webhook.RegisterRoutes(apiRouter, webhookHandler)
+	ledger.RegisterRoutes(apiRouter, ledgerHandler)
 
 	rootRouter.Handle("/api/v1/", http.StripPrefix("/api/v1", apiRouter))
 
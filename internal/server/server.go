@@ -1,40 +1,163 @@
 package server
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/alert"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/ledger"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/user"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/cache"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/config"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/database"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/logger"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 )
 
-func Start(ctx context.Context, config *config.Config) {
+// Start runs the API server and the workers until ctx is done. It returns an
+// error when the service can not be set up from config.
+func Start(ctx context.Context, config *config.Config) error {
 	log := logger.Logger(config)
 
-	db := database.ConnectToDB(ctx, config)
-
 	httpClient := &http.Client{}
 	c := cache.New()
 
-	skinPortClient := item.NewSkinPortClient(httpClient, config.SkinPortBaseURL)
-	itemService := item.NewService(skinPortClient, log, c)
+	clientOptions := item.DefaultClientOptions()
+	clientOptions.RequestTimeout = config.SkinPortTimeout
+	clientOptions.MaxRetries = config.SkinPortMaxRetries
+
+	// Every provider gets its own rate limit and circuit breaker, zero options
+	// of a provider fall back to the SkinPort settings
+	newProviderClient := func(p item.ProviderConfig) item.ExternalAPIClient {
+		options := clientOptions
+		options.Limiter = item.NewRateLimiter(
+			cmp.Or(p.RateLimit, config.SkinPortRateLimit),
+			cmp.Or(p.RateWindow, config.SkinPortRateWindow),
+		)
+
+		skinPortClient := item.NewSkinPortClient(httpClient, p.BaseURL, options)
+
+		return item.NewCircuitBreaker(skinPortClient, log, item.CircuitBreakerOptions{
+			FailureThreshold: config.SkinPortBreakerThreshold,
+			CoolDown:         config.SkinPortBreakerCoolDown,
+			HalfOpenRequests: cmp.Or(p.HalfOpenRequests, config.SkinPortBreakerHalfOpenRequests),
+		})
+	}
+
+	providerConfigs, err := item.ParseProviders(config.ItemsProviders)
+	if err != nil {
+		return fmt.Errorf("invalid ITEMS_PROVIDERS: %w", err)
+	}
+
+	providerConfigs = slices.Insert(providerConfigs, 0, item.ProviderConfig{
+		Name:    item.DefaultProviderName,
+		BaseURL: config.SkinPortBaseURL,
+	})
+
+	providers := item.NewProviderRegistry()
+	for _, p := range providerConfigs {
+		if err := providers.Register(p.Name, newProviderClient(p)); err != nil {
+			return fmt.Errorf("invalid ITEMS_PROVIDERS: %w", err)
+		}
+	}
+
+	db := database.ConnectToDB(ctx, config)
+
+	itemRepo := item.NewRepository(db)
+	itemService := item.NewService(providers, itemRepo, log, c, item.CacheOptions{
+		ItemsTTL:        config.ItemsCacheTTL,
+		ItemsStaleTTL:   config.ItemsStaleTTL,
+		SalesHistoryTTL: config.SalesHistoryCacheTTL,
+	})
 	itemHandler := item.NewHandler(itemService)
 
+	// Listeners talking to the database run in the background, off the refresh path
+	snapshotWriter := item.NewQueuedListener(
+		"items snapshot",
+		item.NewSnapshotWriter(itemRepo, log),
+		log,
+		item.DefaultQueuedListenerOptions(),
+	)
+	itemService.AddListener(snapshotWriter)
+
+	alertRepo := alert.NewRepository(db)
+	alertService := alert.NewService(log, alertRepo)
+	alertHandler := alert.NewHandler(alertService)
+	alertEvaluator := item.NewQueuedListener("price alerts", alertService, log, item.DefaultQueuedListenerOptions())
+	itemService.AddListener(alertEvaluator)
+
+	webhookRepo := webhook.NewRepository(db)
+	webhookService := webhook.NewService(log, webhookRepo)
+	webhookHandler := webhook.NewHandler(webhookService)
+	webhookPublisher := item.NewQueuedListener("catalog webhooks", webhookService, log, item.DefaultQueuedListenerOptions())
+	itemService.AddListener(webhookPublisher)
+
+	webhookOptions := webhook.DefaultWorkerOptions()
+	webhookOptions.PollInterval = config.WebhookPollInterval
+	webhookOptions.RequestTimeout = config.WebhookTimeout
+	webhookOptions.MaxAttempts = config.WebhookMaxAttempts
+
+	webhookWorker := webhook.NewWorker(webhookRepo, webhook.NewDeliveryClient(), log, webhookOptions)
+
+	catalogKeys, err := item.ParseCatalogKeys(config.ItemsRefreshCatalogs)
+	if err != nil {
+		log.WithError(err).Error("Invalid ITEMS_REFRESH_CATALOGS, using default catalog")
+		catalogKeys = []item.CatalogKey{{AppId: item.DefaultAppId, Currency: item.DefaultCurrency}}
+	}
+
+	refresher := item.NewRefresher(itemService, log, catalogKeys, config.ItemsRefreshInterval)
+
+	ledgerRepo := ledger.NewRepository(db)
+	ledgerService := ledger.NewService(log, ledgerRepo)
+	ledgerHandler := ledger.NewHandler(ledgerService)
+
+	reconciler := ledger.NewReconciler(ledgerService, log, config.LedgerReconcileInterval)
+
 	userRepo := user.NewRepository(db)
-	userService := user.NewService(log, userRepo)
+	userService := user.NewService(log, userRepo, config.BalanceHoldTTL)
 	userHandler := user.NewHandler(userService)
 
-	router := Router(itemHandler, userHandler)
+	holdSweeper := user.NewHoldSweeper(userService, log, config.BalanceHoldSweepInterval)
+
+	workersCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	workers.Go(func() {
+		refresher.Run(workersCtx)
+	})
+	workers.Go(func() {
+		snapshotWriter.Run(workersCtx)
+	})
+	workers.Go(func() {
+		alertEvaluator.Run(workersCtx)
+	})
+	workers.Go(func() {
+		webhookPublisher.Run(workersCtx)
+	})
+	workers.Go(func() {
+		webhookWorker.Run(workersCtx)
+	})
+	workers.Go(func() {
+		reconciler.Run(workersCtx)
+	})
+	workers.Go(func() {
+		holdSweeper.Run(workersCtx)
+	})
+
+	router := Router(itemHandler, userHandler, alertHandler, webhookHandler, ledgerHandler)
 
 	apiServer := &http.Server{
 		Addr:    config.Addr,
 		Handler: router,
 	}
+	apiServer.RegisterOnShutdown(itemService.CloseStreams)
 
 	errCh := make(chan error, 1)
 
@@ -57,7 +180,11 @@ func Start(ctx context.Context, config *config.Config) {
 	defer cancel()
 
 	_ = apiServer.Shutdown(shutdownCtx)
+	stopWorkers()
+	workers.Wait()
 	_ = db.Close()
 
 	log.Info("API server shutdown complete")
+
+	return nil
 }
@@ -0,0 +1,35 @@
+package user
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/user/domain"
+	"time"
+)
+
+var InvalidCursorError = errors.New("invalid cursor")
+
+// History cursors are opaque to clients: base64 of "<created_at unix micro>.<id>"
+func encodeHistoryCursor(c domain.HistoryCursor) string {
+	raw := fmt.Sprintf("%d.%d", c.CreatedAt.UnixMicro(), c.Id)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(cursor string) (domain.HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return domain.HistoryCursor{}, InvalidCursorError
+	}
+
+	var micro, id int64
+	if n, err := fmt.Sscanf(string(raw), "%d.%d", &micro, &id); err != nil || n != 2 || id <= 0 {
+		return domain.HistoryCursor{}, InvalidCursorError
+	}
+
+	return domain.HistoryCursor{
+		CreatedAt: time.UnixMicro(micro).UTC(),
+		Id:        id,
+	}, nil
+}
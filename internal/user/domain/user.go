@@ -3,14 +3,127 @@ package domain
 import "time"
 
 type User struct {
-	Id      int64
-	Balance int64
+	Id          int64
+	Balance     int64
+	HeldBalance int64
 }
 
 type Withdrawal struct {
+	Id            int64
 	UserId        int64
 	Amount        int64
 	BalanceBefore int64
 	BalanceAfter  int64
 	CreatedAt     time.Time
 }
+
+type Deposit struct {
+	Id            int64
+	UserId        int64
+	Amount        int64
+	BalanceBefore int64
+	BalanceAfter  int64
+	CreatedAt     time.Time
+}
+
+// Refund returns money of a past withdrawal, possibly in several parts
+type Refund struct {
+	Id            int64
+	UserId        int64
+	WithdrawalId  int64
+	Amount        int64
+	BalanceBefore int64
+	BalanceAfter  int64
+	CreatedAt     time.Time
+}
+
+type Transfer struct {
+	Id                int64
+	FromUserId        int64
+	ToUserId          int64
+	Amount            int64
+	FromBalanceBefore int64
+	FromBalanceAfter  int64
+	ToBalanceBefore   int64
+	ToBalanceAfter    int64
+	CreatedAt         time.Time
+}
+
+const (
+	TransactionTypeWithdrawal  = "withdrawal"
+	TransactionTypeDeposit     = "deposit"
+	TransactionTypeTransferOut = "transfer_out"
+	TransactionTypeTransferIn  = "transfer_in"
+	TransactionTypeRefund      = "refund"
+)
+
+type Transaction struct {
+	Id            int64
+	UserId        int64
+	Type          string
+	Amount        int64
+	BalanceBefore int64
+	BalanceAfter  int64
+	CreatedAt     time.Time
+	// CounterpartyUserId is the other side of a transfer
+	CounterpartyUserId *int64
+	// WithdrawalId is the withdrawal returned by a refund
+	WithdrawalId *int64
+}
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold reserves part of the user balance until it is captured, released or expired
+type Hold struct {
+	Id             int64
+	UserId         int64
+	Amount         int64
+	Status         string
+	CapturedAmount *int64
+	WithdrawalId   *int64
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+	UpdatedAt      *time.Time
+	// FinishRequestId is the Idempotency-Key of the capture or release that finished the hold
+	FinishRequestId *string
+}
+
+// HistoryCursor points at the last transaction of a history page
+type HistoryCursor struct {
+	CreatedAt time.Time
+	Id        int64
+}
+
+type HistoryFilter struct {
+	From      *time.Time
+	To        *time.Time
+	MinAmount *int64
+	MaxAmount *int64
+	After     *HistoryCursor
+	Limit     int
+}
+
+// WithdrawalLimits are limits of one scope, the global one when UserId is nil.
+// Nil fields are not limited.
+type WithdrawalLimits struct {
+	UserId        *int64
+	MaxAmount     *int64
+	DailyAmount   *int64
+	MonthlyAmount *int64
+	MaxCount      *int64
+	CountWindow   *time.Duration
+}
+
+// WithdrawalUsage is what the user has withdrawn within the limit windows
+type WithdrawalUsage struct {
+	DailyAmount   int64
+	MonthlyAmount int64
+	// Counts are numbers of withdrawals within the count window of each scope
+	GlobalCount int64
+	UserCount   int64
+}
@@ -13,6 +13,7 @@ type WithdrawRequestBody struct {
 }
 
 type WithdrawBalanceResponseDTO struct {
+	Id            int64     `json:"id"`
 	UserId        int64     `json:"user_id"`
 	Amount        int64     `json:"amount"`
 	BalanceBefore int64     `json:"balance_before"`
@@ -20,10 +21,167 @@ type WithdrawBalanceResponseDTO struct {
 	CreatedAt     time.Time `json:"created_at"`
 }
 
-type BalanceHistoryResponseDTO struct {
+type DepositBalanceRequestDTO struct {
+	UserId    int64
+	Amount    int64
+	RequestId string
+}
+
+type DepositRequestBody struct {
+	Amount int64 `json:"amount"`
+}
+
+type DepositBalanceResponseDTO struct {
+	Id            int64     `json:"id"`
+	UserId        int64     `json:"user_id"`
+	Amount        int64     `json:"amount"`
+	BalanceBefore int64     `json:"balance_before"`
+	BalanceAfter  int64     `json:"balance_after"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type RefundWithdrawalRequestDTO struct {
+	UserId       int64
+	WithdrawalId int64
+	Amount       int64
+	RequestId    string
+}
+
+type RefundRequestBody struct {
+	Amount int64 `json:"amount"`
+}
+
+type RefundResponseDTO struct {
+	Id            int64     `json:"id"`
+	UserId        int64     `json:"user_id"`
+	WithdrawalId  int64     `json:"withdrawal_id"`
+	Amount        int64     `json:"amount"`
+	BalanceBefore int64     `json:"balance_before"`
+	BalanceAfter  int64     `json:"balance_after"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type TransferBalanceRequestDTO struct {
+	UserId    int64
+	ToUserId  int64
+	Amount    int64
+	RequestId string
+}
+
+type TransferRequestBody struct {
+	ToUserId int64 `json:"to_user_id"`
+	Amount   int64 `json:"amount"`
+}
+
+type TransferBalanceResponseDTO struct {
+	Id            int64     `json:"id"`
 	UserId        int64     `json:"user_id"`
+	ToUserId      int64     `json:"to_user_id"`
 	Amount        int64     `json:"amount"`
 	BalanceBefore int64     `json:"balance_before"`
 	BalanceAfter  int64     `json:"balance_after"`
 	CreatedAt     time.Time `json:"created_at"`
 }
+
+type BalanceHistoryQueryDTO struct {
+	UserId    int64
+	From      *time.Time
+	To        *time.Time
+	MinAmount *int64
+	MaxAmount *int64
+	Cursor    string
+	Limit     int
+}
+
+type BalanceHistoryPageResponseDTO struct {
+	Items      []BalanceHistoryResponseDTO `json:"items"`
+	Limit      int                         `json:"limit"`
+	NextCursor *string                     `json:"next_cursor"`
+}
+
+type BalanceHistoryResponseDTO struct {
+	Id                 int64     `json:"id"`
+	UserId             int64     `json:"user_id"`
+	Type               string    `json:"type"`
+	Amount             int64     `json:"amount"`
+	BalanceBefore      int64     `json:"balance_before"`
+	BalanceAfter       int64     `json:"balance_after"`
+	CreatedAt          time.Time `json:"created_at"`
+	CounterpartyUserId *int64    `json:"counterparty_user_id,omitempty"`
+	WithdrawalId       *int64    `json:"withdrawal_id,omitempty"`
+}
+
+type BalanceResponseDTO struct {
+	UserId    int64 `json:"user_id"`
+	Balance   int64 `json:"balance"`
+	Held      int64 `json:"held"`
+	Available int64 `json:"available"`
+}
+
+type CreateHoldRequestDTO struct {
+	UserId    int64
+	Amount    int64
+	TTL       time.Duration
+	RequestId string
+}
+
+type CreateHoldRequestBody struct {
+	Amount     int64 `json:"amount"`
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+type CaptureHoldRequestDTO struct {
+	UserId    int64
+	HoldId    int64
+	Amount    int64
+	RequestId string
+}
+
+type CaptureHoldRequestBody struct {
+	Amount int64 `json:"amount"`
+}
+
+type ReleaseHoldRequestDTO struct {
+	UserId    int64
+	HoldId    int64
+	RequestId string
+}
+
+type HoldResponseDTO struct {
+	Id             int64      `json:"id"`
+	UserId         int64      `json:"user_id"`
+	Amount         int64      `json:"amount"`
+	Status         string     `json:"status"`
+	CapturedAmount *int64     `json:"captured_amount"`
+	WithdrawalId   *int64     `json:"withdrawal_id"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+}
+
+type SetWithdrawalLimitsRequestDTO struct {
+	UserId             *int64
+	MaxAmount          *int64
+	DailyAmount        *int64
+	MonthlyAmount      *int64
+	MaxCount           *int64
+	CountWindowSeconds *int64
+}
+
+// WithdrawalLimitsRequestBody replaces all limits of the scope, null removes a limit
+type WithdrawalLimitsRequestBody struct {
+	MaxAmount          *int64 `json:"max_amount"`
+	DailyAmount        *int64 `json:"daily_amount"`
+	MonthlyAmount      *int64 `json:"monthly_amount"`
+	MaxCount           *int64 `json:"max_count"`
+	CountWindowSeconds *int64 `json:"count_window_seconds"`
+}
+
+type WithdrawalLimitsResponseDTO struct {
+	UserId             *int64 `json:"user_id"`
+	MaxAmount          *int64 `json:"max_amount"`
+	DailyAmount        *int64 `json:"daily_amount"`
+	MonthlyAmount      *int64 `json:"monthly_amount"`
+	MaxCount           *int64 `json:"max_count"`
+	CountWindowSeconds *int64 `json:"count_window_seconds"`
+}
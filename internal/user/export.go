@@ -0,0 +1,155 @@
+package user
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatNDJSON: "application/x-ndjson",
+}
+
+var csvHistoryHeader = []string{
+	"id",
+	"user_id",
+	"type",
+	"amount",
+	"balance_before",
+	"balance_after",
+	"counterparty_user_id",
+	"withdrawal_id",
+	"created_at",
+}
+
+// BalanceHistoryWriter receives exported history entries one by one
+type BalanceHistoryWriter interface {
+	Begin() error
+	Write(entry BalanceHistoryResponseDTO) error
+	End() error
+}
+
+// negotiateExportFormat picks the export format from the format query param
+// or the Accept header, CSV is used when the client accepts anything.
+func negotiateExportFormat(format string, accept string) (string, bool) {
+	if format != "" {
+		_, ok := exportContentTypes[format]
+		return format, ok
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return ExportFormatCSV, true
+	}
+
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+
+		var candidate string
+		switch mediaType {
+		case "text/csv", "text/*", "*/*":
+			candidate = ExportFormatCSV
+		case "application/x-ndjson", "application/ndjson":
+			candidate = ExportFormatNDJSON
+		default:
+			continue
+		}
+
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+
+	return best, best != ""
+}
+
+type historyExport struct {
+	w        http.ResponseWriter
+	format   string
+	filename string
+	started  bool
+	csv      *csv.Writer
+	json     *json.Encoder
+}
+
+func newHistoryExport(w http.ResponseWriter, format string, userId int64) *historyExport {
+	return &historyExport{
+		w:        w,
+		format:   format,
+		filename: fmt.Sprintf("balance_history_%d_%s.%s", userId, time.Now().UTC().Format("20060102"), format),
+	}
+}
+
+func (e *historyExport) Begin() error {
+	e.w.Header().Set("Content-Type", exportContentTypes[e.format])
+	e.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.filename}))
+	e.w.Header().Set("Cache-Control", "no-store")
+	e.w.Header().Set("X-Content-Type-Options", "nosniff")
+	e.w.WriteHeader(http.StatusOK)
+	e.started = true
+
+	if e.format == ExportFormatNDJSON {
+		e.json = json.NewEncoder(e.w)
+		return nil
+	}
+
+	e.csv = csv.NewWriter(e.w)
+
+	return e.csv.Write(csvHistoryHeader)
+}
+
+func (e *historyExport) Write(entry BalanceHistoryResponseDTO) error {
+	if e.format == ExportFormatNDJSON {
+		return e.json.Encode(entry)
+	}
+
+	return e.csv.Write([]string{
+		strconv.FormatInt(entry.Id, 10),
+		strconv.FormatInt(entry.UserId, 10),
+		entry.Type,
+		strconv.FormatInt(entry.Amount, 10),
+		strconv.FormatInt(entry.BalanceBefore, 10),
+		strconv.FormatInt(entry.BalanceAfter, 10),
+		formatOptionalId(entry.CounterpartyUserId),
+		formatOptionalId(entry.WithdrawalId),
+		entry.CreatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *historyExport) End() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+
+	return nil
+}
+
+func formatOptionalId(id *int64) string {
+	if id == nil {
+		return ""
+	}
+
+	return strconv.FormatInt(*id, 10)
+}
@@ -5,12 +5,27 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/render"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
 
+const (
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 1000
+
+	HistoryExportTimeout = 5 * time.Minute
+
+	// MaxWithdrawalCountWindowSeconds is one year
+	MaxWithdrawalCountWindowSeconds = 366 * 24 * 60 * 60
+)
+
 type Handler struct {
 	service *Service
 }
@@ -70,6 +85,163 @@ func (h *Handler) Withdraw(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, res, http.StatusOK)
 }
 
+func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	idStr := r.PathValue("id")
+	userId, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var body DepositRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.Amount <= 0 {
+		render.JSON(w, "invalid amount: Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	requestId := r.Header.Get("Idempotency-Key")
+	if requestId == "" {
+		requestId, err = h.newRequestID()
+		if err != nil {
+			http.Error(w, "failed to generate request id", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Idempotency-Key", requestId)
+	}
+
+	dto := DepositBalanceRequestDTO{
+		UserId:    userId,
+		Amount:    body.Amount,
+		RequestId: requestId,
+	}
+
+	res, e := h.service.DepositToBalance(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) RefundWithdrawal(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	withdrawalId, err := strconv.ParseInt(r.PathValue("withdrawal_id"), 10, 64)
+	if err != nil || withdrawalId <= 0 {
+		render.JSON(w, "invalid withdrawal id", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional, the whole refundable amount is refunded by default
+	var body RefundRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.Amount < 0 {
+		render.JSON(w, "invalid amount: Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	requestId := r.Header.Get("Idempotency-Key")
+	if requestId == "" {
+		requestId, err = h.newRequestID()
+		if err != nil {
+			http.Error(w, "failed to generate request id", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Idempotency-Key", requestId)
+	}
+
+	dto := RefundWithdrawalRequestDTO{
+		UserId:       userId,
+		WithdrawalId: withdrawalId,
+		Amount:       body.Amount,
+		RequestId:    requestId,
+	}
+
+	res, e := h.service.RefundWithdrawal(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	idStr := r.PathValue("id")
+	userId, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var body TransferRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.ToUserId <= 0 || body.ToUserId == userId {
+		render.JSON(w, "invalid recipient: to_user_id must be another user", http.StatusBadRequest)
+		return
+	}
+
+	if body.Amount <= 0 {
+		render.JSON(w, "invalid amount: Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	requestId := r.Header.Get("Idempotency-Key")
+	if requestId == "" {
+		requestId, err = h.newRequestID()
+		if err != nil {
+			http.Error(w, "failed to generate request id", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Idempotency-Key", requestId)
+	}
+
+	dto := TransferBalanceRequestDTO{
+		UserId:    userId,
+		ToUserId:  body.ToUserId,
+		Amount:    body.Amount,
+		RequestId: requestId,
+	}
+
+	res, e := h.service.TransferBalance(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
 func (h *Handler) GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
@@ -81,7 +253,14 @@ func (h *Handler) GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, e := h.service.GetBalanceHistory(ctx, userId)
+	query, err := h.parseBalanceHistoryQuery(r.URL.Query())
+	if err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.UserId = userId
+
+	res, e := h.service.GetBalanceHistory(ctx, query)
 	if e != nil {
 		render.JSON(w, e.Message, e.Code)
 		return
@@ -90,6 +269,301 @@ func (h *Handler) GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, res, http.StatusOK)
 }
 
+func (h *Handler) parseBalanceHistoryQuery(values url.Values) (BalanceHistoryQueryDTO, error) {
+	query := BalanceHistoryQueryDTO{
+		Cursor: values.Get("cursor"),
+		Limit:  DefaultHistoryLimit,
+	}
+
+	if err := h.parseHistoryPeriod(values, &query); err != nil {
+		return BalanceHistoryQueryDTO{}, err
+	}
+
+	if raw := values.Get("min_amount"); raw != "" {
+		minAmount, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || minAmount < 0 {
+			return BalanceHistoryQueryDTO{}, errors.New("invalid min_amount: must be a non-negative integer")
+		}
+		query.MinAmount = &minAmount
+	}
+
+	if raw := values.Get("max_amount"); raw != "" {
+		maxAmount, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxAmount < 0 {
+			return BalanceHistoryQueryDTO{}, errors.New("invalid max_amount: must be a non-negative integer")
+		}
+		query.MaxAmount = &maxAmount
+	}
+
+	if query.MinAmount != nil && query.MaxAmount != nil && *query.MinAmount > *query.MaxAmount {
+		return BalanceHistoryQueryDTO{}, errors.New("invalid amount range: min_amount must not be greater than max_amount")
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > MaxHistoryLimit {
+			return BalanceHistoryQueryDTO{}, fmt.Errorf("invalid limit: must be between 1 and %d", MaxHistoryLimit)
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+func (h *Handler) parseHistoryPeriod(values url.Values, query *BalanceHistoryQueryDTO) error {
+	if raw := values.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return errors.New("invalid from: must be a RFC 3339 date")
+		}
+		query.From = &from
+	}
+
+	if raw := values.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return errors.New("invalid to: must be a RFC 3339 date")
+		}
+		query.To = &to
+	}
+
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return errors.New("invalid period: from must be before to")
+	}
+
+	return nil
+}
+
+func (h *Handler) ExportBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), HistoryExportTimeout)
+	defer cancel()
+
+	idStr := r.PathValue("id")
+	userId, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	format, ok := negotiateExportFormat(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+	if !ok {
+		render.JSON(w, "unsupported export format: use text/csv or application/x-ndjson", http.StatusNotAcceptable)
+		return
+	}
+
+	query := BalanceHistoryQueryDTO{UserId: userId}
+	if err := h.parseHistoryPeriod(r.URL.Query(), &query); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	export := newHistoryExport(w, format, userId)
+
+	if e := h.service.ExportBalanceHistory(ctx, query, export); e != nil {
+		if export.started {
+			// The status is already sent, aborting the connection tells the
+			// client the file is incomplete instead of ending it silently
+			panic(http.ErrAbortHandler)
+		}
+
+		render.JSON(w, e.Message, e.Code)
+	}
+}
+
+func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	idStr := r.PathValue("id")
+	userId, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	res, e := h.service.GetBalance(ctx, userId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) CreateHold(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	idStr := r.PathValue("id")
+	userId, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var body CreateHoldRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.Amount <= 0 {
+		render.JSON(w, "invalid amount: Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	ttl := time.Duration(body.TTLSeconds) * time.Second
+	if body.TTLSeconds < 0 || ttl > MaxHoldTTL {
+		render.JSON(w, fmt.Sprintf("invalid ttl_seconds: must be between 1 and %d", int64(MaxHoldTTL.Seconds())), http.StatusBadRequest)
+		return
+	}
+
+	requestId := r.Header.Get("Idempotency-Key")
+	if requestId == "" {
+		requestId, err = h.newRequestID()
+		if err != nil {
+			http.Error(w, "failed to generate request id", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Idempotency-Key", requestId)
+	}
+
+	dto := CreateHoldRequestDTO{
+		UserId:    userId,
+		Amount:    body.Amount,
+		TTL:       ttl,
+		RequestId: requestId,
+	}
+
+	res, e := h.service.CreateHold(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) GetHold(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, holdId, ok := h.parseHoldPath(w, r)
+	if !ok {
+		return
+	}
+
+	res, e := h.service.GetHold(ctx, userId, holdId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) CaptureHold(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, holdId, ok := h.parseHoldPath(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional, the whole hold is captured by default
+	var body CaptureHoldRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.Amount < 0 {
+		render.JSON(w, "invalid amount: Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	requestId := r.Header.Get("Idempotency-Key")
+	if requestId == "" {
+		var err error
+		requestId, err = h.newRequestID()
+		if err != nil {
+			http.Error(w, "failed to generate request id", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Idempotency-Key", requestId)
+	}
+
+	dto := CaptureHoldRequestDTO{
+		UserId:    userId,
+		HoldId:    holdId,
+		Amount:    body.Amount,
+		RequestId: requestId,
+	}
+
+	res, e := h.service.CaptureHold(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userId, holdId, ok := h.parseHoldPath(w, r)
+	if !ok {
+		return
+	}
+
+	requestId := r.Header.Get("Idempotency-Key")
+	if requestId == "" {
+		var err error
+		requestId, err = h.newRequestID()
+		if err != nil {
+			http.Error(w, "failed to generate request id", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Idempotency-Key", requestId)
+	}
+
+	dto := ReleaseHoldRequestDTO{
+		UserId:    userId,
+		HoldId:    holdId,
+		RequestId: requestId,
+	}
+
+	res, e := h.service.ReleaseHold(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) parseHoldPath(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	holdId, err := strconv.ParseInt(r.PathValue("hold_id"), 10, 64)
+	if err != nil || holdId <= 0 {
+		render.JSON(w, "invalid hold id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return userId, holdId, true
+}
+
 func (h *Handler) newRequestID() (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -98,3 +572,107 @@ func (h *Handler) newRequestID() (string, error) {
 
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
+
+func (h *Handler) GetGlobalWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	h.getWithdrawalLimits(w, r, nil)
+}
+
+func (h *Handler) SetGlobalWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	h.setWithdrawalLimits(w, r, nil)
+}
+
+func (h *Handler) GetUserWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	h.getWithdrawalLimits(w, r, &userId)
+}
+
+func (h *Handler) SetUserWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || userId <= 0 {
+		render.JSON(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	h.setWithdrawalLimits(w, r, &userId)
+}
+
+func (h *Handler) getWithdrawalLimits(w http.ResponseWriter, r *http.Request, userId *int64) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, e := h.service.GetWithdrawalLimits(ctx, userId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) setWithdrawalLimits(w http.ResponseWriter, r *http.Request, userId *int64) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var body WithdrawalLimitsRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *int64
+	}{
+		{"max_amount", body.MaxAmount},
+		{"daily_amount", body.DailyAmount},
+		{"monthly_amount", body.MonthlyAmount},
+		{"max_count", body.MaxCount},
+		{"count_window_seconds", body.CountWindowSeconds},
+	} {
+		if field.value != nil && *field.value <= 0 {
+			render.JSON(w, fmt.Sprintf("invalid %s: must be greater than 0 or null", field.name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if body.MaxCount != nil && *body.MaxCount > math.MaxInt32 {
+		render.JSON(w, fmt.Sprintf("invalid max_count: must not be greater than %d", math.MaxInt32), http.StatusBadRequest)
+		return
+	}
+
+	if body.CountWindowSeconds != nil && *body.CountWindowSeconds > MaxWithdrawalCountWindowSeconds {
+		render.JSON(
+			w,
+			fmt.Sprintf("invalid count_window_seconds: must not be greater than %d", MaxWithdrawalCountWindowSeconds),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if (body.MaxCount == nil) != (body.CountWindowSeconds == nil) {
+		render.JSON(w, "invalid count limit: max_count and count_window_seconds must be set together", http.StatusBadRequest)
+		return
+	}
+
+	dto := SetWithdrawalLimitsRequestDTO{
+		UserId:             userId,
+		MaxAmount:          body.MaxAmount,
+		DailyAmount:        body.DailyAmount,
+		MonthlyAmount:      body.MonthlyAmount,
+		MaxCount:           body.MaxCount,
+		CountWindowSeconds: body.CountWindowSeconds,
+	}
+
+	res, e := h.service.SetWithdrawalLimits(ctx, dto)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/user/domain"
+)
+
+const (
+	WithdrawalLimitScopeGlobal = "global"
+	WithdrawalLimitScopeUser   = "user"
+)
+
+// WithdrawalLimitError names the limit a withdrawal would exceed
+type WithdrawalLimitError struct {
+	Limit   string
+	Scope   string
+	Message string
+}
+
+func (e *WithdrawalLimitError) Error() string {
+	return fmt.Sprintf("withdrawal limit exceeded: %s (%s) %s", e.Limit, e.Scope, e.Message)
+}
+
+var withdrawalLimitNames = []string{"max_amount", "daily_amount", "monthly_amount", "max_count"}
+
+type scopedWithdrawalLimits struct {
+	scope  string
+	limits domain.WithdrawalLimits
+	// count is the number of withdrawals within the count window of the scope
+	count int64
+}
+
+// checkWithdrawalLimits enforces the global and the user limits together, so a
+// user limit can only tighten the global one. When both scopes are exceeded the
+// stricter limit is reported.
+func checkWithdrawalLimits(
+	global domain.WithdrawalLimits,
+	user domain.WithdrawalLimits,
+	amount int64,
+	usage domain.WithdrawalUsage,
+) error {
+	scopes := []scopedWithdrawalLimits{
+		{scope: WithdrawalLimitScopeGlobal, limits: global, count: usage.GlobalCount},
+		{scope: WithdrawalLimitScopeUser, limits: user, count: usage.UserCount},
+	}
+
+	for _, name := range withdrawalLimitNames {
+		var exceeded *WithdrawalLimitError
+		var strictest int64
+
+		for _, s := range scopes {
+			value, message, ok := s.exceeded(name, amount, usage)
+			if ok && (exceeded == nil || value < strictest) {
+				exceeded = &WithdrawalLimitError{Limit: name, Scope: s.scope, Message: message}
+				strictest = value
+			}
+		}
+
+		if exceeded != nil {
+			return exceeded
+		}
+	}
+
+	return nil
+}
+
+// needsWithdrawalUsage tells whether any limit depends on past withdrawals
+func needsWithdrawalUsage(limits ...domain.WithdrawalLimits) bool {
+	for _, l := range limits {
+		if l.DailyAmount != nil || l.MonthlyAmount != nil || l.MaxCount != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exceeded returns the value of the named limit and why it is exceeded, if it is
+func (s scopedWithdrawalLimits) exceeded(name string, amount int64, usage domain.WithdrawalUsage) (int64, string, bool) {
+	l := s.limits
+
+	switch name {
+	case "max_amount":
+		if l.MaxAmount != nil && amount > *l.MaxAmount {
+			return *l.MaxAmount, fmt.Sprintf("allows at most %d per withdrawal", *l.MaxAmount), true
+		}
+	case "daily_amount":
+		if l.DailyAmount != nil && usage.DailyAmount+amount > *l.DailyAmount {
+			message := fmt.Sprintf("allows %d per 24 hours, %d already withdrawn", *l.DailyAmount, usage.DailyAmount)
+			return *l.DailyAmount, message, true
+		}
+	case "monthly_amount":
+		if l.MonthlyAmount != nil && usage.MonthlyAmount+amount > *l.MonthlyAmount {
+			message := fmt.Sprintf("allows %d per month, %d already withdrawn", *l.MonthlyAmount, usage.MonthlyAmount)
+			return *l.MonthlyAmount, message, true
+		}
+	case "max_count":
+		if l.MaxCount != nil && l.CountWindow != nil && s.count >= *l.MaxCount {
+			return *l.MaxCount, fmt.Sprintf("allows %d withdrawals per %s", *l.MaxCount, *l.CountWindow), true
+		}
+	}
+
+	return 0, "", false
+}
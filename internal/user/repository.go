@@ -4,7 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/ledger"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/user/domain"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook"
+	"strconv"
+	"time"
 )
 
 type Repository struct {
@@ -17,13 +21,22 @@ func NewRepository(db *sql.DB) *Repository {
 	}
 }
 
-var InsufficientFundsError = errors.New("insufficient funds")
+var (
+	InsufficientFundsError  = errors.New("insufficient funds")
+	HoldNotFoundError       = errors.New("hold not found")
+	HoldNotActiveError      = errors.New("hold is not active")
+	CaptureAmountError      = errors.New("capture amount exceeds hold amount")
+	WithdrawalNotFoundError = errors.New("withdrawal not found")
+	RefundAmountError       = errors.New("refund amount exceeds the refundable amount of the withdrawal")
+	AlreadyRefundedError    = errors.New("withdrawal is already refunded")
+	RefundRequestIdError    = errors.New("idempotency key is already used for a refund of another withdrawal")
+)
 
 func (r *Repository) GetUserById(ctx context.Context, userId int64) (domain.User, error) {
-	const query = `SELECT id, balance FROM users WHERE id = $1`
+	const query = `SELECT id, balance, held_balance FROM users WHERE id = $1`
 
 	var u domain.User
-	err := r.db.QueryRowContext(ctx, query, userId).Scan(&u.Id, &u.Balance)
+	err := r.db.QueryRowContext(ctx, query, userId).Scan(&u.Id, &u.Balance, &u.HeldBalance)
 	if err != nil {
 		return domain.User{}, err
 	}
@@ -45,12 +58,12 @@ func (r *Repository) WithdrawFromUserBalance(
 
 	var w domain.Withdrawal
 	row := tx.QueryRowContext(ctx, `
-		SELECT user_id, amount, balance_before, balance_after, created_at
+		SELECT id, user_id, amount, balance_before, balance_after, created_at
 		FROM balance_withdrawals
 		WHERE user_id = $1 AND request_id = $2
 	`, userId, requestId)
 
-	switch err := row.Scan(&w.UserId, &w.Amount, &w.BalanceBefore, &w.BalanceAfter, &w.CreatedAt); {
+	switch err := row.Scan(&w.Id, &w.UserId, &w.Amount, &w.BalanceBefore, &w.BalanceAfter, &w.CreatedAt); {
 	case err == nil:
 		if err := tx.Commit(); err != nil {
 			return domain.Withdrawal{}, err
@@ -65,7 +78,7 @@ func (r *Repository) WithdrawFromUserBalance(
 	err = tx.QueryRowContext(ctx, `
 		UPDATE users
 		SET balance = balance - $2
-		WHERE id = $1 AND balance >= $2
+		WHERE id = $1 AND balance - held_balance >= $2
 		RETURNING balance
 	`, userId, amount).Scan(&balanceAfter)
 
@@ -76,14 +89,21 @@ func (r *Repository) WithdrawFromUserBalance(
 		return domain.Withdrawal{}, err
 	}
 
+	// The update locks the user row, so concurrent withdrawals of the user
+	// wait here and the usage below already includes them
+	if err := r.checkWithdrawalLimits(ctx, tx, userId, amount); err != nil {
+		return domain.Withdrawal{}, err
+	}
+
 	balanceBefore := balanceAfter + amount
 
 	var res domain.Withdrawal
 	err = tx.QueryRowContext(ctx, `
 		INSERT INTO balance_withdrawals(user_id, request_id, amount, balance_before, balance_after)
 		VALUES ($1, $2, $3, $4, $5)
-		RETURNING user_id, amount, balance_before, balance_after, created_at
+		RETURNING id, user_id, amount, balance_before, balance_after, created_at
 	`, userId, requestId, amount, balanceBefore, balanceAfter).Scan(
+		&res.Id,
 		&res.UserId,
 		&res.Amount,
 		&res.BalanceBefore,
@@ -94,6 +114,23 @@ func (r *Repository) WithdrawFromUserBalance(
 		return domain.Withdrawal{}, err
 	}
 
+	reference := "balance_withdrawals:" + strconv.FormatInt(res.Id, 10)
+	_, err = ledger.Post(ctx, tx, ledger.EntryWithdrawal, reference, ledger.Move(ledger.UserAccount(userId), ledger.AccountCash, amount))
+	if err != nil {
+		return domain.Withdrawal{}, err
+	}
+
+	err = webhook.Enqueue(ctx, tx, webhook.EventBalanceWithdrawn, webhook.BalanceEventData{
+		UserId:        res.UserId,
+		Amount:        res.Amount,
+		BalanceBefore: res.BalanceBefore,
+		BalanceAfter:  res.BalanceAfter,
+		CreatedAt:     res.CreatedAt,
+	})
+	if err != nil {
+		return domain.Withdrawal{}, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return domain.Withdrawal{}, err
 	}
@@ -101,37 +138,742 @@ func (r *Repository) WithdrawFromUserBalance(
 	return res, nil
 }
 
-func (r *Repository) GetUserBalanceHistory(ctx context.Context, userId int64) ([]domain.Withdrawal, error) {
-	const query = `
-		SELECT user_id, amount, balance_before, balance_after, created_at
+func (r *Repository) DepositToUserBalance(
+	ctx context.Context,
+	userId int64,
+	amount int64,
+	requestId string,
+) (domain.Deposit, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return domain.Deposit{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var d domain.Deposit
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, amount, balance_before, balance_after, created_at
+		FROM balance_deposits
+		WHERE user_id = $1 AND request_id = $2
+	`, userId, requestId)
+
+	switch err := row.Scan(&d.Id, &d.UserId, &d.Amount, &d.BalanceBefore, &d.BalanceAfter, &d.CreatedAt); {
+	case err == nil:
+		if err := tx.Commit(); err != nil {
+			return domain.Deposit{}, err
+		}
+		return d, nil
+	case errors.Is(err, sql.ErrNoRows):
+	default:
+		return domain.Deposit{}, err
+	}
+
+	var balanceAfter int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET balance = balance + $2
+		WHERE id = $1
+		RETURNING balance
+	`, userId, amount).Scan(&balanceAfter)
+	if err != nil {
+		return domain.Deposit{}, err
+	}
+
+	balanceBefore := balanceAfter - amount
+
+	var res domain.Deposit
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO balance_deposits(user_id, request_id, amount, balance_before, balance_after)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, amount, balance_before, balance_after, created_at
+	`, userId, requestId, amount, balanceBefore, balanceAfter).Scan(
+		&res.Id,
+		&res.UserId,
+		&res.Amount,
+		&res.BalanceBefore,
+		&res.BalanceAfter,
+		&res.CreatedAt,
+	)
+	if err != nil {
+		return domain.Deposit{}, err
+	}
+
+	reference := "balance_deposits:" + strconv.FormatInt(res.Id, 10)
+	_, err = ledger.Post(ctx, tx, ledger.EntryDeposit, reference, ledger.Move(ledger.AccountCash, ledger.UserAccount(userId), amount))
+	if err != nil {
+		return domain.Deposit{}, err
+	}
+
+	err = webhook.Enqueue(ctx, tx, webhook.EventBalanceDeposited, webhook.BalanceEventData{
+		UserId:        res.UserId,
+		Amount:        res.Amount,
+		BalanceBefore: res.BalanceBefore,
+		BalanceAfter:  res.BalanceAfter,
+		CreatedAt:     res.CreatedAt,
+	})
+	if err != nil {
+		return domain.Deposit{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Deposit{}, err
+	}
+
+	return res, nil
+}
+
+// RefundWithdrawal returns amount of the withdrawal to the user balance, the
+// whole refundable rest when amount is 0. The withdrawal row is locked, so
+// concurrent refunds can not exceed the withdrawn amount.
+func (r *Repository) RefundWithdrawal(
+	ctx context.Context,
+	userId int64,
+	withdrawalId int64,
+	amount int64,
+	requestId string,
+) (domain.Refund, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return domain.Refund{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var withdrawn, refunded int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT amount, refunded_amount
 		FROM balance_withdrawals
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-	`
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, withdrawalId, userId).Scan(&withdrawn, &refunded)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Refund{}, WithdrawalNotFoundError
+		}
+		return domain.Refund{}, err
+	}
+
+	var res domain.Refund
+	row := tx.QueryRowContext(ctx, `
+		SELECT `+refundColumns+`
+		FROM balance_refunds
+		WHERE user_id = $1 AND request_id = $2
+	`, userId, requestId)
+
+	switch err := scanRefund(row, &res); {
+	case err == nil:
+		if res.WithdrawalId != withdrawalId {
+			return domain.Refund{}, RefundRequestIdError
+		}
+
+		if err := tx.Commit(); err != nil {
+			return domain.Refund{}, err
+		}
+		return res, nil
+	case errors.Is(err, sql.ErrNoRows):
+	default:
+		return domain.Refund{}, err
+	}
+
+	if refunded == withdrawn {
+		return domain.Refund{}, AlreadyRefundedError
+	}
+
+	if amount == 0 {
+		amount = withdrawn - refunded
+	}
+
+	if refunded+amount > withdrawn {
+		return domain.Refund{}, RefundAmountError
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE balance_withdrawals
+		SET refunded_amount = refunded_amount + $2
+		WHERE id = $1
+	`, withdrawalId, amount)
+	if err != nil {
+		return domain.Refund{}, err
+	}
+
+	var balanceAfter int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET balance = balance + $2
+		WHERE id = $1
+		RETURNING balance
+	`, userId, amount).Scan(&balanceAfter)
+	if err != nil {
+		return domain.Refund{}, err
+	}
+
+	row = tx.QueryRowContext(ctx, `
+		INSERT INTO balance_refunds(user_id, withdrawal_id, request_id, amount, balance_before, balance_after)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+refundColumns,
+		userId, withdrawalId, requestId, amount, balanceAfter-amount, balanceAfter,
+	)
+	if err := scanRefund(row, &res); err != nil {
+		return domain.Refund{}, err
+	}
+
+	reference := "balance_refunds:" + strconv.FormatInt(res.Id, 10)
+	_, err = ledger.Post(ctx, tx, ledger.EntryRefund, reference, ledger.Move(ledger.AccountCash, ledger.UserAccount(userId), amount))
+	if err != nil {
+		return domain.Refund{}, err
+	}
+
+	err = webhook.Enqueue(ctx, tx, webhook.EventBalanceRefunded, webhook.RefundEventData{
+		RefundId:      res.Id,
+		WithdrawalId:  res.WithdrawalId,
+		UserId:        res.UserId,
+		Amount:        res.Amount,
+		BalanceBefore: res.BalanceBefore,
+		BalanceAfter:  res.BalanceAfter,
+		CreatedAt:     res.CreatedAt,
+	})
+	if err != nil {
+		return domain.Refund{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Refund{}, err
+	}
+
+	return res, nil
+}
+
+const refundColumns = `id, user_id, withdrawal_id, amount, balance_before, balance_after, created_at`
+
+func scanRefund(row scanner, f *domain.Refund) error {
+	return row.Scan(
+		&f.Id,
+		&f.UserId,
+		&f.WithdrawalId,
+		&f.Amount,
+		&f.BalanceBefore,
+		&f.BalanceAfter,
+		&f.CreatedAt,
+	)
+}
+
+// TransferBetweenUsers locks both users in ascending id order, so concurrent
+// transfers in opposite directions can not deadlock.
+func (r *Repository) TransferBetweenUsers(
+	ctx context.Context,
+	fromUserId int64,
+	toUserId int64,
+	amount int64,
+	requestId string,
+) (domain.Transfer, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return domain.Transfer{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, id := range []int64{min(fromUserId, toUserId), max(fromUserId, toUserId)} {
+		_, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, id)
+		if err != nil {
+			return domain.Transfer{}, err
+		}
+	}
+
+	// Checked under the sender lock, so a retried request waits for the first one
+	var t domain.Transfer
+	row := tx.QueryRowContext(ctx, `
+		SELECT `+transferColumns+`
+		FROM balance_transfers
+		WHERE from_user_id = $1 AND request_id = $2
+	`, fromUserId, requestId)
+
+	switch err := scanTransfer(row, &t); {
+	case err == nil:
+		if err := tx.Commit(); err != nil {
+			return domain.Transfer{}, err
+		}
+		return t, nil
+	case errors.Is(err, sql.ErrNoRows):
+	default:
+		return domain.Transfer{}, err
+	}
+
+	var fromBalanceAfter int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET balance = balance - $2
+		WHERE id = $1 AND balance - held_balance >= $2
+		RETURNING balance
+	`, fromUserId, amount).Scan(&fromBalanceAfter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Transfer{}, InsufficientFundsError
+		}
+		return domain.Transfer{}, err
+	}
+
+	// Outgoing transfers drain the balance as well, so they share the withdrawal limits
+	if err := r.checkWithdrawalLimits(ctx, tx, fromUserId, amount); err != nil {
+		return domain.Transfer{}, err
+	}
+
+	var toBalanceAfter int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET balance = balance + $2
+		WHERE id = $1
+		RETURNING balance
+	`, toUserId, amount).Scan(&toBalanceAfter)
+	if err != nil {
+		return domain.Transfer{}, err
+	}
+
+	var res domain.Transfer
+	row = tx.QueryRowContext(ctx, `
+		INSERT INTO balance_transfers(
+			from_user_id, to_user_id, request_id, amount,
+			from_balance_before, from_balance_after, to_balance_before, to_balance_after
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+transferColumns,
+		fromUserId, toUserId, requestId, amount,
+		fromBalanceAfter+amount, fromBalanceAfter, toBalanceAfter-amount, toBalanceAfter,
+	)
+	if err := scanTransfer(row, &res); err != nil {
+		return domain.Transfer{}, err
+	}
+
+	reference := "balance_transfers:" + strconv.FormatInt(res.Id, 10)
+	_, err = ledger.Post(ctx, tx, ledger.EntryTransfer, reference, ledger.Move(ledger.UserAccount(fromUserId), ledger.UserAccount(toUserId), amount))
+	if err != nil {
+		return domain.Transfer{}, err
+	}
+
+	err = webhook.Enqueue(ctx, tx, webhook.EventBalanceTransferred, webhook.TransferEventData{
+		TransferId: res.Id,
+		FromUserId: res.FromUserId,
+		ToUserId:   res.ToUserId,
+		Amount:     res.Amount,
+		CreatedAt:  res.CreatedAt,
+	})
+	if err != nil {
+		return domain.Transfer{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Transfer{}, err
+	}
+
+	return res, nil
+}
+
+const transferColumns = `id, from_user_id, to_user_id, amount,
+	from_balance_before, from_balance_after, to_balance_before, to_balance_after, created_at`
+
+func scanTransfer(row *sql.Row, t *domain.Transfer) error {
+	return row.Scan(
+		&t.Id,
+		&t.FromUserId,
+		&t.ToUserId,
+		&t.Amount,
+		&t.FromBalanceBefore,
+		&t.FromBalanceAfter,
+		&t.ToBalanceBefore,
+		&t.ToBalanceAfter,
+		&t.CreatedAt,
+	)
+}
+
+func (r *Repository) CreateHold(
+	ctx context.Context,
+	userId int64,
+	amount int64,
+	ttl time.Duration,
+	requestId string,
+) (domain.Hold, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return domain.Hold{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var h domain.Hold
+	row := tx.QueryRowContext(ctx, `
+		SELECT `+holdColumns+`
+		FROM balance_holds
+		WHERE user_id = $1 AND request_id = $2
+	`, userId, requestId)
+
+	switch err := scanHold(row, &h); {
+	case err == nil:
+		if err := tx.Commit(); err != nil {
+			return domain.Hold{}, err
+		}
+		return h, nil
+	case errors.Is(err, sql.ErrNoRows):
+	default:
+		return domain.Hold{}, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET held_balance = held_balance + $2
+		WHERE id = $1 AND balance - held_balance >= $2
+	`, userId, amount)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return domain.Hold{}, err
+	} else if n == 0 {
+		return domain.Hold{}, InsufficientFundsError
+	}
+
+	row = tx.QueryRowContext(ctx, `
+		INSERT INTO balance_holds(user_id, amount, request_id, expires_at)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4::float8))
+		RETURNING `+holdColumns,
+		userId, amount, requestId, ttl.Seconds(),
+	)
+	if err := scanHold(row, &h); err != nil {
+		return domain.Hold{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Hold{}, err
+	}
+
+	return h, nil
+}
+
+func (r *Repository) GetHold(ctx context.Context, userId int64, holdId int64) (domain.Hold, error) {
+	var h domain.Hold
 
-	rows, err := r.db.QueryContext(ctx, query, userId)
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+holdColumns+`
+		FROM balance_holds
+		WHERE id = $1 AND user_id = $2
+	`, holdId, userId)
+
+	if err := scanHold(row, &h); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Hold{}, HoldNotFoundError
+		}
+		return domain.Hold{}, err
+	}
+
+	return h, nil
+}
+
+// CaptureHold debits the captured amount like a withdrawal and releases the
+// rest of the hold. Repeating the capture with the same request id returns
+// the captured hold unchanged.
+func (r *Repository) CaptureHold(
+	ctx context.Context,
+	userId int64,
+	holdId int64,
+	amount int64,
+	requestId string,
+) (domain.Hold, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return domain.Hold{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	h, expired, err := r.lockHold(ctx, tx, userId, holdId)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if finishedBy(h, domain.HoldStatusCaptured, requestId) {
+		return h, tx.Commit()
+	}
+
+	if h.Status != domain.HoldStatusActive || expired {
+		return domain.Hold{}, HoldNotActiveError
+	}
+
+	if amount == 0 {
+		amount = h.Amount
+	}
+
+	if amount > h.Amount {
+		return domain.Hold{}, CaptureAmountError
+	}
+
+	var balanceAfter int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET balance = balance - $2, held_balance = held_balance - $3
+		WHERE id = $1
+		RETURNING balance
+	`, userId, amount, h.Amount).Scan(&balanceAfter)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	// A capture debits the balance like a withdrawal, so it is limited the same way
+	if err := r.checkWithdrawalLimits(ctx, tx, userId, amount); err != nil {
+		return domain.Hold{}, err
+	}
+
+	var w domain.Withdrawal
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO balance_withdrawals(user_id, amount, balance_before, balance_after)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, amount, balance_before, balance_after, created_at
+	`, userId, amount, balanceAfter+amount, balanceAfter).Scan(
+		&w.Id,
+		&w.UserId,
+		&w.Amount,
+		&w.BalanceBefore,
+		&w.BalanceAfter,
+		&w.CreatedAt,
+	)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	reference := "balance_withdrawals:" + strconv.FormatInt(w.Id, 10)
+	_, err = ledger.Post(ctx, tx, ledger.EntryWithdrawal, reference, ledger.Move(ledger.UserAccount(userId), ledger.AccountCash, amount))
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	err = webhook.Enqueue(ctx, tx, webhook.EventBalanceWithdrawn, webhook.BalanceEventData{
+		UserId:        w.UserId,
+		Amount:        w.Amount,
+		BalanceBefore: w.BalanceBefore,
+		BalanceAfter:  w.BalanceAfter,
+		CreatedAt:     w.CreatedAt,
+	})
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		UPDATE balance_holds
+		SET status = $2, captured_amount = $3, withdrawal_id = $4, finish_request_id = $5
+		WHERE id = $1
+		RETURNING `+holdColumns,
+		h.Id, domain.HoldStatusCaptured, amount, w.Id, requestId,
+	)
+	if err := scanHold(row, &h); err != nil {
+		return domain.Hold{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Hold{}, err
+	}
+
+	return h, nil
+}
+
+// ReleaseHold returns the held amount to the available balance. Repeating the
+// release with the same request id returns the released hold unchanged.
+func (r *Repository) ReleaseHold(ctx context.Context, userId int64, holdId int64, requestId string) (domain.Hold, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return domain.Hold{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	h, _, err := r.lockHold(ctx, tx, userId, holdId)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if finishedBy(h, domain.HoldStatusReleased, requestId) {
+		return h, tx.Commit()
+	}
+
+	if h.Status != domain.HoldStatusActive {
+		return domain.Hold{}, HoldNotActiveError
+	}
+
+	h, err = r.finishHold(ctx, tx, h, domain.HoldStatusReleased, &requestId)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Hold{}, err
+	}
+
+	return h, nil
+}
+
+func (r *Repository) GetExpiredHolds(ctx context.Context, limit int) ([]domain.Hold, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+holdColumns+`
+		FROM balance_holds
+		WHERE status = 'active' AND expires_at <= now()
+		ORDER BY expires_at
+		LIMIT $1
+	`, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var history []domain.Withdrawal
+	var holds []domain.Hold
 
 	for rows.Next() {
-		var w domain.Withdrawal
-
-		err := rows.Scan(
-			&w.UserId,
-			&w.Amount,
-			&w.BalanceBefore,
-			&w.BalanceAfter,
-			&w.CreatedAt,
-		)
-		if err != nil {
+		var h domain.Hold
+
+		if err := scanHold(rows, &h); err != nil {
 			return nil, err
 		}
 
-		history = append(history, w)
+		holds = append(holds, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// ExpireHold releases an expired hold, unless it was captured or released meanwhile
+func (r *Repository) ExpireHold(ctx context.Context, userId int64, holdId int64) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	h, expired, err := r.lockHold(ctx, tx, userId, holdId)
+	if err != nil {
+		return false, err
+	}
+
+	if h.Status != domain.HoldStatusActive || !expired {
+		return false, nil
+	}
+
+	if _, err := r.finishHold(ctx, tx, h, domain.HoldStatusExpired, nil); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// lockHold also reports whether the hold is past its expiry by the database clock
+func (r *Repository) lockHold(ctx context.Context, tx *sql.Tx, userId int64, holdId int64) (domain.Hold, bool, error) {
+	var h domain.Hold
+	var expired bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT `+holdColumns+`, expires_at <= now()
+		FROM balance_holds
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+	`, holdId, userId).Scan(
+		&h.Id,
+		&h.UserId,
+		&h.Amount,
+		&h.Status,
+		&h.CapturedAmount,
+		&h.WithdrawalId,
+		&h.ExpiresAt,
+		&h.CreatedAt,
+		&h.UpdatedAt,
+		&h.FinishRequestId,
+		&expired,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Hold{}, false, HoldNotFoundError
+		}
+		return domain.Hold{}, false, err
+	}
+
+	return h, expired, nil
+}
+
+func (r *Repository) finishHold(
+	ctx context.Context,
+	tx *sql.Tx,
+	h domain.Hold,
+	status string,
+	requestId *string,
+) (domain.Hold, error) {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET held_balance = held_balance - $2
+		WHERE id = $1
+	`, h.UserId, h.Amount)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		UPDATE balance_holds
+		SET status = $2, finish_request_id = $3
+		WHERE id = $1
+		RETURNING `+holdColumns,
+		h.Id, status, requestId,
+	)
+	if err := scanHold(row, &h); err != nil {
+		return domain.Hold{}, err
+	}
+
+	return h, nil
+}
+
+const holdColumns = `id, user_id, amount, status, captured_amount, withdrawal_id, expires_at, created_at, updated_at,
+	finish_request_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanHold(row scanner, h *domain.Hold) error {
+	return row.Scan(
+		&h.Id,
+		&h.UserId,
+		&h.Amount,
+		&h.Status,
+		&h.CapturedAmount,
+		&h.WithdrawalId,
+		&h.ExpiresAt,
+		&h.CreatedAt,
+		&h.UpdatedAt,
+		&h.FinishRequestId,
+	)
+}
+
+// finishedBy tells whether the hold was finished with the status by the request,
+// so the request is a replay
+func finishedBy(h domain.Hold, status string, requestId string) bool {
+	return h.Status == status && h.FinishRequestId != nil && *h.FinishRequestId == requestId
+}
+
+func (r *Repository) GetUserBalanceHistory(
+	ctx context.Context,
+	userId int64,
+	filter domain.HistoryFilter,
+) ([]domain.Transaction, error) {
+	query, args := historyQuery(userId, filter)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []domain.Transaction
+
+	for rows.Next() {
+		var t domain.Transaction
+
+		if err := scanTransaction(rows, &t); err != nil {
+			return nil, err
+		}
+
+		history = append(history, t)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -140,3 +882,245 @@ func (r *Repository) GetUserBalanceHistory(ctx context.Context, userId int64) ([
 
 	return history, nil
 }
+
+func (r *Repository) checkWithdrawalLimits(ctx context.Context, tx *sql.Tx, userId int64, amount int64) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, max_amount, daily_amount, monthly_amount, max_count, count_window_seconds
+		FROM withdrawal_limits
+		WHERE user_id IS NULL OR user_id = $1
+	`, userId)
+	if err != nil {
+		return err
+	}
+
+	var global, user domain.WithdrawalLimits
+	for rows.Next() {
+		var l domain.WithdrawalLimits
+		if err := scanWithdrawalLimits(rows, &l); err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		if l.UserId == nil {
+			global = l
+		} else {
+			user = l
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !needsWithdrawalUsage(global, user) {
+		return checkWithdrawalLimits(global, user, amount, domain.WithdrawalUsage{})
+	}
+
+	var globalWindow, userWindow float64
+	if global.CountWindow != nil {
+		globalWindow = global.CountWindow.Seconds()
+	}
+	if user.CountWindow != nil {
+		userWindow = user.CountWindow.Seconds()
+	}
+
+	// Withdrawals, hold captures and outgoing transfers all count, refunded
+	// money is returned to the user and does not
+	var usage domain.WithdrawalUsage
+	err = tx.QueryRowContext(ctx, `
+		WITH outgoing AS (
+			SELECT amount - refunded_amount AS amount, created_at
+			FROM balance_withdrawals
+			WHERE user_id = $1
+				AND created_at > now() - GREATEST(
+					interval '1 month',
+					make_interval(secs => $2::double precision),
+					make_interval(secs => $3::double precision)
+				)
+			UNION ALL
+			SELECT amount, created_at
+			FROM balance_transfers
+			WHERE from_user_id = $1
+				AND created_at > now() - GREATEST(
+					interval '1 month',
+					make_interval(secs => $2::double precision),
+					make_interval(secs => $3::double precision)
+				)
+		)
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE created_at > now() - interval '1 day'), 0)::bigint,
+			COALESCE(SUM(amount) FILTER (WHERE created_at > now() - interval '1 month'), 0)::bigint,
+			COUNT(*) FILTER (WHERE created_at > now() - make_interval(secs => $2::double precision)),
+			COUNT(*) FILTER (WHERE created_at > now() - make_interval(secs => $3::double precision))
+		FROM outgoing
+	`, userId, globalWindow, userWindow).Scan(
+		&usage.DailyAmount,
+		&usage.MonthlyAmount,
+		&usage.GlobalCount,
+		&usage.UserCount,
+	)
+	if err != nil {
+		return err
+	}
+
+	return checkWithdrawalLimits(global, user, amount, usage)
+}
+
+// GetWithdrawalLimits returns limits of the user, or the global ones when
+// userId is nil. A user without own limits gets an empty set.
+func (r *Repository) GetWithdrawalLimits(ctx context.Context, userId *int64) (domain.WithdrawalLimits, error) {
+	var l domain.WithdrawalLimits
+	err := scanWithdrawalLimits(r.db.QueryRowContext(ctx, `
+		SELECT user_id, max_amount, daily_amount, monthly_amount, max_count, count_window_seconds
+		FROM withdrawal_limits
+		WHERE user_id IS NOT DISTINCT FROM $1::bigint
+	`, userId), &l)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) && userId != nil {
+			return domain.WithdrawalLimits{UserId: userId}, nil
+		}
+		return domain.WithdrawalLimits{}, err
+	}
+
+	return l, nil
+}
+
+func (r *Repository) SetWithdrawalLimits(ctx context.Context, limits domain.WithdrawalLimits) (domain.WithdrawalLimits, error) {
+	var countWindowSeconds *int64
+	if limits.CountWindow != nil {
+		seconds := int64(limits.CountWindow.Seconds())
+		countWindowSeconds = &seconds
+	}
+
+	args := []any{
+		limits.MaxAmount,
+		limits.DailyAmount,
+		limits.MonthlyAmount,
+		limits.MaxCount,
+		countWindowSeconds,
+	}
+
+	// The global row is created by the migration, user rows on first update
+	query := `
+		UPDATE withdrawal_limits
+		SET max_amount = $1, daily_amount = $2, monthly_amount = $3, max_count = $4, count_window_seconds = $5
+		WHERE user_id IS NULL
+		RETURNING user_id, max_amount, daily_amount, monthly_amount, max_count, count_window_seconds
+	`
+	if limits.UserId != nil {
+		args = append([]any{*limits.UserId}, args...)
+		query = `
+			INSERT INTO withdrawal_limits(user_id, max_amount, daily_amount, monthly_amount, max_count, count_window_seconds)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id) WHERE user_id IS NOT NULL DO UPDATE
+			SET max_amount = EXCLUDED.max_amount,
+				daily_amount = EXCLUDED.daily_amount,
+				monthly_amount = EXCLUDED.monthly_amount,
+				max_count = EXCLUDED.max_count,
+				count_window_seconds = EXCLUDED.count_window_seconds
+			RETURNING user_id, max_amount, daily_amount, monthly_amount, max_count, count_window_seconds
+		`
+	}
+
+	var res domain.WithdrawalLimits
+	if err := scanWithdrawalLimits(r.db.QueryRowContext(ctx, query, args...), &res); err != nil {
+		return domain.WithdrawalLimits{}, err
+	}
+
+	return res, nil
+}
+
+func scanWithdrawalLimits(row scanner, l *domain.WithdrawalLimits) error {
+	var countWindowSeconds *int64
+
+	err := row.Scan(&l.UserId, &l.MaxAmount, &l.DailyAmount, &l.MonthlyAmount, &l.MaxCount, &countWindowSeconds)
+	if err != nil {
+		return err
+	}
+
+	if countWindowSeconds != nil {
+		window := time.Duration(*countWindowSeconds) * time.Second
+		l.CountWindow = &window
+	}
+
+	return nil
+}
+
+// StreamUserBalanceHistory passes history entries to fn one by one as they
+// are read, so exports do not keep the whole history in memory.
+func (r *Repository) StreamUserBalanceHistory(
+	ctx context.Context,
+	userId int64,
+	filter domain.HistoryFilter,
+	fn func(t domain.Transaction) error,
+) error {
+	query, args := historyQuery(userId, filter)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t domain.Transaction
+
+		if err := scanTransaction(rows, &t); err != nil {
+			return err
+		}
+
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// historyQuery selects the history newest first. Pages continue after the
+// cursor by (created_at, id), which is unique because every history table
+// takes ids from the same sequence.
+func historyQuery(userId int64, filter domain.HistoryFilter) (string, []any) {
+	var afterCreatedAt, afterId any
+	if filter.After != nil {
+		// created_at has no time zone, the cursor keeps its wall clock as is
+		afterCreatedAt = filter.After.CreatedAt.Format("2006-01-02 15:04:05.999999")
+		afterId = filter.After.Id
+	}
+
+	var limit any
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+
+	query := `
+		SELECT id, user_id, type, amount, balance_before, balance_after, created_at, counterparty_user_id, withdrawal_id
+		FROM balance_transactions
+		WHERE user_id = $1
+			AND ($2::timestamptz IS NULL OR created_at >= $2::timestamptz)
+			AND ($3::timestamptz IS NULL OR created_at < $3::timestamptz)
+			AND ($4::bigint IS NULL OR amount >= $4::bigint)
+			AND ($5::bigint IS NULL OR amount <= $5::bigint)
+			AND ($6::timestamp IS NULL OR (created_at, id) < ($6::timestamp, $7::bigint))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $8::int
+	`
+
+	return query, []any{userId, filter.From, filter.To, filter.MinAmount, filter.MaxAmount, afterCreatedAt, afterId, limit}
+}
+
+func scanTransaction(row scanner, t *domain.Transaction) error {
+	return row.Scan(
+		&t.Id,
+		&t.UserId,
+		&t.Type,
+		&t.Amount,
+		&t.BalanceBefore,
+		&t.BalanceAfter,
+		&t.CreatedAt,
+		&t.CounterpartyUserId,
+		&t.WithdrawalId,
+	)
+}
@@ -3,6 +3,19 @@ package user
 import "net/http"
 
 func RegisterRoutes(mux *http.ServeMux, h *Handler) {
+	mux.HandleFunc("GET /users/{id}/balance", h.GetBalance)
 	mux.HandleFunc("POST /users/{id}/balance/withdraw", h.Withdraw)
+	mux.HandleFunc("POST /users/{id}/balance/deposit", h.Deposit)
+	mux.HandleFunc("POST /users/{id}/balance/withdrawals/{withdrawal_id}/refund", h.RefundWithdrawal)
+	mux.HandleFunc("POST /users/{id}/balance/transfer", h.Transfer)
 	mux.HandleFunc("GET /users/{id}/balance/history", h.GetBalanceHistory)
+	mux.HandleFunc("GET /users/{id}/balance/history/export", h.ExportBalanceHistory)
+	mux.HandleFunc("POST /users/{id}/balance/holds", h.CreateHold)
+	mux.HandleFunc("GET /users/{id}/balance/holds/{hold_id}", h.GetHold)
+	mux.HandleFunc("POST /users/{id}/balance/holds/{hold_id}/capture", h.CaptureHold)
+	mux.HandleFunc("POST /users/{id}/balance/holds/{hold_id}/release", h.ReleaseHold)
+	mux.HandleFunc("GET /users/{id}/balance/withdrawal-limits", h.GetUserWithdrawalLimits)
+	mux.HandleFunc("PUT /users/{id}/balance/withdrawal-limits", h.SetUserWithdrawalLimits)
+	mux.HandleFunc("GET /withdrawal-limits", h.GetGlobalWithdrawalLimits)
+	mux.HandleFunc("PUT /withdrawal-limits", h.SetGlobalWithdrawalLimits)
 }
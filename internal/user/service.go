@@ -7,23 +7,45 @@ import (
 	"github.com/bdzhalalov/kolikosoft-trade/internal/user/domain"
 	customError "github.com/bdzhalalov/kolikosoft-trade/pkg/error"
 	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type RepositoryInterface interface {
 	GetUserById(ctx context.Context, userId int64) (domain.User, error)
 	WithdrawFromUserBalance(ctx context.Context, userId int64, amount int64, requestId string) (domain.Withdrawal, error)
-	GetUserBalanceHistory(ctx context.Context, userId int64) ([]domain.Withdrawal, error)
+	DepositToUserBalance(ctx context.Context, userId int64, amount int64, requestId string) (domain.Deposit, error)
+	RefundWithdrawal(ctx context.Context, userId int64, withdrawalId int64, amount int64, requestId string) (domain.Refund, error)
+	TransferBetweenUsers(ctx context.Context, fromUserId int64, toUserId int64, amount int64, requestId string) (domain.Transfer, error)
+	GetUserBalanceHistory(ctx context.Context, userId int64, filter domain.HistoryFilter) ([]domain.Transaction, error)
+	StreamUserBalanceHistory(ctx context.Context, userId int64, filter domain.HistoryFilter, fn func(t domain.Transaction) error) error
+	GetWithdrawalLimits(ctx context.Context, userId *int64) (domain.WithdrawalLimits, error)
+	SetWithdrawalLimits(ctx context.Context, limits domain.WithdrawalLimits) (domain.WithdrawalLimits, error)
+	CreateHold(ctx context.Context, userId int64, amount int64, ttl time.Duration, requestId string) (domain.Hold, error)
+	GetHold(ctx context.Context, userId int64, holdId int64) (domain.Hold, error)
+	CaptureHold(ctx context.Context, userId int64, holdId int64, amount int64, requestId string) (domain.Hold, error)
+	ReleaseHold(ctx context.Context, userId int64, holdId int64, requestId string) (domain.Hold, error)
+	GetExpiredHolds(ctx context.Context, limit int) ([]domain.Hold, error)
+	ExpireHold(ctx context.Context, userId int64, holdId int64) (bool, error)
 }
 
+const (
+	DefaultHoldTTL = 15 * time.Minute
+	MaxHoldTTL     = 7 * 24 * time.Hour
+
+	expireHoldsBatchSize = 100
+)
+
 type Service struct {
 	logger     *logrus.Logger
 	repository RepositoryInterface
+	holdTTL    time.Duration
 }
 
-func NewService(logger *logrus.Logger, repository RepositoryInterface) *Service {
+func NewService(logger *logrus.Logger, repository RepositoryInterface, holdTTL time.Duration) *Service {
 	return &Service{
 		logger,
 		repository,
+		holdTTL,
 	}
 }
 
@@ -47,11 +69,51 @@ func (s *Service) WithdrawFromBalance(
 		if errors.Is(err, InsufficientFundsError) {
 			return WithdrawBalanceResponseDTO{}, (&customError.BadRequestError{}).New("insufficient funds")
 		}
+
+		var limitErr *WithdrawalLimitError
+		if errors.As(err, &limitErr) {
+			return WithdrawBalanceResponseDTO{}, (&customError.UnprocessableEntityError{}).New(limitErr.Error())
+		}
+
 		s.logger.Errorf("Error while withdrawal from user balance by ID: %s", err)
 		return WithdrawBalanceResponseDTO{}, (&customError.InternalServerError{}).New()
 	}
 
 	dto := WithdrawBalanceResponseDTO{
+		Id:            res.Id,
+		UserId:        res.UserId,
+		Amount:        res.Amount,
+		BalanceBefore: res.BalanceBefore,
+		BalanceAfter:  res.BalanceAfter,
+		CreatedAt:     res.CreatedAt,
+	}
+
+	return dto, nil
+}
+
+func (s *Service) DepositToBalance(
+	ctx context.Context,
+	data DepositBalanceRequestDTO,
+) (DepositBalanceResponseDTO, *customError.BaseError) {
+	_, err := s.repository.GetUserById(ctx, data.UserId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DepositBalanceResponseDTO{}, (&customError.NotFoundError{}).New("User not found")
+		}
+
+		s.logger.Errorf("Error while getting user by ID: %s", err)
+
+		return DepositBalanceResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	res, err := s.repository.DepositToUserBalance(ctx, data.UserId, data.Amount, data.RequestId)
+	if err != nil {
+		s.logger.Errorf("Error while deposit to user balance by ID: %s", err)
+		return DepositBalanceResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	dto := DepositBalanceResponseDTO{
+		Id:            res.Id,
 		UserId:        res.UserId,
 		Amount:        res.Amount,
 		BalanceBefore: res.BalanceBefore,
@@ -62,39 +124,424 @@ func (s *Service) WithdrawFromBalance(
 	return dto, nil
 }
 
-func (s *Service) GetBalanceHistory(ctx context.Context, userId int64) ([]BalanceHistoryResponseDTO, *customError.BaseError) {
-	_, err := s.repository.GetUserById(ctx, userId)
+func (s *Service) RefundWithdrawal(
+	ctx context.Context,
+	data RefundWithdrawalRequestDTO,
+) (RefundResponseDTO, *customError.BaseError) {
+	if _, e := s.getUser(ctx, data.UserId); e != nil {
+		return RefundResponseDTO{}, e
+	}
+
+	res, err := s.repository.RefundWithdrawal(ctx, data.UserId, data.WithdrawalId, data.Amount, data.RequestId)
+	if err != nil {
+		switch {
+		case errors.Is(err, WithdrawalNotFoundError):
+			return RefundResponseDTO{}, (&customError.NotFoundError{}).New("Withdrawal not found")
+		case errors.Is(err, RefundAmountError):
+			return RefundResponseDTO{}, (&customError.BadRequestError{}).New(RefundAmountError.Error())
+		case errors.Is(err, AlreadyRefundedError):
+			return RefundResponseDTO{}, (&customError.ConflictError{}).New(AlreadyRefundedError.Error())
+		case errors.Is(err, RefundRequestIdError):
+			return RefundResponseDTO{}, (&customError.ConflictError{}).New(RefundRequestIdError.Error())
+		}
+
+		s.logger.Errorf("Error while refunding withdrawal by ID: %s", err)
+		return RefundResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	dto := RefundResponseDTO{
+		Id:            res.Id,
+		UserId:        res.UserId,
+		WithdrawalId:  res.WithdrawalId,
+		Amount:        res.Amount,
+		BalanceBefore: res.BalanceBefore,
+		BalanceAfter:  res.BalanceAfter,
+		CreatedAt:     res.CreatedAt,
+	}
+
+	return dto, nil
+}
+
+func (s *Service) TransferBalance(
+	ctx context.Context,
+	data TransferBalanceRequestDTO,
+) (TransferBalanceResponseDTO, *customError.BaseError) {
+	_, err := s.repository.GetUserById(ctx, data.UserId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TransferBalanceResponseDTO{}, (&customError.NotFoundError{}).New("User not found")
+		}
+
+		s.logger.Errorf("Error while getting user by ID: %s", err)
+
+		return TransferBalanceResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	_, err = s.repository.GetUserById(ctx, data.ToUserId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TransferBalanceResponseDTO{}, (&customError.NotFoundError{}).New("Recipient not found")
+		}
+
+		s.logger.Errorf("Error while getting user by ID: %s", err)
+
+		return TransferBalanceResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	res, err := s.repository.TransferBetweenUsers(ctx, data.UserId, data.ToUserId, data.Amount, data.RequestId)
+	if err != nil {
+		if errors.Is(err, InsufficientFundsError) {
+			return TransferBalanceResponseDTO{}, (&customError.BadRequestError{}).New("insufficient funds")
+		}
+
+		var limitErr *WithdrawalLimitError
+		if errors.As(err, &limitErr) {
+			return TransferBalanceResponseDTO{}, (&customError.UnprocessableEntityError{}).New(limitErr.Error())
+		}
+
+		s.logger.Errorf("Error while transfer from user balance by ID: %s", err)
+		return TransferBalanceResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	dto := TransferBalanceResponseDTO{
+		Id:            res.Id,
+		UserId:        res.FromUserId,
+		ToUserId:      res.ToUserId,
+		Amount:        res.Amount,
+		BalanceBefore: res.FromBalanceBefore,
+		BalanceAfter:  res.FromBalanceAfter,
+		CreatedAt:     res.CreatedAt,
+	}
+
+	return dto, nil
+}
+
+func (s *Service) GetBalanceHistory(
+	ctx context.Context,
+	query BalanceHistoryQueryDTO,
+) (BalanceHistoryPageResponseDTO, *customError.BaseError) {
+	_, err := s.repository.GetUserById(ctx, query.UserId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return []BalanceHistoryResponseDTO{}, (&customError.NotFoundError{}).New("User not found")
+			return BalanceHistoryPageResponseDTO{}, (&customError.NotFoundError{}).New("User not found")
 		}
 
 		s.logger.Errorf("Error while getting user by ID: %s", err)
 
-		return []BalanceHistoryResponseDTO{}, (&customError.InternalServerError{}).New()
+		return BalanceHistoryPageResponseDTO{}, (&customError.InternalServerError{}).New()
 	}
 
-	res, err := s.repository.GetUserBalanceHistory(ctx, userId)
+	filter := domain.HistoryFilter{
+		From:      query.From,
+		To:        query.To,
+		MinAmount: query.MinAmount,
+		MaxAmount: query.MaxAmount,
+		// One more row tells whether there is a next page
+		Limit: query.Limit + 1,
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeHistoryCursor(query.Cursor)
+		if err != nil {
+			return BalanceHistoryPageResponseDTO{}, (&customError.BadRequestError{}).New(err.Error())
+		}
+		filter.After = &after
+	}
+
+	res, err := s.repository.GetUserBalanceHistory(ctx, query.UserId, filter)
 	if err != nil {
 		s.logger.Errorf("Error while getting user balance history by ID: %s", err)
-		return []BalanceHistoryResponseDTO{}, (&customError.InternalServerError{}).New()
+		return BalanceHistoryPageResponseDTO{}, (&customError.InternalServerError{}).New()
 	}
 
-	return s.getDTOFromStruct(res), nil
+	page := BalanceHistoryPageResponseDTO{Limit: query.Limit}
+
+	if len(res) > query.Limit {
+		res = res[:query.Limit]
+
+		last := res[len(res)-1]
+		cursor := encodeHistoryCursor(domain.HistoryCursor{CreatedAt: last.CreatedAt, Id: last.Id})
+		page.NextCursor = &cursor
+	}
+
+	page.Items = s.getDTOFromStruct(res)
+
+	return page, nil
 }
 
-func (s *Service) getDTOFromStruct(history []domain.Withdrawal) []BalanceHistoryResponseDTO {
+// ExportBalanceHistory streams the whole filtered history to writer. Once the
+// writer has begun, errors can no longer change the response status.
+func (s *Service) ExportBalanceHistory(
+	ctx context.Context,
+	query BalanceHistoryQueryDTO,
+	writer BalanceHistoryWriter,
+) *customError.BaseError {
+	if _, e := s.getUser(ctx, query.UserId); e != nil {
+		return e
+	}
+
+	if err := writer.Begin(); err != nil {
+		s.logger.Errorf("Error while exporting user balance history: %s", err)
+		return (&customError.InternalServerError{}).New()
+	}
+
+	filter := domain.HistoryFilter{
+		From: query.From,
+		To:   query.To,
+	}
+
+	err := s.repository.StreamUserBalanceHistory(ctx, query.UserId, filter, func(t domain.Transaction) error {
+		return writer.Write(s.getHistoryDTO(t))
+	})
+	if err == nil {
+		err = writer.End()
+	}
+
+	if err != nil {
+		s.logger.Errorf("Error while exporting user balance history: %s", err)
+		return (&customError.InternalServerError{}).New()
+	}
+
+	return nil
+}
+
+func (s *Service) GetBalance(ctx context.Context, userId int64) (BalanceResponseDTO, *customError.BaseError) {
+	u, e := s.getUser(ctx, userId)
+	if e != nil {
+		return BalanceResponseDTO{}, e
+	}
+
+	return BalanceResponseDTO{
+		UserId:    u.Id,
+		Balance:   u.Balance,
+		Held:      u.HeldBalance,
+		Available: u.Balance - u.HeldBalance,
+	}, nil
+}
+
+func (s *Service) CreateHold(ctx context.Context, data CreateHoldRequestDTO) (HoldResponseDTO, *customError.BaseError) {
+	if _, e := s.getUser(ctx, data.UserId); e != nil {
+		return HoldResponseDTO{}, e
+	}
+
+	ttl := data.TTL
+	if ttl == 0 {
+		ttl = s.holdTTL
+	}
+	if ttl == 0 {
+		ttl = DefaultHoldTTL
+	}
+
+	res, err := s.repository.CreateHold(ctx, data.UserId, data.Amount, ttl, data.RequestId)
+	if err != nil {
+		return HoldResponseDTO{}, s.holdError(err)
+	}
+
+	return s.getHoldDTO(res), nil
+}
+
+func (s *Service) GetHold(ctx context.Context, userId int64, holdId int64) (HoldResponseDTO, *customError.BaseError) {
+	if _, e := s.getUser(ctx, userId); e != nil {
+		return HoldResponseDTO{}, e
+	}
+
+	res, err := s.repository.GetHold(ctx, userId, holdId)
+	if err != nil {
+		return HoldResponseDTO{}, s.holdError(err)
+	}
+
+	return s.getHoldDTO(res), nil
+}
+
+func (s *Service) CaptureHold(ctx context.Context, data CaptureHoldRequestDTO) (HoldResponseDTO, *customError.BaseError) {
+	if _, e := s.getUser(ctx, data.UserId); e != nil {
+		return HoldResponseDTO{}, e
+	}
+
+	res, err := s.repository.CaptureHold(ctx, data.UserId, data.HoldId, data.Amount, data.RequestId)
+	if err != nil {
+		return HoldResponseDTO{}, s.holdError(err)
+	}
+
+	return s.getHoldDTO(res), nil
+}
+
+func (s *Service) ReleaseHold(ctx context.Context, data ReleaseHoldRequestDTO) (HoldResponseDTO, *customError.BaseError) {
+	if _, e := s.getUser(ctx, data.UserId); e != nil {
+		return HoldResponseDTO{}, e
+	}
+
+	res, err := s.repository.ReleaseHold(ctx, data.UserId, data.HoldId, data.RequestId)
+	if err != nil {
+		return HoldResponseDTO{}, s.holdError(err)
+	}
+
+	return s.getHoldDTO(res), nil
+}
+
+// ExpireHolds releases every active hold past its expiry and returns their number
+func (s *Service) ExpireHolds(ctx context.Context) (int, error) {
+	expired := 0
+
+	for {
+		holds, err := s.repository.GetExpiredHolds(ctx, expireHoldsBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, h := range holds {
+			ok, err := s.repository.ExpireHold(ctx, h.UserId, h.Id)
+			if err != nil {
+				return expired, err
+			}
+
+			if ok {
+				expired++
+			}
+		}
+
+		if len(holds) < expireHoldsBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// GetWithdrawalLimits returns own limits of the user, or the global ones when userId is nil
+func (s *Service) GetWithdrawalLimits(ctx context.Context, userId *int64) (WithdrawalLimitsResponseDTO, *customError.BaseError) {
+	if userId != nil {
+		if _, e := s.getUser(ctx, *userId); e != nil {
+			return WithdrawalLimitsResponseDTO{}, e
+		}
+	}
+
+	res, err := s.repository.GetWithdrawalLimits(ctx, userId)
+	if err != nil {
+		s.logger.Errorf("Error while getting withdrawal limits: %s", err)
+		return WithdrawalLimitsResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	return s.getWithdrawalLimitsDTO(res), nil
+}
+
+func (s *Service) SetWithdrawalLimits(
+	ctx context.Context,
+	data SetWithdrawalLimitsRequestDTO,
+) (WithdrawalLimitsResponseDTO, *customError.BaseError) {
+	if data.UserId != nil {
+		if _, e := s.getUser(ctx, *data.UserId); e != nil {
+			return WithdrawalLimitsResponseDTO{}, e
+		}
+	}
+
+	limits := domain.WithdrawalLimits{
+		UserId:        data.UserId,
+		MaxAmount:     data.MaxAmount,
+		DailyAmount:   data.DailyAmount,
+		MonthlyAmount: data.MonthlyAmount,
+		MaxCount:      data.MaxCount,
+	}
+
+	if data.CountWindowSeconds != nil {
+		window := time.Duration(*data.CountWindowSeconds) * time.Second
+		limits.CountWindow = &window
+	}
+
+	res, err := s.repository.SetWithdrawalLimits(ctx, limits)
+	if err != nil {
+		s.logger.Errorf("Error while setting withdrawal limits: %s", err)
+		return WithdrawalLimitsResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	return s.getWithdrawalLimitsDTO(res), nil
+}
+
+func (s *Service) getWithdrawalLimitsDTO(l domain.WithdrawalLimits) WithdrawalLimitsResponseDTO {
+	dto := WithdrawalLimitsResponseDTO{
+		UserId:        l.UserId,
+		MaxAmount:     l.MaxAmount,
+		DailyAmount:   l.DailyAmount,
+		MonthlyAmount: l.MonthlyAmount,
+		MaxCount:      l.MaxCount,
+	}
+
+	if l.CountWindow != nil {
+		seconds := int64(l.CountWindow.Seconds())
+		dto.CountWindowSeconds = &seconds
+	}
+
+	return dto
+}
+
+func (s *Service) getUser(ctx context.Context, userId int64) (domain.User, *customError.BaseError) {
+	u, err := s.repository.GetUserById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.User{}, (&customError.NotFoundError{}).New("User not found")
+		}
+
+		s.logger.Errorf("Error while getting user by ID: %s", err)
+
+		return domain.User{}, (&customError.InternalServerError{}).New()
+	}
+
+	return u, nil
+}
+
+func (s *Service) holdError(err error) *customError.BaseError {
+	var limitErr *WithdrawalLimitError
+
+	switch {
+	case errors.As(err, &limitErr):
+		return (&customError.UnprocessableEntityError{}).New(limitErr.Error())
+	case errors.Is(err, InsufficientFundsError):
+		return (&customError.BadRequestError{}).New("insufficient funds")
+	case errors.Is(err, CaptureAmountError):
+		return (&customError.BadRequestError{}).New(CaptureAmountError.Error())
+	case errors.Is(err, HoldNotFoundError):
+		return (&customError.NotFoundError{}).New("Hold not found")
+	case errors.Is(err, HoldNotActiveError):
+		return (&customError.ConflictError{}).New(HoldNotActiveError.Error())
+	}
+
+	s.logger.Errorf("Error while processing balance hold: %s", err)
+
+	return (&customError.InternalServerError{}).New()
+}
+
+func (s *Service) getHoldDTO(h domain.Hold) HoldResponseDTO {
+	return HoldResponseDTO{
+		Id:             h.Id,
+		UserId:         h.UserId,
+		Amount:         h.Amount,
+		Status:         h.Status,
+		CapturedAmount: h.CapturedAmount,
+		WithdrawalId:   h.WithdrawalId,
+		ExpiresAt:      h.ExpiresAt,
+		CreatedAt:      h.CreatedAt,
+		UpdatedAt:      h.UpdatedAt,
+	}
+}
+
+func (s *Service) getDTOFromStruct(history []domain.Transaction) []BalanceHistoryResponseDTO {
 	DTOs := make([]BalanceHistoryResponseDTO, 0, len(history))
 
 	for _, h := range history {
-		DTOs = append(DTOs, BalanceHistoryResponseDTO{
-			UserId:        h.UserId,
-			Amount:        h.Amount,
-			BalanceBefore: h.BalanceBefore,
-			BalanceAfter:  h.BalanceAfter,
-			CreatedAt:     h.CreatedAt,
-		})
+		DTOs = append(DTOs, s.getHistoryDTO(h))
 	}
 
 	return DTOs
 }
+
+func (s *Service) getHistoryDTO(h domain.Transaction) BalanceHistoryResponseDTO {
+	return BalanceHistoryResponseDTO{
+		Id:                 h.Id,
+		UserId:             h.UserId,
+		Type:               h.Type,
+		Amount:             h.Amount,
+		BalanceBefore:      h.BalanceBefore,
+		BalanceAfter:       h.BalanceAfter,
+		CreatedAt:          h.CreatedAt,
+		CounterpartyUserId: h.CounterpartyUserId,
+		WithdrawalId:       h.WithdrawalId,
+	}
+}
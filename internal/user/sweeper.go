@@ -0,0 +1,50 @@
+package user
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type HoldSweeper struct {
+	service  *Service
+	logger   *logrus.Logger
+	interval time.Duration
+}
+
+func NewHoldSweeper(service *Service, logger *logrus.Logger, interval time.Duration) *HoldSweeper {
+	return &HoldSweeper{
+		service:  service,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run releases expired holds until ctx is done
+func (s *HoldSweeper) Run(ctx context.Context) {
+	s.logger.Infof("Starting balance hold sweeper with interval %s", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Balance hold sweeper stopped")
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *HoldSweeper) sweep(ctx context.Context) {
+	expired, err := s.service.ExpireHolds(ctx)
+	if err != nil {
+		s.logger.Errorf("Error while expiring balance holds: %s", err)
+	}
+
+	if expired > 0 {
+		s.logger.Infof("Released %d expired balance holds", expired)
+	}
+}
@@ -1,14 +1,20 @@
 package user
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/user/domain"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -20,8 +26,24 @@ var (
 		Id:      1,
 		Balance: 300,
 	}
-	history       = make([]domain.Withdrawal, 0, 2)
-	mockRequestId = "request-id"
+	mockRecipient = domain.User{
+		Id:      3,
+		Balance: 0,
+	}
+	history                = make([]domain.Transaction, 0, 2)
+	transfers              = make([]domain.Transfer, 0, 1)
+	holds                  = make([]domain.Hold, 0, 2)
+	refunds                = make([]domain.Refund, 0, 2)
+	refundsByRequestId     = make(map[string]domain.Refund)
+	globalWithdrawalLimits domain.WithdrawalLimits
+	userWithdrawalLimits   = make(map[int64]domain.WithdrawalLimits)
+	mockRequestId          = "request-id"
+	mockDepositRequestId   = "deposit-request-id"
+	mockTransferRequestId  = "transfer-request-id"
+	mockHoldRequestId      = "hold-request-id"
+	mockRefundRequestId    = "refund-request-id"
+	mockCaptureRequestId   = "capture-request-id"
+	mockReleaseRequestId   = "release-request-id"
 )
 
 type RepositoryMock struct {
@@ -29,11 +51,14 @@ type RepositoryMock struct {
 }
 
 func (r *RepositoryMock) GetUserById(_ context.Context, userId int64) (domain.User, error) {
-	if userId != 1 {
-		return domain.User{}, sql.ErrNoRows
+	switch userId {
+	case mockUser.Id:
+		return mockUser, nil
+	case mockRecipient.Id:
+		return mockRecipient, nil
 	}
 
-	return mockUser, nil
+	return domain.User{}, sql.ErrNoRows
 }
 
 func (r *RepositoryMock) WithdrawFromUserBalance(
@@ -47,13 +72,27 @@ func (r *RepositoryMock) WithdrawFromUserBalance(
 	}
 
 	if requestId == mockRequestId {
-		return history[0], nil
+		t := history[0]
+		return domain.Withdrawal{
+			Id:            t.Id,
+			UserId:        t.UserId,
+			Amount:        t.Amount,
+			BalanceBefore: t.BalanceBefore,
+			BalanceAfter:  t.BalanceAfter,
+			CreatedAt:     t.CreatedAt,
+		}, nil
 	}
 
-	if amount > mockUser.Balance {
+	if amount > mockUser.Balance-mockUser.HeldBalance {
 		return domain.Withdrawal{}, InsufficientFundsError
 	}
+
+	if err := checkMockWithdrawalLimits(userId, amount); err != nil {
+		return domain.Withdrawal{}, err
+	}
+
 	withdrawal := domain.Withdrawal{
+		Id:            int64(len(history) + 1),
 		UserId:        userId,
 		Amount:        amount,
 		BalanceBefore: mockUser.Balance,
@@ -63,22 +102,498 @@ func (r *RepositoryMock) WithdrawFromUserBalance(
 
 	mockUser.Balance = mockUser.Balance - amount
 
-	history = append(history, withdrawal)
+	history = append(history, domain.Transaction{
+		Id:            withdrawal.Id,
+		UserId:        withdrawal.UserId,
+		Type:          domain.TransactionTypeWithdrawal,
+		Amount:        withdrawal.Amount,
+		BalanceBefore: withdrawal.BalanceBefore,
+		BalanceAfter:  withdrawal.BalanceAfter,
+		CreatedAt:     withdrawal.CreatedAt,
+	})
 
 	return withdrawal, nil
 }
 
-func (r *RepositoryMock) GetUserBalanceHistory(_ context.Context, userId int64) ([]domain.Withdrawal, error) {
+func (r *RepositoryMock) DepositToUserBalance(
+	_ context.Context,
+	userId int64,
+	amount int64,
+	requestId string,
+) (domain.Deposit, error) {
+	if r.err != nil {
+		return domain.Deposit{}, r.err
+	}
+
+	if requestId == mockDepositRequestId {
+		for _, t := range history {
+			if t.Type == domain.TransactionTypeDeposit {
+				return domain.Deposit{
+					Id:            t.Id,
+					UserId:        t.UserId,
+					Amount:        t.Amount,
+					BalanceBefore: t.BalanceBefore,
+					BalanceAfter:  t.BalanceAfter,
+					CreatedAt:     t.CreatedAt,
+				}, nil
+			}
+		}
+	}
+
+	deposit := domain.Deposit{
+		Id:            int64(len(history) + 1),
+		UserId:        userId,
+		Amount:        amount,
+		BalanceBefore: mockUser.Balance,
+		BalanceAfter:  mockUser.Balance + amount,
+		CreatedAt:     time.Now(),
+	}
+
+	mockUser.Balance = mockUser.Balance + amount
+
+	history = append(history, domain.Transaction{
+		Id:            deposit.Id,
+		UserId:        deposit.UserId,
+		Type:          domain.TransactionTypeDeposit,
+		Amount:        deposit.Amount,
+		BalanceBefore: deposit.BalanceBefore,
+		BalanceAfter:  deposit.BalanceAfter,
+		CreatedAt:     deposit.CreatedAt,
+	})
+
+	return deposit, nil
+}
+
+func (r *RepositoryMock) RefundWithdrawal(
+	_ context.Context,
+	userId int64,
+	withdrawalId int64,
+	amount int64,
+	requestId string,
+) (domain.Refund, error) {
+	if r.err != nil {
+		return domain.Refund{}, r.err
+	}
+
+	var withdrawn int64
+	for _, t := range history {
+		if t.Id == withdrawalId && t.UserId == userId && t.Type == domain.TransactionTypeWithdrawal {
+			withdrawn = t.Amount
+		}
+	}
+
+	if withdrawn == 0 {
+		return domain.Refund{}, WithdrawalNotFoundError
+	}
+
+	if f, ok := refundsByRequestId[requestId]; ok {
+		if f.WithdrawalId != withdrawalId {
+			return domain.Refund{}, RefundRequestIdError
+		}
+		return f, nil
+	}
+
+	var refunded int64
+	for _, f := range refunds {
+		if f.WithdrawalId == withdrawalId {
+			refunded += f.Amount
+		}
+	}
+
+	if refunded == withdrawn {
+		return domain.Refund{}, AlreadyRefundedError
+	}
+
+	if amount == 0 {
+		amount = withdrawn - refunded
+	}
+
+	if refunded+amount > withdrawn {
+		return domain.Refund{}, RefundAmountError
+	}
+
+	refund := domain.Refund{
+		Id:            int64(len(history) + 1),
+		UserId:        userId,
+		WithdrawalId:  withdrawalId,
+		Amount:        amount,
+		BalanceBefore: mockUser.Balance,
+		BalanceAfter:  mockUser.Balance + amount,
+		CreatedAt:     time.Now(),
+	}
+
+	mockUser.Balance += amount
+	refunds = append(refunds, refund)
+	refundsByRequestId[requestId] = refund
+
+	history = append(history, domain.Transaction{
+		Id:            refund.Id,
+		UserId:        userId,
+		Type:          domain.TransactionTypeRefund,
+		Amount:        amount,
+		BalanceBefore: refund.BalanceBefore,
+		BalanceAfter:  refund.BalanceAfter,
+		CreatedAt:     refund.CreatedAt,
+		WithdrawalId:  &refund.WithdrawalId,
+	})
+
+	return refund, nil
+}
+
+func (r *RepositoryMock) TransferBetweenUsers(
+	_ context.Context,
+	fromUserId int64,
+	toUserId int64,
+	amount int64,
+	requestId string,
+) (domain.Transfer, error) {
+	if r.err != nil {
+		return domain.Transfer{}, r.err
+	}
+
+	if requestId == mockTransferRequestId && len(transfers) > 0 {
+		return transfers[0], nil
+	}
+
+	if amount > mockUser.Balance {
+		return domain.Transfer{}, InsufficientFundsError
+	}
+
+	if err := checkMockWithdrawalLimits(fromUserId, amount); err != nil {
+		return domain.Transfer{}, err
+	}
+
+	transfer := domain.Transfer{
+		Id:                int64(len(history) + 1),
+		FromUserId:        fromUserId,
+		ToUserId:          toUserId,
+		Amount:            amount,
+		FromBalanceBefore: mockUser.Balance,
+		FromBalanceAfter:  mockUser.Balance - amount,
+		ToBalanceBefore:   mockRecipient.Balance,
+		ToBalanceAfter:    mockRecipient.Balance + amount,
+		CreatedAt:         time.Now(),
+	}
+
+	mockUser.Balance -= amount
+	mockRecipient.Balance += amount
+
+	transfers = append(transfers, transfer)
+
+	// Only the sender side is kept, history of the mock belongs to user 1
+	history = append(history, domain.Transaction{
+		Id:                 transfer.Id,
+		UserId:             fromUserId,
+		Type:               domain.TransactionTypeTransferOut,
+		Amount:             amount,
+		BalanceBefore:      transfer.FromBalanceBefore,
+		BalanceAfter:       transfer.FromBalanceAfter,
+		CreatedAt:          transfer.CreatedAt,
+		CounterpartyUserId: &transfer.ToUserId,
+	})
+
+	return transfer, nil
+}
+
+func (r *RepositoryMock) CreateHold(
+	_ context.Context,
+	userId int64,
+	amount int64,
+	ttl time.Duration,
+	requestId string,
+) (domain.Hold, error) {
+	if r.err != nil {
+		return domain.Hold{}, r.err
+	}
+
+	for _, h := range holds {
+		if h.UserId == userId && requestId == mockHoldRequestId {
+			return h, nil
+		}
+	}
+
+	if amount > mockUser.Balance-mockUser.HeldBalance {
+		return domain.Hold{}, InsufficientFundsError
+	}
+
+	h := domain.Hold{
+		Id:        int64(len(holds) + 1),
+		UserId:    userId,
+		Amount:    amount,
+		Status:    domain.HoldStatusActive,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+
+	mockUser.HeldBalance += amount
+	holds = append(holds, h)
+
+	return h, nil
+}
+
+func (r *RepositoryMock) GetHold(_ context.Context, userId int64, holdId int64) (domain.Hold, error) {
+	if r.err != nil {
+		return domain.Hold{}, r.err
+	}
+
+	for _, h := range holds {
+		if h.Id == holdId && h.UserId == userId {
+			return h, nil
+		}
+	}
+
+	return domain.Hold{}, HoldNotFoundError
+}
+
+func (r *RepositoryMock) CaptureHold(
+	_ context.Context,
+	userId int64,
+	holdId int64,
+	amount int64,
+	requestId string,
+) (domain.Hold, error) {
+	h, err := r.GetHold(context.Background(), userId, holdId)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if finishedBy(h, domain.HoldStatusCaptured, requestId) {
+		return h, nil
+	}
+
+	if h.Status != domain.HoldStatusActive || !h.ExpiresAt.After(time.Now()) {
+		return domain.Hold{}, HoldNotActiveError
+	}
+
+	if amount == 0 {
+		amount = h.Amount
+	}
+
+	if amount > h.Amount {
+		return domain.Hold{}, CaptureAmountError
+	}
+
+	if err := checkMockWithdrawalLimits(userId, amount); err != nil {
+		return domain.Hold{}, err
+	}
+
+	withdrawalId := int64(len(history) + 1)
+	history = append(history, domain.Transaction{
+		Id:            withdrawalId,
+		UserId:        userId,
+		Type:          domain.TransactionTypeWithdrawal,
+		Amount:        amount,
+		BalanceBefore: mockUser.Balance,
+		BalanceAfter:  mockUser.Balance - amount,
+		CreatedAt:     time.Now(),
+	})
+
+	mockUser.Balance -= amount
+	mockUser.HeldBalance -= h.Amount
+
+	h.Status = domain.HoldStatusCaptured
+	h.CapturedAmount = &amount
+	h.WithdrawalId = &withdrawalId
+	h.FinishRequestId = &requestId
+	holds[h.Id-1] = h
+
+	return h, nil
+}
+
+func (r *RepositoryMock) ReleaseHold(_ context.Context, userId int64, holdId int64, requestId string) (domain.Hold, error) {
+	h, err := r.GetHold(context.Background(), userId, holdId)
+	if err != nil {
+		return domain.Hold{}, err
+	}
+
+	if finishedBy(h, domain.HoldStatusReleased, requestId) {
+		return h, nil
+	}
+
+	if h.Status != domain.HoldStatusActive {
+		return domain.Hold{}, HoldNotActiveError
+	}
+
+	mockUser.HeldBalance -= h.Amount
+	h.Status = domain.HoldStatusReleased
+	h.FinishRequestId = &requestId
+	holds[h.Id-1] = h
+
+	return h, nil
+}
+
+func (r *RepositoryMock) GetExpiredHolds(_ context.Context, limit int) ([]domain.Hold, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var expired []domain.Hold
+	for _, h := range holds {
+		if h.Status == domain.HoldStatusActive && !h.ExpiresAt.After(time.Now()) && len(expired) < limit {
+			expired = append(expired, h)
+		}
+	}
+
+	return expired, nil
+}
+
+func (r *RepositoryMock) ExpireHold(_ context.Context, userId int64, holdId int64) (bool, error) {
+	h := holds[holdId-1]
+	if h.Status != domain.HoldStatusActive || h.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+
+	mockUser.HeldBalance -= h.Amount
+	h.Status = domain.HoldStatusExpired
+	holds[holdId-1] = h
+
+	return true, nil
+}
+
+func (r *RepositoryMock) GetUserBalanceHistory(
+	_ context.Context,
+	userId int64,
+	filter domain.HistoryFilter,
+) ([]domain.Transaction, error) {
+	if r.err != nil {
+		return []domain.Transaction{}, r.err
+	}
+
+	// PostgreSQL keeps timestamps with microsecond precision, the cursor relies on it
+	sorted := slices.Clone(history)
+	for i := range sorted {
+		sorted[i].CreatedAt = sorted[i].CreatedAt.Truncate(time.Microsecond)
+	}
+
+	slices.SortFunc(sorted, func(a, b domain.Transaction) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Id, a.Id)
+	})
+
+	var res []domain.Transaction
+	for _, t := range sorted {
+		switch {
+		case filter.From != nil && t.CreatedAt.Before(*filter.From),
+			filter.To != nil && !t.CreatedAt.Before(*filter.To),
+			filter.MinAmount != nil && t.Amount < *filter.MinAmount,
+			filter.MaxAmount != nil && t.Amount > *filter.MaxAmount:
+			continue
+		case filter.After != nil:
+			c := t.CreatedAt.Compare(filter.After.CreatedAt)
+			if c > 0 || (c == 0 && t.Id >= filter.After.Id) {
+				continue
+			}
+		}
+
+		if filter.Limit > 0 && len(res) == filter.Limit {
+			break
+		}
+
+		res = append(res, t)
+	}
+
+	return res, nil
+}
+
+func (r *RepositoryMock) StreamUserBalanceHistory(
+	ctx context.Context,
+	userId int64,
+	filter domain.HistoryFilter,
+	fn func(t domain.Transaction) error,
+) error {
+	res, err := r.GetUserBalanceHistory(ctx, userId, filter)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range res {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RepositoryMock) GetWithdrawalLimits(_ context.Context, userId *int64) (domain.WithdrawalLimits, error) {
+	if r.err != nil {
+		return domain.WithdrawalLimits{}, r.err
+	}
+
+	if userId == nil {
+		return globalWithdrawalLimits, nil
+	}
+
+	if l, ok := userWithdrawalLimits[*userId]; ok {
+		return l, nil
+	}
+
+	return domain.WithdrawalLimits{UserId: userId}, nil
+}
+
+func (r *RepositoryMock) SetWithdrawalLimits(_ context.Context, limits domain.WithdrawalLimits) (domain.WithdrawalLimits, error) {
 	if r.err != nil {
-		return []domain.Withdrawal{}, r.err
+		return domain.WithdrawalLimits{}, r.err
+	}
+
+	if limits.UserId == nil {
+		globalWithdrawalLimits = limits
+	} else {
+		userWithdrawalLimits[*limits.UserId] = limits
+	}
+
+	return limits, nil
+}
+
+func checkMockWithdrawalLimits(userId int64, amount int64) error {
+	global, user := globalWithdrawalLimits, userWithdrawalLimits[userId]
+
+	return checkWithdrawalLimits(global, user, amount, mockWithdrawalUsage(userId, global.CountWindow, user.CountWindow))
+}
+
+func mockWithdrawalUsage(userId int64, globalWindow *time.Duration, userWindow *time.Duration) domain.WithdrawalUsage {
+	var usage domain.WithdrawalUsage
+	now := time.Now()
+
+	within := func(t domain.Transaction, window *time.Duration) bool {
+		return window != nil && t.CreatedAt.After(now.Add(-*window))
+	}
+
+	for _, t := range history {
+		if t.UserId != userId || (t.Type != domain.TransactionTypeWithdrawal && t.Type != domain.TransactionTypeTransferOut) {
+			continue
+		}
+
+		if t.CreatedAt.After(now.Add(-24 * time.Hour)) {
+			usage.DailyAmount += t.Amount
+		}
+		if t.CreatedAt.After(now.AddDate(0, -1, 0)) {
+			usage.MonthlyAmount += t.Amount
+		}
+		if within(t, globalWindow) {
+			usage.GlobalCount++
+		}
+		if within(t, userWindow) {
+			usage.UserCount++
+		}
 	}
-	return history, nil
+
+	return usage
+}
+
+func resetWithdrawalLimits() {
+	globalWithdrawalLimits = domain.WithdrawalLimits{}
+	userWithdrawalLimits = make(map[int64]domain.WithdrawalLimits)
 }
 
 func seedBalanceHistory() {
 	for _, _ = range history {
-		history = append(history, domain.Withdrawal{
+		history = append(history, domain.Transaction{
+			Id:            int64(len(history) + 1),
 			UserId:        mockUser.Id,
+			Type:          domain.TransactionTypeWithdrawal,
 			Amount:        50,
 			BalanceBefore: mockUser.Balance,
 			BalanceAfter:  mockUser.Balance - 50,
@@ -171,6 +686,10 @@ func TestWithdrawFromBalanceIdempotency(t *testing.T) {
 			bodyFirstResponse.BalanceAfter, bodySecondResponse.BalanceAfter,
 		)
 	}
+
+	if bodyFirstResponse.Id == 0 || bodyFirstResponse.Id != bodySecondResponse.Id {
+		t.Fatalf("expected the same deposit id on replay, got %d and %d", bodyFirstResponse.Id, bodySecondResponse.Id)
+	}
 }
 
 func TestWithdrawFromUnexistingUserBalance(t *testing.T) {
@@ -299,37 +818,46 @@ func TestWithdrawFromBalanceErrorFromRepository(t *testing.T) {
 	}
 }
 
-func TestGetBalanceHistoryOk(t *testing.T) {
+func TestDepositToBalanceOk(t *testing.T) {
 	svc := &Service{
 		repository: &RepositoryMock{},
 		logger:     logger,
 	}
 
-	seedBalanceHistory()
-
 	handler := NewHandler(svc)
+
+	balanceBefore := mockUser.Balance
+
 	rec := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/balance/history", nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/deposit", strings.NewReader(`{"amount": 100}`))
 	req.SetPathValue("id", "1")
 
-	handler.GetBalanceHistory(rec, req)
+	handler.Deposit(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if rec.Header().Get("Idempotency-Key") == "" {
+		t.Fatal("expected generated Idempotency-Key header")
+	}
 
-	var response []BalanceHistoryResponseDTO
+	var response DepositBalanceResponseDTO
 	err := json.NewDecoder(rec.Body).Decode(&response)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+	if response.BalanceBefore != balanceBefore || response.BalanceAfter != balanceBefore+100 {
+		t.Fatalf("expected balance %d -> %d, got %d -> %d", balanceBefore, balanceBefore+100, response.BalanceBefore, response.BalanceAfter)
 	}
 
-	if len(response) != len(history) {
-		t.Fatalf("expected %d history entity, got %d", len(history), len(response))
+	if mockUser.Balance != balanceBefore+100 {
+		t.Fatalf("expected balance to be %d, got %d", balanceBefore+100, mockUser.Balance)
 	}
 }
 
-func TestGetBalanceHistoryForUnexisitingUser(t *testing.T) {
+func TestDepositToBalanceIdempotency(t *testing.T) {
 	svc := &Service{
 		repository: &RepositoryMock{},
 		logger:     logger,
@@ -337,49 +865,1090 @@ func TestGetBalanceHistoryForUnexisitingUser(t *testing.T) {
 
 	handler := NewHandler(svc)
 
-	rec := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/2/balance/history", nil)
-	req.SetPathValue("id", "2")
+	firstRec := httptest.NewRecorder()
+	firstReq := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/deposit", strings.NewReader(`{"amount": 70}`))
+	firstReq.SetPathValue("id", "1")
+	firstReq.Header.Set("Idempotency-Key", mockDepositRequestId)
 
-	handler.GetBalanceHistory(rec, req)
+	handler.Deposit(firstRec, firstReq)
 
-	if rec.Code != http.StatusNotFound {
-		t.Fatalf("expected 404, got %d", rec.Code)
+	var bodyFirstResponse DepositBalanceResponseDTO
+	err := json.NewDecoder(firstRec.Body).Decode(&bodyFirstResponse)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestGetBalanceHistoryWithInvalidUserId(t *testing.T) {
-	svc := &Service{
-		repository: &RepositoryMock{},
-		logger:     logger,
-	}
+	historyLen := len(history)
 
-	handler := NewHandler(svc)
+	secondRec := httptest.NewRecorder()
+	secondReq := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/deposit", strings.NewReader(`{"amount": 70}`))
+	secondReq.SetPathValue("id", "1")
+	secondReq.Header.Set("Idempotency-Key", mockDepositRequestId)
 
-	rec := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/test/balance/history", nil)
-	req.SetPathValue("id", "test")
+	handler.Deposit(secondRec, secondReq)
 
-	handler.GetBalanceHistory(rec, req)
+	var bodySecondResponse DepositBalanceResponseDTO
+	e := json.NewDecoder(secondRec.Body).Decode(&bodySecondResponse)
+	if e != nil {
+		t.Fatal(e)
+	}
 
-	var response string
-	err := json.NewDecoder(rec.Body).Decode(&response)
-	if err != nil {
-		t.Fatal(err)
+	if secondRec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", secondRec.Code)
 	}
 
-	if rec.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %d", rec.Code)
+	if len(history) != historyLen {
+		t.Fatalf("expected %d history entities, got %d", historyLen, len(history))
 	}
 
-	if response != "invalid user id" {
-		t.Fatalf("expected %s, got %s", "invalid user id", response)
+	if bodyFirstResponse.BalanceAfter != bodySecondResponse.BalanceAfter {
+		t.Fatalf(
+			"Balance from idempotent request not equal to balance from first request. Expected %d, got %d",
+			bodyFirstResponse.BalanceAfter, bodySecondResponse.BalanceAfter,
+		)
 	}
 }
 
-func TestGetBalanceHistoryErrorFromRepository(t *testing.T) {
+func TestDepositToUnexistingUserBalance(t *testing.T) {
 	svc := &Service{
-		repository: &RepositoryMock{err: errors.New("some error from repository")},
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/2/balance/deposit", strings.NewReader(`{"amount": 50}`))
+	req.SetPathValue("id", "2")
+
+	handler.Deposit(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestDepositToBalanceWithInvalidAmount(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/deposit", strings.NewReader(`{"amount": 0}`))
+	req.SetPathValue("id", "1")
+
+	handler.Deposit(rec, req)
+
+	var response string
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	if response != "invalid amount: Amount must be greater than 0" {
+		t.Fatalf("Expected %s, got %s", "invalid amount: Amount must be greater than 0", response)
+	}
+}
+
+func TestDepositToBalanceErrorFromRepository(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{err: errors.New("some error from repository")},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/deposit", strings.NewReader(`{"amount": 40}`))
+	req.SetPathValue("id", "1")
+
+	handler.Deposit(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
+
+func TestTransferBalanceOk(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	senderBalance := mockUser.Balance
+	recipientBalance := mockRecipient.Balance
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/transfer", strings.NewReader(`{"to_user_id": 3, "amount": 30}`))
+	req.SetPathValue("id", "1")
+	req.Header.Set("Idempotency-Key", mockTransferRequestId)
+
+	handler.Transfer(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response TransferBalanceResponseDTO
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.ToUserId != 3 || response.BalanceAfter != senderBalance-30 {
+		t.Fatalf("expected transfer to user 3 leaving %d, got %+v", senderBalance-30, response)
+	}
+
+	if mockUser.Balance != senderBalance-30 || mockRecipient.Balance != recipientBalance+30 {
+		t.Fatalf(
+			"expected balances %d and %d, got %d and %d",
+			senderBalance-30, recipientBalance+30, mockUser.Balance, mockRecipient.Balance,
+		)
+	}
+
+	last := history[len(history)-1]
+	if last.Type != domain.TransactionTypeTransferOut || last.Id != response.Id || *last.CounterpartyUserId != 3 {
+		t.Fatalf("expected transfer_out history entry linked to user 3, got %+v", last)
+	}
+}
+
+func TestTransferBalanceIdempotency(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	senderBalance := mockUser.Balance
+	historyLen := len(history)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/transfer", strings.NewReader(`{"to_user_id": 3, "amount": 30}`))
+	req.SetPathValue("id", "1")
+	req.Header.Set("Idempotency-Key", mockTransferRequestId)
+
+	handler.Transfer(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response TransferBalanceResponseDTO
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Id != transfers[0].Id {
+		t.Fatalf("expected transfer %d, got %d", transfers[0].Id, response.Id)
+	}
+
+	if mockUser.Balance != senderBalance || len(history) != historyLen {
+		t.Fatal("expected repeated transfer not to change the balance")
+	}
+}
+
+func TestTransferBalanceToUnexistingUser(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/transfer", strings.NewReader(`{"to_user_id": 2, "amount": 30}`))
+	req.SetPathValue("id", "1")
+
+	handler.Transfer(rec, req)
+
+	var response string
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+
+	if response != "Recipient not found" {
+		t.Fatalf("expected %s, got %s", "Recipient not found", response)
+	}
+}
+
+func TestTransferBalanceToSelf(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/transfer", strings.NewReader(`{"to_user_id": 1, "amount": 30}`))
+	req.SetPathValue("id", "1")
+
+	handler.Transfer(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestTransferBalanceInsufficientFunds(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/transfer", strings.NewReader(`{"to_user_id": 3, "amount": 100000}`))
+	req.SetPathValue("id", "1")
+
+	handler.Transfer(rec, req)
+
+	var response string
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	if response != "insufficient funds" {
+		t.Fatalf("expected %s, got %s", "insufficient funds", response)
+	}
+}
+
+func TestTransferBalanceErrorFromRepository(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{err: errors.New("some error from repository")},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/transfer", strings.NewReader(`{"to_user_id": 3, "amount": 30}`))
+	req.SetPathValue("id", "1")
+
+	handler.Transfer(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
+
+func newHoldRequest(t *testing.T, handler *Handler, body string, requestId string) (*httptest.ResponseRecorder, HoldResponseDTO) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/holds", strings.NewReader(body))
+	req.SetPathValue("id", "1")
+	if requestId != "" {
+		req.Header.Set("Idempotency-Key", requestId)
+	}
+
+	handler.CreateHold(rec, req)
+
+	var response HoldResponseDTO
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rec, response
+}
+
+func newHoldActionRequest(handler http.HandlerFunc, holdId string, body string, requestId string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/holds/"+holdId, strings.NewReader(body))
+	req.SetPathValue("id", "1")
+	req.SetPathValue("hold_id", holdId)
+	if requestId != "" {
+		req.Header.Set("Idempotency-Key", requestId)
+	}
+
+	handler(rec, req)
+
+	return rec
+}
+
+func TestCreateHoldOk(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	heldBefore := mockUser.HeldBalance
+
+	rec, hold := newHoldRequest(t, handler, `{"amount": 20, "ttl_seconds": 60}`, mockHoldRequestId)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if hold.Status != domain.HoldStatusActive || hold.Amount != 20 {
+		t.Fatalf("expected active hold of 20, got %+v", hold)
+	}
+
+	if time.Until(hold.ExpiresAt) > time.Minute {
+		t.Fatalf("expected hold to expire within a minute, got %s", hold.ExpiresAt)
+	}
+
+	balanceRec := httptest.NewRecorder()
+	balanceReq := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/balance", nil)
+	balanceReq.SetPathValue("id", "1")
+
+	handler.GetBalance(balanceRec, balanceReq)
+
+	var balance BalanceResponseDTO
+	if err := json.NewDecoder(balanceRec.Body).Decode(&balance); err != nil {
+		t.Fatal(err)
+	}
+
+	if balance.Held != heldBefore+20 || balance.Available != balance.Balance-balance.Held {
+		t.Fatalf("expected %d held, got %+v", heldBefore+20, balance)
+	}
+}
+
+func TestCreateHoldIdempotency(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	heldBefore := mockUser.HeldBalance
+
+	rec, hold := newHoldRequest(t, handler, `{"amount": 20}`, mockHoldRequestId)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if hold.Id != holds[0].Id || mockUser.HeldBalance != heldBefore {
+		t.Fatal("expected repeated hold request not to hold funds again")
+	}
+}
+
+func TestCreateHoldInsufficientFunds(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	// Held funds are not available, even though the total balance is enough
+	amount := mockUser.Balance - mockUser.HeldBalance + 1
+	if amount > mockUser.Balance {
+		t.Fatalf("expected some funds to be held")
+	}
+
+	rec, _ := newHoldRequest(t, handler, fmt.Sprintf(`{"amount": %d}`, amount), "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	withdrawRec := httptest.NewRecorder()
+	withdrawReq := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/withdraw", strings.NewReader(fmt.Sprintf(`{"amount": %d}`, amount)))
+	withdrawReq.SetPathValue("id", "1")
+
+	handler.Withdraw(withdrawRec, withdrawReq)
+
+	if withdrawRec.Code != http.StatusBadRequest {
+		t.Fatalf("expected withdrawal of held funds to fail with 400, got %d", withdrawRec.Code)
+	}
+}
+
+func TestCreateHoldWithInvalidTTL(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec, _ := newHoldRequest(t, handler, `{"amount": 20, "ttl_seconds": 100000000}`, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestCaptureHoldOk(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	balanceBefore := mockUser.Balance
+	heldBefore := mockUser.HeldBalance
+
+	rec := newHoldActionRequest(handler.CaptureHold, "1", `{"amount": 15}`, mockCaptureRequestId)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var hold HoldResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&hold); err != nil {
+		t.Fatal(err)
+	}
+
+	if hold.Status != domain.HoldStatusCaptured || *hold.CapturedAmount != 15 || hold.WithdrawalId == nil {
+		t.Fatalf("expected hold captured for 15 with a withdrawal, got %+v", hold)
+	}
+
+	// The rest of the hold is released
+	if mockUser.Balance != balanceBefore-15 || mockUser.HeldBalance != heldBefore-20 {
+		t.Fatalf("expected balance %d held %d, got %d held %d", balanceBefore-15, heldBefore-20, mockUser.Balance, mockUser.HeldBalance)
+	}
+
+	last := history[len(history)-1]
+	if last.Type != domain.TransactionTypeWithdrawal || last.Id != *hold.WithdrawalId {
+		t.Fatalf("expected capture to be recorded as a withdrawal, got %+v", last)
+	}
+
+	historyLen := len(history)
+
+	rec = newHoldActionRequest(handler.CaptureHold, "1", "", mockCaptureRequestId)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected repeated capture to return 200, got %d", rec.Code)
+	}
+
+	if len(history) != historyLen || mockUser.Balance != balanceBefore-15 {
+		t.Fatal("expected repeated capture not to debit the balance again")
+	}
+
+	rec = newHoldActionRequest(handler.CaptureHold, "1", "", "other-capture-request-id")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected capture with another key to return 409, got %d", rec.Code)
+	}
+
+	rec = newHoldActionRequest(handler.ReleaseHold, "1", "", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected release of captured hold to return 409, got %d", rec.Code)
+	}
+}
+
+func TestCaptureHoldAmountExceedsHold(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec, hold := newHoldRequest(t, handler, `{"amount": 10}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	rec = newHoldActionRequest(handler.CaptureHold, strconv.FormatInt(hold.Id, 10), `{"amount": 11}`, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestReleaseHoldOk(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	heldBefore := mockUser.HeldBalance
+	holdId := strconv.FormatInt(holds[len(holds)-1].Id, 10)
+
+	for range 2 {
+		rec := newHoldActionRequest(handler.ReleaseHold, holdId, "", mockReleaseRequestId)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	}
+
+	if rec := newHoldActionRequest(handler.ReleaseHold, holdId, "", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("expected release with another key to return 409, got %d", rec.Code)
+	}
+
+	if mockUser.HeldBalance != heldBefore-10 {
+		t.Fatalf("expected held balance %d, got %d", heldBefore-10, mockUser.HeldBalance)
+	}
+
+	rec := newHoldActionRequest(handler.CaptureHold, holdId, "", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected capture of released hold to return 409, got %d", rec.Code)
+	}
+}
+
+func TestCaptureUnexistingHold(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := newHoldActionRequest(handler.CaptureHold, "100", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	heldBefore := mockUser.HeldBalance
+
+	rec, hold := newHoldRequest(t, handler, `{"amount": 5}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	holds[hold.Id-1].ExpiresAt = time.Now().Add(-time.Second)
+
+	expired, err := svc.ExpireHolds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expired != 1 {
+		t.Fatalf("expected 1 expired hold, got %d", expired)
+	}
+
+	if holds[hold.Id-1].Status != domain.HoldStatusExpired || mockUser.HeldBalance != heldBefore {
+		t.Fatalf("expected hold to expire and release %d, got %+v", hold.Amount, holds[hold.Id-1])
+	}
+}
+
+func newRefundRequest(handler *Handler, withdrawalId string, body string, requestId string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/withdrawals/"+withdrawalId+"/refund", strings.NewReader(body))
+	req.SetPathValue("id", "1")
+	req.SetPathValue("withdrawal_id", withdrawalId)
+	if requestId != "" {
+		req.Header.Set("Idempotency-Key", requestId)
+	}
+
+	handler.RefundWithdrawal(rec, req)
+
+	return rec
+}
+
+func TestRefundWithdrawalOk(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	withdrawRec := httptest.NewRecorder()
+	withdrawReq := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/withdraw", strings.NewReader(`{"amount": 40}`))
+	withdrawReq.SetPathValue("id", "1")
+
+	handler.Withdraw(withdrawRec, withdrawReq)
+
+	var withdrawal WithdrawBalanceResponseDTO
+	if err := json.NewDecoder(withdrawRec.Body).Decode(&withdrawal); err != nil {
+		t.Fatal(err)
+	}
+
+	if withdrawal.Id == 0 {
+		t.Fatal("expected withdrawal id in response")
+	}
+
+	withdrawalId := strconv.FormatInt(withdrawal.Id, 10)
+	balanceBefore := mockUser.Balance
+
+	rec := newRefundRequest(handler, withdrawalId, `{"amount": 10}`, mockRefundRequestId)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var refund RefundResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&refund); err != nil {
+		t.Fatal(err)
+	}
+
+	if refund.WithdrawalId != withdrawal.Id || refund.Amount != 10 || mockUser.Balance != balanceBefore+10 {
+		t.Fatalf("expected refund of 10 linked to withdrawal %d, got %+v", withdrawal.Id, refund)
+	}
+
+	last := history[len(history)-1]
+	if last.Type != domain.TransactionTypeRefund || *last.WithdrawalId != withdrawal.Id {
+		t.Fatalf("expected refund history entry linked to withdrawal %d, got %+v", withdrawal.Id, last)
+	}
+
+	// Repeated request returns the same refund
+	rec = newRefundRequest(handler, withdrawalId, `{"amount": 10}`, mockRefundRequestId)
+	if rec.Code != http.StatusOK || mockUser.Balance != balanceBefore+10 {
+		t.Fatalf("expected idempotent refund, got %d with balance %d", rec.Code, mockUser.Balance)
+	}
+
+	// The same key can not be used for a refund of another withdrawal
+	otherRec := httptest.NewRecorder()
+	otherReq := httptest.NewRequest(http.MethodPost, "/api/v1/users/1/balance/withdraw", strings.NewReader(`{"amount": 5}`))
+	otherReq.SetPathValue("id", "1")
+	otherReq.Header.Set("Idempotency-Key", "other-withdrawal-request-id")
+
+	handler.Withdraw(otherRec, otherReq)
+
+	var other WithdrawBalanceResponseDTO
+	if err := json.NewDecoder(otherRec.Body).Decode(&other); err != nil {
+		t.Fatal(err)
+	}
+
+	balanceBefore -= other.Amount
+	balance := mockUser.Balance
+
+	rec = newRefundRequest(handler, strconv.FormatInt(other.Id, 10), `{"amount": 5}`, mockRefundRequestId)
+	if rec.Code != http.StatusConflict || mockUser.Balance != balance {
+		t.Fatalf("expected key reused for another withdrawal to return 409, got %d with balance %d", rec.Code, mockUser.Balance)
+	}
+
+	rec = newRefundRequest(handler, withdrawalId, `{"amount": 31}`, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected refund over the withdrawn amount to return 400, got %d", rec.Code)
+	}
+
+	// The rest is refunded without a body
+	rec = newRefundRequest(handler, withdrawalId, "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if mockUser.Balance != balanceBefore+40 {
+		t.Fatalf("expected balance %d, got %d", balanceBefore+40, mockUser.Balance)
+	}
+
+	rec = newRefundRequest(handler, withdrawalId, "", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected refund of refunded withdrawal to return 409, got %d", rec.Code)
+	}
+}
+
+func TestRefundUnexistingWithdrawal(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := newRefundRequest(handler, "1000", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestRefundWithdrawalWithInvalidId(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := newRefundRequest(handler, "test", "", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestGetBalanceHistoryOk(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	seedBalanceHistory()
+
+	handler := NewHandler(svc)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/balance/history", nil)
+	req.SetPathValue("id", "1")
+
+	handler.GetBalanceHistory(rec, req)
+
+	var response BalanceHistoryPageResponseDTO
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if len(response.Items) != len(history) {
+		t.Fatalf("expected %d history entity, got %d", len(history), len(response.Items))
+	}
+
+	if response.NextCursor != nil {
+		t.Fatalf("expected no next cursor, got %s", *response.NextCursor)
+	}
+
+	types := make(map[string]bool)
+	for _, h := range response.Items {
+		types[h.Type] = true
+	}
+
+	if !types[domain.TransactionTypeWithdrawal] || !types[domain.TransactionTypeDeposit] {
+		t.Fatalf("expected both withdrawals and deposits in history, got %v", types)
+	}
+}
+
+func getBalanceHistoryPage(t *testing.T, handler *Handler, query string) (*httptest.ResponseRecorder, BalanceHistoryPageResponseDTO) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/balance/history?"+query, nil)
+	req.SetPathValue("id", "1")
+
+	handler.GetBalanceHistory(rec, req)
+
+	var response BalanceHistoryPageResponseDTO
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rec, response
+}
+
+func TestGetBalanceHistoryPagination(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	seen := make(map[int64]bool)
+	query := "limit=3"
+	pages := 0
+
+	for {
+		rec, page := getBalanceHistoryPage(t, handler, query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+
+		pages++
+		if len(page.Items) > 3 {
+			t.Fatalf("expected at most 3 entities per page, got %d", len(page.Items))
+		}
+
+		for _, item := range page.Items {
+			if seen[item.Id] {
+				t.Fatalf("entity %d returned twice", item.Id)
+			}
+			seen[item.Id] = true
+		}
+
+		if page.NextCursor == nil {
+			break
+		}
+
+		query = "limit=3&cursor=" + *page.NextCursor
+	}
+
+	if len(seen) != len(history) {
+		t.Fatalf("expected %d history entities, got %d", len(history), len(seen))
+	}
+
+	if pages != (len(history)+2)/3 {
+		t.Fatalf("expected %d pages, got %d", (len(history)+2)/3, pages)
+	}
+}
+
+func TestGetBalanceHistoryFilters(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec, page := getBalanceHistoryPage(t, handler, "min_amount=20&max_amount=40")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if len(page.Items) == 0 {
+		t.Fatal("expected some history entities")
+	}
+
+	for _, item := range page.Items {
+		if item.Amount < 20 || item.Amount > 40 {
+			t.Fatalf("expected amount between 20 and 40, got %d", item.Amount)
+		}
+	}
+
+	from := time.Now().Add(time.Hour).Format(time.RFC3339)
+	rec, page = getBalanceHistoryPage(t, handler, "from="+url.QueryEscape(from))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if len(page.Items) != 0 {
+		t.Fatalf("expected no history entities from the future, got %d", len(page.Items))
+	}
+}
+
+func TestGetBalanceHistoryWithInvalidQuery(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=1001",
+		"cursor=test",
+		"from=yesterday",
+		"from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z",
+		"min_amount=-1",
+		"min_amount=50&max_amount=10",
+	} {
+		rec, _ := getBalanceHistoryPage(t, handler, query)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func exportBalanceHistory(t *testing.T, handler *Handler, userId string, query string, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userId+"/balance/history/export?"+query, nil)
+	req.SetPathValue("id", userId)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	handler.ExportBalanceHistory(rec, req)
+
+	return rec
+}
+
+func TestExportBalanceHistoryAsCSV(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := exportBalanceHistory(t, handler, "1", "", "")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("expected text/csv content type, got %s", ct)
+	}
+
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") || !strings.Contains(cd, ".csv") {
+		t.Fatalf("expected csv attachment, got %s", cd)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(history)+1 {
+		t.Fatalf("expected header and %d rows, got %d records", len(history), len(records))
+	}
+
+	if records[0][0] != "id" || records[0][2] != "type" {
+		t.Fatalf("unexpected header %v", records[0])
+	}
+}
+
+func TestExportBalanceHistoryAsNDJSON(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := exportBalanceHistory(t, handler, "1", "", "application/json;q=0.9, application/x-ndjson")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("expected application/x-ndjson content type, got %s", ct)
+	}
+
+	decoder := json.NewDecoder(rec.Body)
+	count := 0
+	for decoder.More() {
+		var entry BalanceHistoryResponseDTO
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+
+	if count != len(history) {
+		t.Fatalf("expected %d entries, got %d", len(history), count)
+	}
+}
+
+func TestExportBalanceHistoryWithPeriod(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	from := time.Now().Add(time.Hour).Format(time.RFC3339)
+	rec := exportBalanceHistory(t, handler, "1", "format=csv&from="+url.QueryEscape(from), "")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected only the header, got %d records", len(records))
+	}
+
+	rec = exportBalanceHistory(t, handler, "1", "from=yesterday", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestExportBalanceHistoryWithUnsupportedFormat(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := exportBalanceHistory(t, handler, "1", "", "application/xml")
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406, got %d", rec.Code)
+	}
+
+	rec = exportBalanceHistory(t, handler, "1", "format=xlsx", "")
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406, got %d", rec.Code)
+	}
+}
+
+func TestExportBalanceHistoryForUnexisitingUser(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := exportBalanceHistory(t, handler, "2", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+
+	if cd := rec.Header().Get("Content-Disposition"); cd != "" {
+		t.Fatalf("expected no attachment for an error, got %s", cd)
+	}
+}
+
+func TestGetBalanceHistoryForUnexisitingUser(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/2/balance/history", nil)
+	req.SetPathValue("id", "2")
+
+	handler.GetBalanceHistory(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestGetBalanceHistoryWithInvalidUserId(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	}
+
+	handler := NewHandler(svc)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/test/balance/history", nil)
+	req.SetPathValue("id", "test")
+
+	handler.GetBalanceHistory(rec, req)
+
+	var response string
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	if response != "invalid user id" {
+		t.Fatalf("expected %s, got %s", "invalid user id", response)
+	}
+}
+
+func TestGetBalanceHistoryErrorFromRepository(t *testing.T) {
+	svc := &Service{
+		repository: &RepositoryMock{err: errors.New("some error from repository")},
 		logger:     logger,
 	}
 
@@ -395,3 +1964,283 @@ func TestGetBalanceHistoryErrorFromRepository(t *testing.T) {
 		t.Fatalf("expected 500, got %d", rec.Code)
 	}
 }
+
+func setWithdrawalLimits(t *testing.T, handler *Handler, userId string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	path := "/api/v1/withdrawal-limits"
+	if userId != "" {
+		path = "/api/v1/users/" + userId + "/balance/withdrawal-limits"
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+
+	if userId == "" {
+		handler.SetGlobalWithdrawalLimits(rec, req)
+	} else {
+		req.SetPathValue("id", userId)
+		handler.SetUserWithdrawalLimits(rec, req)
+	}
+
+	return rec
+}
+
+func withdrawWithLimits(t *testing.T, handler *Handler, amount int64) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/users/1/balance/withdraw",
+		strings.NewReader(fmt.Sprintf(`{"amount": %d}`, amount)),
+	)
+	req.SetPathValue("id", "1")
+
+	handler.Withdraw(rec, req)
+
+	return rec
+}
+
+func newLimitsHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	balance := mockUser.Balance
+	mockUser.Balance = 1000
+
+	t.Cleanup(func() {
+		mockUser.Balance = balance
+		resetWithdrawalLimits()
+	})
+
+	return NewHandler(&Service{
+		repository: &RepositoryMock{},
+		logger:     logger,
+	})
+}
+
+func TestWithdrawOverMaxAmountLimit(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	if rec := setWithdrawalLimits(t, handler, "", `{"max_amount": 10}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	rec := withdrawWithLimits(t, handler, 11)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+
+	var message string
+	if err := json.NewDecoder(rec.Body).Decode(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(message, "max_amount (global)") {
+		t.Fatalf("expected message to name the global max_amount limit, got %s", message)
+	}
+
+	if rec := withdrawWithLimits(t, handler, 10); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestWithdrawWithUserAndGlobalLimits(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	setWithdrawalLimits(t, handler, "", `{"max_amount": 10}`)
+	setWithdrawalLimits(t, handler, "1", `{"max_amount": 100}`)
+
+	// A user limit can not raise the global one
+	rec := withdrawWithLimits(t, handler, 11)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "max_amount (global)") {
+		t.Fatalf("expected message to name the global max_amount limit, got %s", rec.Body.String())
+	}
+
+	// The stricter limit is reported when both are exceeded
+	setWithdrawalLimits(t, handler, "1", `{"max_amount": 5}`)
+
+	rec = withdrawWithLimits(t, handler, 11)
+	if !strings.Contains(rec.Body.String(), "max_amount (user)") {
+		t.Fatalf("expected message to name the user max_amount limit, got %s", rec.Body.String())
+	}
+
+	if rec := withdrawWithLimits(t, handler, 5); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestWithdrawOverDailyAmountLimit(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	usage := mockWithdrawalUsage(mockUser.Id, nil, nil)
+	body := fmt.Sprintf(`{"daily_amount": %d}`, usage.DailyAmount+5)
+	if rec := setWithdrawalLimits(t, handler, "1", body); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if rec := withdrawWithLimits(t, handler, 5); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	balance := mockUser.Balance
+
+	rec := withdrawWithLimits(t, handler, 1)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "daily_amount (user)") {
+		t.Fatalf("expected message to name the user daily_amount limit, got %s", rec.Body.String())
+	}
+
+	if mockUser.Balance != balance {
+		t.Fatalf("expected balance to stay %d, got %d", balance, mockUser.Balance)
+	}
+}
+
+func TestWithdrawOverCountLimit(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	window := time.Hour
+	usage := mockWithdrawalUsage(mockUser.Id, &window, nil)
+	body := fmt.Sprintf(`{"max_count": %d, "count_window_seconds": 3600}`, usage.GlobalCount+1)
+	setWithdrawalLimits(t, handler, "", body)
+
+	if rec := withdrawWithLimits(t, handler, 1); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	rec := withdrawWithLimits(t, handler, 1)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "max_count (global)") {
+		t.Fatalf("expected message to name the global max_count limit, got %s", rec.Body.String())
+	}
+}
+
+func TestGetWithdrawalLimits(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	setWithdrawalLimits(t, handler, "1", `{"monthly_amount": 500, "max_count": 3, "count_window_seconds": 60}`)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1/balance/withdrawal-limits", nil)
+	req.SetPathValue("id", "1")
+
+	handler.GetUserWithdrawalLimits(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var response WithdrawalLimitsResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.UserId == nil || *response.UserId != mockUser.Id {
+		t.Fatalf("expected limits of user %d, got %v", mockUser.Id, response.UserId)
+	}
+
+	if response.MaxAmount != nil || response.MonthlyAmount == nil || *response.MonthlyAmount != 500 {
+		t.Fatalf("unexpected amount limits %+v", response)
+	}
+
+	if response.CountWindowSeconds == nil || *response.CountWindowSeconds != 60 {
+		t.Fatalf("expected count window of 60 seconds, got %v", response.CountWindowSeconds)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/withdrawal-limits", nil)
+
+	handler.GetGlobalWithdrawalLimits(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestSetWithdrawalLimitsWithInvalidBody(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	for _, body := range []string{
+		`{"max_amount": 0}`,
+		`{"daily_amount": -10}`,
+		`{"max_count": 5}`,
+		`{"count_window_seconds": 60}`,
+		`{"max_amount": "test"}`,
+		`{"max_count": 2147483648, "count_window_seconds": 60}`,
+		`{"max_count": 5, "count_window_seconds": 100000000}`,
+	} {
+		rec := setWithdrawalLimits(t, handler, "", body)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestSetWithdrawalLimitsForUnexisitingUser(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	rec := setWithdrawalLimits(t, handler, "2", `{"max_amount": 10}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestCaptureHoldOverWithdrawalLimit(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	rec, hold := newHoldRequest(t, handler, `{"amount": 50}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	setWithdrawalLimits(t, handler, "", `{"max_amount": 10}`)
+
+	holdId := strconv.FormatInt(hold.Id, 10)
+
+	rec = newHoldActionRequest(handler.CaptureHold, holdId, "", "")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "max_amount (global)") {
+		t.Fatalf("expected message to name the global max_amount limit, got %s", rec.Body.String())
+	}
+
+	if rec := newHoldActionRequest(handler.ReleaseHold, holdId, "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestTransferOverWithdrawalLimit(t *testing.T) {
+	handler := newLimitsHandler(t)
+
+	setWithdrawalLimits(t, handler, "1", `{"max_amount": 10}`)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/users/1/balance/transfer",
+		strings.NewReader(`{"to_user_id": 3, "amount": 11}`),
+	)
+	req.SetPathValue("id", "1")
+
+	handler.Transfer(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "max_amount (user)") {
+		t.Fatalf("expected message to name the user max_amount limit, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Webhook struct {
+	Id         int64
+	URL        string
+	Secret     string
+	EventTypes []string
+	CreatedAt  time.Time
+	UpdatedAt  *time.Time
+}
+
+// Delivery is a single event queued for a single webhook
+type Delivery struct {
+	Id             int64
+	WebhookId      int64
+	EventId        int64
+	EventType      string
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode *int
+	LastError      *string
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+}
+
+// PendingDelivery is a claimed delivery with everything needed to send it
+type PendingDelivery struct {
+	Id             int64
+	WebhookId      int64
+	EventId        int64
+	EventType      string
+	Attempts       int
+	URL            string
+	Secret         string
+	Payload        json.RawMessage
+	EventCreatedAt time.Time
+}
+
+type Attempt struct {
+	DeliveryId int64
+	Attempt    int
+	StatusCode *int
+	Error      *string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
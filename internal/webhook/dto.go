@@ -0,0 +1,41 @@
+package webhook
+
+import "time"
+
+type CreateWebhookRequestBody struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+type WebhookResponseDTO struct {
+	Id         int64      `json:"id"`
+	URL        string     `json:"url"`
+	EventTypes []string   `json:"event_types"`
+	Secret     string     `json:"secret,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+type DeliveryResponseDTO struct {
+	Id             int64                `json:"id"`
+	WebhookId      int64                `json:"webhook_id"`
+	EventId        int64                `json:"event_id"`
+	EventType      string               `json:"event_type"`
+	Status         string               `json:"status"`
+	Attempts       int                  `json:"attempts"`
+	NextAttemptAt  *time.Time           `json:"next_attempt_at"`
+	LastStatusCode *int                 `json:"last_status_code"`
+	LastError      *string              `json:"last_error"`
+	DeliveredAt    *time.Time           `json:"delivered_at"`
+	CreatedAt      time.Time            `json:"created_at"`
+	AttemptsLog    []AttemptResponseDTO `json:"attempts_log,omitempty"`
+}
+
+type AttemptResponseDTO struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"`
+	Error      *string   `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
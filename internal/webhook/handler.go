@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/pkg/render"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultDeliveriesLimit = 100
+	MaxDeliveriesLimit     = 1000
+	MinSecretLength        = 16
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var body CreateWebhookRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validateCreateBody(&body); err != nil {
+		render.JSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, e := h.service.CreateWebhook(ctx, body)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusCreated)
+}
+
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, e := h.service.GetWebhooks(ctx)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhookId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	res, e := h.service.GetWebhook(ctx, webhookId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhookId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	if e := h.service.DeleteWebhook(ctx, webhookId); e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhookId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != StatusPending && status != StatusSucceeded && status != StatusFailed {
+		render.JSON(w, "invalid status: must be one of pending, succeeded, failed", http.StatusBadRequest)
+		return
+	}
+
+	limit := DefaultDeliveriesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > MaxDeliveriesLimit {
+			render.JSON(w, fmt.Sprintf("invalid limit: must be between 1 and %d", MaxDeliveriesLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, e := h.service.GetDeliveries(ctx, webhookId, status, limit)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	webhookId, err := h.parseId(r, "id")
+	if err != nil {
+		render.JSON(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	deliveryId, err := h.parseId(r, "delivery_id")
+	if err != nil {
+		render.JSON(w, "invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	res, e := h.service.GetDelivery(ctx, webhookId, deliveryId)
+	if e != nil {
+		render.JSON(w, e.Message, e.Code)
+		return
+	}
+
+	render.JSON(w, res, http.StatusOK)
+}
+
+func (h *Handler) validateCreateBody(body *CreateWebhookRequestBody) error {
+	if err := validateTargetURL(body.URL); err != nil {
+		return err
+	}
+
+	if len(body.EventTypes) == 0 {
+		return errors.New("invalid event_types: must not be empty")
+	}
+
+	for _, eventType := range body.EventTypes {
+		if _, ok := eventTypes[eventType]; !ok {
+			return fmt.Errorf("invalid event_types: unknown event type %s", eventType)
+		}
+	}
+
+	slices.Sort(body.EventTypes)
+	body.EventTypes = slices.Compact(body.EventTypes)
+
+	if body.Secret != "" && len(body.Secret) < MinSecretLength {
+		return fmt.Errorf("invalid secret: must be at least %d characters", MinSecretLength)
+	}
+
+	return nil
+}
+
+func (h *Handler) parseId(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid id")
+	}
+
+	return id, nil
+}
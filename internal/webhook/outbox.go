@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventBalanceWithdrawn   = "balance.withdrawn"
+	EventBalanceDeposited   = "balance.deposited"
+	EventBalanceTransferred = "balance.transferred"
+	EventBalanceRefunded    = "balance.refunded"
+	EventCatalogRefreshed   = "items.catalog_refreshed"
+)
+
+var eventTypes = map[string]struct{}{
+	EventBalanceWithdrawn:   {},
+	EventBalanceDeposited:   {},
+	EventBalanceTransferred: {},
+	EventBalanceRefunded:    {},
+	EventCatalogRefreshed:   {},
+}
+
+// Execer is implemented by both *sql.DB and *sql.Tx, so events can be written
+// in the same transaction as the change they describe.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type BalanceEventData struct {
+	UserId        int64     `json:"user_id"`
+	Amount        int64     `json:"amount"`
+	BalanceBefore int64     `json:"balance_before"`
+	BalanceAfter  int64     `json:"balance_after"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type RefundEventData struct {
+	RefundId      int64     `json:"refund_id"`
+	WithdrawalId  int64     `json:"withdrawal_id"`
+	UserId        int64     `json:"user_id"`
+	Amount        int64     `json:"amount"`
+	BalanceBefore int64     `json:"balance_before"`
+	BalanceAfter  int64     `json:"balance_after"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type TransferEventData struct {
+	TransferId int64     `json:"transfer_id"`
+	FromUserId int64     `json:"from_user_id"`
+	ToUserId   int64     `json:"to_user_id"`
+	Amount     int64     `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CatalogEventData struct {
+	AppId       int       `json:"app_id"`
+	Currency    string    `json:"currency"`
+	ItemsCount  int       `json:"items_count"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// Enqueue writes the event to the outbox; the worker fans it out to the
+// subscribed webhooks.
+func Enqueue(ctx context.Context, db Execer, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO webhook_outbox(event_type, payload)
+		VALUES ($1, $2)
+	`, eventType, payload)
+
+	return err
+}
@@ -0,0 +1,312 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook/domain"
+	"github.com/lib/pq"
+	"time"
+)
+
+const webhookColumns = `
+	id, url, secret, event_types, created_at, updated_at
+`
+
+const deliveryColumns = `
+	id, webhook_id, event_id, event_type, status, attempts, next_attempt_at,
+	last_status_code, last_error, delivered_at, created_at
+`
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row scanner) (domain.Webhook, error) {
+	var w domain.Webhook
+	err := row.Scan(&w.Id, &w.URL, &w.Secret, pq.Array(&w.EventTypes), &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+func scanDelivery(row scanner) (domain.Delivery, error) {
+	var d domain.Delivery
+	err := row.Scan(
+		&d.Id,
+		&d.WebhookId,
+		&d.EventId,
+		&d.EventType,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.DeliveredAt,
+		&d.CreatedAt,
+	)
+	return d, err
+}
+
+func (r *Repository) CreateWebhook(ctx context.Context, w domain.Webhook) (domain.Webhook, error) {
+	row := r.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks(url, secret, event_types)
+		VALUES ($1, $2, $3)
+		RETURNING `+webhookColumns,
+		w.URL, w.Secret, pq.Array(w.EventTypes),
+	)
+
+	return scanWebhook(row)
+}
+
+func (r *Repository) GetWebhooks(ctx context.Context) ([]domain.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []domain.Webhook
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *Repository) GetWebhook(ctx context.Context, webhookId int64) (domain.Webhook, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, webhookId)
+
+	return scanWebhook(row)
+}
+
+func (r *Repository) DeleteWebhook(ctx context.Context, webhookId int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, webhookId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *Repository) GetDeliveries(ctx context.Context, webhookId int64, status string, limit int) ([]domain.Delivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2::varchar = '' OR status = $2::varchar)
+		ORDER BY id DESC
+		LIMIT $3
+	`, webhookId, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.Delivery
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *Repository) GetDelivery(ctx context.Context, webhookId int64, deliveryId int64) (domain.Delivery, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND id = $2
+	`, webhookId, deliveryId)
+
+	return scanDelivery(row)
+}
+
+func (r *Repository) GetDeliveryAttempts(ctx context.Context, deliveryId int64) ([]domain.Attempt, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT delivery_id, attempt, status_code, error, duration_ms, created_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY attempt
+	`, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []domain.Attempt
+
+	for rows.Next() {
+		var (
+			a        domain.Attempt
+			duration int64
+		)
+
+		if err := rows.Scan(&a.DeliveryId, &a.Attempt, &a.StatusCode, &a.Error, &duration, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		a.Duration = time.Duration(duration) * time.Millisecond
+		attempts = append(attempts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (r *Repository) EnqueueEvent(ctx context.Context, eventType string, data any) error {
+	return Enqueue(ctx, r.db, eventType, data)
+}
+
+// DispatchEvents fans pending outbox events out into one delivery per
+// subscribed webhook and marks the events as dispatched.
+func (r *Repository) DispatchEvents(ctx context.Context, limit int) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		WITH events AS (
+			SELECT id, event_type
+			FROM webhook_outbox
+			WHERE dispatched_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), fanout AS (
+			INSERT INTO webhook_deliveries(webhook_id, event_id, event_type)
+			SELECT w.id, e.id, e.event_type
+			FROM events e
+			JOIN webhooks w ON e.event_type = ANY(w.event_types)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING
+		)
+		UPDATE webhook_outbox
+		SET dispatched_at = now()
+		WHERE id IN (SELECT id FROM events)
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// ClaimDeliveries takes due deliveries and pushes their next attempt forward
+// by lease, so other workers skip them while they are being sent.
+func (r *Repository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, webhooks w, webhook_outbox e
+		WHERE d.id = due.id AND w.id = d.webhook_id AND e.id = d.event_id
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.attempts, w.url, w.secret, e.payload, e.created_at
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.PendingDelivery
+
+	for rows.Next() {
+		var d domain.PendingDelivery
+
+		err := rows.Scan(
+			&d.Id,
+			&d.WebhookId,
+			&d.EventId,
+			&d.EventType,
+			&d.Attempts,
+			&d.URL,
+			&d.Secret,
+			&d.Payload,
+			&d.EventCreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt appends the attempt to the delivery log and moves the
+// delivery to its new status.
+func (r *Repository) RecordAttempt(ctx context.Context, a domain.Attempt, status string, nextAttemptAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)
+	`, a.DeliveryId, a.Attempt, a.StatusCode, a.Error, a.Duration.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2::varchar,
+		    attempts = $3,
+		    next_attempt_at = $4,
+		    last_status_code = $5,
+		    last_error = $6,
+		    delivered_at = CASE WHEN $2::varchar = 'succeeded' THEN now() END
+		WHERE id = $1
+	`, a.DeliveryId, status, a.Attempt, nextAttemptAt, a.StatusCode, a.Error)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
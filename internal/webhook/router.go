@@ -0,0 +1,12 @@
+package webhook
+
+import "net/http"
+
+func RegisterRoutes(mux *http.ServeMux, h *Handler) {
+	mux.HandleFunc("POST /webhooks", h.CreateWebhook)
+	mux.HandleFunc("GET /webhooks", h.GetWebhooks)
+	mux.HandleFunc("GET /webhooks/{id}", h.GetWebhook)
+	mux.HandleFunc("DELETE /webhooks/{id}", h.DeleteWebhook)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", h.GetDeliveries)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries/{delivery_id}", h.GetDelivery)
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook/domain"
+	customError "github.com/bdzhalalov/kolikosoft-trade/pkg/error"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type RepositoryInterface interface {
+	CreateWebhook(ctx context.Context, w domain.Webhook) (domain.Webhook, error)
+	GetWebhooks(ctx context.Context) ([]domain.Webhook, error)
+	GetWebhook(ctx context.Context, webhookId int64) (domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookId int64) error
+	GetDeliveries(ctx context.Context, webhookId int64, status string, limit int) ([]domain.Delivery, error)
+	GetDelivery(ctx context.Context, webhookId int64, deliveryId int64) (domain.Delivery, error)
+	GetDeliveryAttempts(ctx context.Context, deliveryId int64) ([]domain.Attempt, error)
+	EnqueueEvent(ctx context.Context, eventType string, data any) error
+}
+
+type Service struct {
+	logger     *logrus.Logger
+	repository RepositoryInterface
+}
+
+func NewService(logger *logrus.Logger, repository RepositoryInterface) *Service {
+	return &Service{
+		logger,
+		repository,
+	}
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, data CreateWebhookRequestBody) (WebhookResponseDTO, *customError.BaseError) {
+	secret := data.Secret
+	if secret == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			s.logger.Errorf("Error while generating webhook secret: %s", err)
+			return WebhookResponseDTO{}, (&customError.InternalServerError{}).New()
+		}
+		secret = hex.EncodeToString(raw)
+	}
+
+	res, err := s.repository.CreateWebhook(ctx, domain.Webhook{
+		URL:        data.URL,
+		Secret:     secret,
+		EventTypes: data.EventTypes,
+	})
+	if err != nil {
+		s.logger.Errorf("Error while creating webhook: %s", err)
+		return WebhookResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	// The secret is only returned once, on registration
+	dto := s.getWebhookDTO(res)
+	dto.Secret = res.Secret
+
+	return dto, nil
+}
+
+func (s *Service) GetWebhooks(ctx context.Context) ([]WebhookResponseDTO, *customError.BaseError) {
+	res, err := s.repository.GetWebhooks(ctx)
+	if err != nil {
+		s.logger.Errorf("Error while getting webhooks: %s", err)
+		return []WebhookResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	DTOs := make([]WebhookResponseDTO, 0, len(res))
+	for _, w := range res {
+		DTOs = append(DTOs, s.getWebhookDTO(w))
+	}
+
+	return DTOs, nil
+}
+
+func (s *Service) GetWebhook(ctx context.Context, webhookId int64) (WebhookResponseDTO, *customError.BaseError) {
+	res, err := s.repository.GetWebhook(ctx, webhookId)
+	if err != nil {
+		return WebhookResponseDTO{}, s.handleError(err, "Webhook not found", "Error while getting webhook by ID: %s")
+	}
+
+	return s.getWebhookDTO(res), nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, webhookId int64) *customError.BaseError {
+	if err := s.repository.DeleteWebhook(ctx, webhookId); err != nil {
+		return s.handleError(err, "Webhook not found", "Error while deleting webhook: %s")
+	}
+
+	return nil
+}
+
+func (s *Service) GetDeliveries(
+	ctx context.Context,
+	webhookId int64,
+	status string,
+	limit int,
+) ([]DeliveryResponseDTO, *customError.BaseError) {
+	if _, e := s.GetWebhook(ctx, webhookId); e != nil {
+		return []DeliveryResponseDTO{}, e
+	}
+
+	res, err := s.repository.GetDeliveries(ctx, webhookId, status, limit)
+	if err != nil {
+		s.logger.Errorf("Error while getting webhook deliveries: %s", err)
+		return []DeliveryResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	DTOs := make([]DeliveryResponseDTO, 0, len(res))
+	for _, d := range res {
+		DTOs = append(DTOs, s.getDeliveryDTO(d))
+	}
+
+	return DTOs, nil
+}
+
+func (s *Service) GetDelivery(ctx context.Context, webhookId int64, deliveryId int64) (DeliveryResponseDTO, *customError.BaseError) {
+	res, err := s.repository.GetDelivery(ctx, webhookId, deliveryId)
+	if err != nil {
+		return DeliveryResponseDTO{}, s.handleError(err, "Delivery not found", "Error while getting webhook delivery by ID: %s")
+	}
+
+	attempts, err := s.repository.GetDeliveryAttempts(ctx, deliveryId)
+	if err != nil {
+		s.logger.Errorf("Error while getting webhook delivery attempts: %s", err)
+		return DeliveryResponseDTO{}, (&customError.InternalServerError{}).New()
+	}
+
+	dto := s.getDeliveryDTO(res)
+	dto.AttemptsLog = make([]AttemptResponseDTO, 0, len(attempts))
+
+	for _, a := range attempts {
+		dto.AttemptsLog = append(dto.AttemptsLog, AttemptResponseDTO{
+			Attempt:    a.Attempt,
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+			DurationMs: a.Duration.Milliseconds(),
+			CreatedAt:  a.CreatedAt,
+		})
+	}
+
+	return dto, nil
+}
+
+// OnCatalogRefresh publishes an event for every refreshed catalog. It writes
+// to the outbox, so it is registered behind an item.QueuedListener.
+func (s *Service) OnCatalogRefresh(
+	ctx context.Context,
+	appId int,
+	currency string,
+	items []item.GetItemsResponseDto,
+	refreshedAt time.Time,
+) {
+	err := s.repository.EnqueueEvent(ctx, EventCatalogRefreshed, CatalogEventData{
+		AppId:       appId,
+		Currency:    currency,
+		ItemsCount:  len(items),
+		RefreshedAt: refreshedAt.UTC(),
+	})
+	if err != nil {
+		s.logger.Errorf("Error while enqueuing catalog webhook event: %s", err)
+	}
+}
+
+func (s *Service) handleError(err error, notFound string, message string) *customError.BaseError {
+	if errors.Is(err, sql.ErrNoRows) {
+		return (&customError.NotFoundError{}).New(notFound)
+	}
+
+	s.logger.Errorf(message, err)
+
+	return (&customError.InternalServerError{}).New()
+}
+
+func (s *Service) getWebhookDTO(w domain.Webhook) WebhookResponseDTO {
+	return WebhookResponseDTO{
+		Id:         w.Id,
+		URL:        w.URL,
+		EventTypes: w.EventTypes,
+		CreatedAt:  w.CreatedAt,
+		UpdatedAt:  w.UpdatedAt,
+	}
+}
+
+func (s *Service) getDeliveryDTO(d domain.Delivery) DeliveryResponseDTO {
+	dto := DeliveryResponseDTO{
+		Id:             d.Id,
+		WebhookId:      d.WebhookId,
+		EventId:        d.EventId,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+
+	if d.Status == StatusPending {
+		dto.NextAttemptAt = &d.NextAttemptAt
+	}
+
+	return dto
+}
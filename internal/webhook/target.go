@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ForbiddenAddressError = errors.New("webhook target address is not public")
+
+// reservedPrefixes are not covered by the netip helpers but must not be
+// reachable from deliveries either: "this network", carrier-grade NAT,
+// IETF protocol assignments, benchmarking and the reserved class E range.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// isPublicAddr reports whether deliveries may connect to addr. Loopback,
+// private, link-local (cloud metadata lives there), multicast and reserved
+// addresses are refused.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateTargetURL rejects webhook URLs that are not absolute http or https
+// URLs or that point at a local host. Host names are checked again when a
+// delivery connects, after they are resolved.
+func validateTargetURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid url: must be an absolute http or https URL")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("invalid url: must not point at a local host")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddr(addr) {
+		return errors.New("invalid url: must not point at a private or loopback address")
+	}
+
+	return nil
+}
+
+// NewDeliveryClient returns the HTTP client deliveries are sent with. It
+// refuses to connect to non-public addresses, so a host name resolving to an
+// internal address is rejected as well, redirects included. Proxies from the
+// environment are not used, they would hide the target address.
+func NewDeliveryClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ForbiddenAddressError, addrPort.Addr())
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,546 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/item"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook/domain"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var logger = logrus.New()
+
+type outboxEvent struct {
+	id         int64
+	eventType  string
+	payload    json.RawMessage
+	createdAt  time.Time
+	dispatched bool
+}
+
+type repositoryMock struct {
+	mu         sync.Mutex
+	webhooks   []domain.Webhook
+	events     []outboxEvent
+	deliveries []domain.Delivery
+	attempts   []domain.Attempt
+}
+
+func (r *repositoryMock) CreateWebhook(_ context.Context, w domain.Webhook) (domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w.Id = int64(len(r.webhooks) + 1)
+	w.CreatedAt = time.Now()
+	r.webhooks = append(r.webhooks, w)
+
+	return w, nil
+}
+
+func (r *repositoryMock) GetWebhooks(_ context.Context) ([]domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.webhooks), nil
+}
+
+func (r *repositoryMock) GetWebhook(_ context.Context, webhookId int64) (domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, w := range r.webhooks {
+		if w.Id == webhookId {
+			return w, nil
+		}
+	}
+
+	return domain.Webhook{}, sql.ErrNoRows
+}
+
+func (r *repositoryMock) DeleteWebhook(_ context.Context, webhookId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, w := range r.webhooks {
+		if w.Id == webhookId {
+			r.webhooks = slices.Delete(r.webhooks, i, i+1)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (r *repositoryMock) GetDeliveries(_ context.Context, webhookId int64, status string, limit int) ([]domain.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deliveries []domain.Delivery
+	for _, d := range r.deliveries {
+		if d.WebhookId == webhookId && (status == "" || d.Status == status) && len(deliveries) < limit {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (r *repositoryMock) GetDelivery(_ context.Context, webhookId int64, deliveryId int64) (domain.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deliveries {
+		if d.WebhookId == webhookId && d.Id == deliveryId {
+			return d, nil
+		}
+	}
+
+	return domain.Delivery{}, sql.ErrNoRows
+}
+
+func (r *repositoryMock) GetDeliveryAttempts(_ context.Context, deliveryId int64) ([]domain.Attempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var attempts []domain.Attempt
+	for _, a := range r.attempts {
+		if a.DeliveryId == deliveryId {
+			attempts = append(attempts, a)
+		}
+	}
+
+	return attempts, nil
+}
+
+func (r *repositoryMock) EnqueueEvent(_ context.Context, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, outboxEvent{
+		id:        int64(len(r.events) + 1),
+		eventType: eventType,
+		payload:   payload,
+		createdAt: time.Now(),
+	})
+
+	return nil
+}
+
+func (r *repositoryMock) DispatchEvents(_ context.Context, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var dispatched int64
+	for i := range r.events {
+		e := &r.events[i]
+		if e.dispatched || dispatched >= int64(limit) {
+			continue
+		}
+
+		for _, w := range r.webhooks {
+			if slices.Contains(w.EventTypes, e.eventType) {
+				r.deliveries = append(r.deliveries, domain.Delivery{
+					Id:            int64(len(r.deliveries) + 1),
+					WebhookId:     w.Id,
+					EventId:       e.id,
+					EventType:     e.eventType,
+					Status:        StatusPending,
+					NextAttemptAt: time.Now(),
+					CreatedAt:     time.Now(),
+				})
+			}
+		}
+
+		e.dispatched = true
+		dispatched++
+	}
+
+	return dispatched, nil
+}
+
+func (r *repositoryMock) ClaimDeliveries(_ context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pending []domain.PendingDelivery
+	for i := range r.deliveries {
+		d := &r.deliveries[i]
+		if d.Status != StatusPending || d.NextAttemptAt.After(time.Now()) || len(pending) >= limit {
+			continue
+		}
+
+		d.NextAttemptAt = time.Now().Add(lease)
+
+		w := r.webhooks[slices.IndexFunc(r.webhooks, func(w domain.Webhook) bool { return w.Id == d.WebhookId })]
+		e := r.events[d.EventId-1]
+
+		pending = append(pending, domain.PendingDelivery{
+			Id:             d.Id,
+			WebhookId:      d.WebhookId,
+			EventId:        d.EventId,
+			EventType:      d.EventType,
+			Attempts:       d.Attempts,
+			URL:            w.URL,
+			Secret:         w.Secret,
+			Payload:        e.payload,
+			EventCreatedAt: e.createdAt,
+		})
+	}
+
+	return pending, nil
+}
+
+func (r *repositoryMock) RecordAttempt(_ context.Context, a domain.Attempt, status string, nextAttemptAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a.CreatedAt = time.Now()
+	r.attempts = append(r.attempts, a)
+
+	d := &r.deliveries[a.DeliveryId-1]
+	d.Status = status
+	d.Attempts = a.Attempt
+	d.NextAttemptAt = nextAttemptAt
+	d.LastStatusCode = a.StatusCode
+	d.LastError = a.Error
+
+	return nil
+}
+
+func (r *repositoryMock) delivery(id int64) domain.Delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.deliveries[id-1]
+}
+
+func newTestWorker(repository *repositoryMock, maxAttempts int) *Worker {
+	return NewWorker(repository, &http.Client{}, logger, WorkerOptions{
+		PollInterval:   10 * time.Millisecond,
+		BatchSize:      10,
+		MaxAttempts:    maxAttempts,
+		RequestTimeout: time.Second,
+	})
+}
+
+func createWebhook(t *testing.T, handler *Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.CreateWebhook(rec, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", strings.NewReader(body)))
+
+	return rec
+}
+
+func TestCreateWebhookOk(t *testing.T) {
+	repository := &repositoryMock{}
+	handler := NewHandler(NewService(logger, repository))
+
+	rec := createWebhook(t, handler, `{"url": "https://example.com/hook", "event_types": ["balance.withdrawn", "balance.withdrawn"]}`)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+
+	var res WebhookResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Secret) != 64 {
+		t.Fatalf("expected generated secret to be returned on create, got %q", res.Secret)
+	}
+
+	if len(res.EventTypes) != 1 {
+		t.Fatalf("expected duplicate event types to be removed, got %v", res.EventTypes)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/webhooks/1", nil)
+	req.SetPathValue("id", "1")
+
+	handler.GetWebhook(rec, req)
+
+	if strings.Contains(rec.Body.String(), res.Secret) {
+		t.Fatal("expected secret not to be returned after create")
+	}
+}
+
+func TestCreateWebhookWithInvalidBody(t *testing.T) {
+	handler := NewHandler(NewService(logger, &repositoryMock{}))
+
+	bodies := []string{
+		`{"url": "example.com/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "ftp://example.com/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://localhost:8080/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://api.localhost/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://127.0.0.1/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://10.0.0.5/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://169.254.169.254/latest/meta-data", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://100.64.0.1/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://[::1]:8080/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "http://[::ffff:192.168.1.1]/hook", "event_types": ["balance.withdrawn"]}`,
+		`{"url": "https://example.com/hook", "event_types": []}`,
+		`{"url": "https://example.com/hook", "event_types": ["balance.stolen"]}`,
+		`{"url": "https://example.com/hook", "event_types": ["balance.withdrawn"], "secret": "short"}`,
+		`{"url": `,
+	}
+
+	for _, body := range bodies {
+		if rec := createWebhook(t, handler, body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestWorkerDeliversSignedPayload(t *testing.T) {
+	const secret = "receiver-secret-value"
+
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	repository := &repositoryMock{}
+	svc := NewService(logger, repository)
+
+	_, e := svc.CreateWebhook(context.Background(), CreateWebhookRequestBody{
+		URL:        receiver.URL,
+		EventTypes: []string{EventBalanceWithdrawn},
+		Secret:     secret,
+	})
+	if e != nil {
+		t.Fatal(e.Message)
+	}
+
+	_ = repository.EnqueueEvent(context.Background(), EventBalanceWithdrawn, BalanceEventData{UserId: 1, Amount: 50})
+	// Not subscribed, must not be delivered
+	_ = repository.EnqueueEvent(context.Background(), EventCatalogRefreshed, CatalogEventData{AppId: 730})
+
+	newTestWorker(repository, 3).poll(context.Background())
+
+	req := <-received
+	body := <-bodies
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Header.Get(SignatureHeader) != Sign(secret, timestamp, body) {
+		t.Fatalf("signature mismatch: %s", req.Header.Get(SignatureHeader))
+	}
+
+	if req.Header.Get(EventHeader) != EventBalanceWithdrawn {
+		t.Fatalf("expected event header %s, got %s", EventBalanceWithdrawn, req.Header.Get(EventHeader))
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	var data BalanceEventData
+	if err := json.Unmarshal(envelope.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if envelope.Type != EventBalanceWithdrawn || data.UserId != 1 || data.Amount != 50 {
+		t.Fatalf("unexpected envelope: %+v", envelope)
+	}
+
+	if len(repository.deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(repository.deliveries))
+	}
+
+	if d := repository.delivery(1); d.Status != StatusSucceeded || d.Attempts != 1 {
+		t.Fatalf("expected succeeded delivery after 1 attempt, got %+v", d)
+	}
+}
+
+func TestWorkerRetriesFailedDelivery(t *testing.T) {
+	var calls atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	repository := &repositoryMock{}
+	_, _ = repository.CreateWebhook(context.Background(), domain.Webhook{
+		URL:        receiver.URL,
+		Secret:     "receiver-secret-value",
+		EventTypes: []string{EventBalanceWithdrawn},
+	})
+	_ = repository.EnqueueEvent(context.Background(), EventBalanceWithdrawn, BalanceEventData{UserId: 1, Amount: 50})
+
+	worker := newTestWorker(repository, 5)
+	for range 3 {
+		worker.poll(context.Background())
+	}
+
+	d := repository.delivery(1)
+	if d.Status != StatusSucceeded || d.Attempts != 3 {
+		t.Fatalf("expected success on third attempt, got %+v", d)
+	}
+
+	handler := NewHandler(NewService(logger, repository))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/webhooks/1/deliveries/1", nil)
+	req.SetPathValue("id", "1")
+	req.SetPathValue("delivery_id", "1")
+
+	handler.GetDelivery(rec, req)
+
+	var res DeliveryResponseDTO
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.AttemptsLog) != 3 || *res.AttemptsLog[0].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 3 logged attempts starting with 500, got %+v", res.AttemptsLog)
+	}
+}
+
+func TestWorkerGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	repository := &repositoryMock{}
+	_, _ = repository.CreateWebhook(context.Background(), domain.Webhook{
+		URL:        receiver.URL,
+		Secret:     "receiver-secret-value",
+		EventTypes: []string{EventBalanceWithdrawn},
+	})
+	_ = repository.EnqueueEvent(context.Background(), EventBalanceWithdrawn, BalanceEventData{UserId: 1})
+
+	worker := newTestWorker(repository, 2)
+	for range 4 {
+		worker.poll(context.Background())
+	}
+
+	d := repository.delivery(1)
+	if d.Status != StatusFailed || d.Attempts != 2 {
+		t.Fatalf("expected failed delivery after 2 attempts, got %+v", d)
+	}
+
+	if d.LastStatusCode == nil || *d.LastStatusCode != http.StatusBadGateway {
+		t.Fatalf("expected last status code 502, got %v", d.LastStatusCode)
+	}
+}
+
+func TestDeliveryClientRefusesPrivateAddresses(t *testing.T) {
+	var called atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer receiver.Close()
+
+	repository := &repositoryMock{}
+	_, _ = repository.CreateWebhook(context.Background(), domain.Webhook{
+		URL:        receiver.URL,
+		Secret:     "receiver-secret-value",
+		EventTypes: []string{EventBalanceWithdrawn},
+	})
+	_ = repository.EnqueueEvent(context.Background(), EventBalanceWithdrawn, BalanceEventData{UserId: 1})
+
+	worker := NewWorker(repository, NewDeliveryClient(), logger, WorkerOptions{
+		PollInterval:   time.Second,
+		BatchSize:      10,
+		MaxAttempts:    1,
+		RequestTimeout: time.Second,
+	})
+	worker.poll(context.Background())
+	worker.poll(context.Background())
+
+	if called.Load() {
+		t.Fatal("expected loopback receiver not to be called")
+	}
+
+	d := repository.delivery(1)
+	if d.Status != StatusFailed || d.LastError == nil || !strings.Contains(*d.LastError, ForbiddenAddressError.Error()) {
+		t.Fatalf("expected delivery to fail with forbidden address, got %+v", d)
+	}
+}
+
+func TestCatalogRefreshEnqueuesEvent(t *testing.T) {
+	repository := &repositoryMock{}
+	svc := NewService(logger, repository)
+
+	refreshedAt := time.Date(2026, 10, 18, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	svc.OnCatalogRefresh(context.Background(), 730, "EUR", make([]item.GetItemsResponseDto, 3), refreshedAt)
+
+	if len(repository.events) != 1 || repository.events[0].eventType != EventCatalogRefreshed {
+		t.Fatalf("expected 1 catalog event, got %+v", repository.events)
+	}
+
+	var data CatalogEventData
+	if err := json.Unmarshal(repository.events[0].payload, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.AppId != 730 || data.Currency != "EUR" || data.ItemsCount != 3 || !data.RefreshedAt.Equal(refreshedAt) {
+		t.Fatalf("unexpected event data: %+v", data)
+	}
+}
+
+func TestQueuedCatalogEventIsEnqueuedInBackground(t *testing.T) {
+	repository := &repositoryMock{}
+	publisher := item.NewQueuedListener("catalog webhooks", NewService(logger, repository), logger, item.DefaultQueuedListenerOptions())
+
+	publisher.OnCatalogRefresh(context.Background(), 730, "EUR", make([]item.GetItemsResponseDto, 3), time.Now())
+
+	repository.mu.Lock()
+	queued := len(repository.events)
+	repository.mu.Unlock()
+
+	if queued != 0 {
+		t.Fatalf("expected the event not to be written on the refresh path, got %d", queued)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go publisher.Run(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		repository.mu.Lock()
+		written := len(repository.events)
+		repository.mu.Unlock()
+
+		if written == 1 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 catalog event from the worker, got %d", written)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
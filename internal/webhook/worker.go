@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bdzhalalov/kolikosoft-trade/internal/webhook/domain"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type WorkerRepositoryInterface interface {
+	DispatchEvents(ctx context.Context, limit int) (int64, error)
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error)
+	RecordAttempt(ctx context.Context, a domain.Attempt, status string, nextAttemptAt time.Time) error
+}
+
+type WorkerOptions struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	MaxAttempts    int
+	RequestTimeout time.Duration
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+}
+
+func DefaultWorkerOptions() WorkerOptions {
+	return WorkerOptions{
+		PollInterval:   time.Second,
+		BatchSize:      50,
+		MaxAttempts:    8,
+		RequestTimeout: 10 * time.Second,
+		BaseBackoff:    5 * time.Second,
+		MaxBackoff:     time.Hour,
+	}
+}
+
+// Envelope is the body posted to every webhook
+type Envelope struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type Worker struct {
+	repository WorkerRepositoryInterface
+	client     *http.Client
+	logger     *logrus.Logger
+	options    WorkerOptions
+}
+
+func NewWorker(
+	repository WorkerRepositoryInterface,
+	client *http.Client,
+	logger *logrus.Logger,
+	options WorkerOptions,
+) *Worker {
+	return &Worker{
+		repository: repository,
+		client:     client,
+		logger:     logger,
+		options:    options,
+	}
+}
+
+// Sign returns the signature receivers should compare with the signature
+// header: a hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run dispatches outbox events and sends due deliveries until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	w.logger.Infof("Starting webhook worker with interval %s", w.options.PollInterval)
+
+	ticker := time.NewTicker(w.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Webhook worker stopped")
+			return
+		case <-ticker.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+func (w *Worker) poll(ctx context.Context) {
+	if _, err := w.repository.DispatchEvents(ctx, w.options.BatchSize); err != nil && ctx.Err() == nil {
+		w.logger.Errorf("Error while dispatching webhook events: %s", err)
+	}
+
+	// A claimed delivery is hidden from other workers for as long as it may take to send
+	lease := w.options.RequestTimeout + w.options.PollInterval
+
+	deliveries, err := w.repository.ClaimDeliveries(ctx, w.options.BatchSize, lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.logger.Errorf("Error while claiming webhook deliveries: %s", err)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		wg.Go(func() {
+			w.deliver(ctx, d)
+		})
+	}
+	wg.Wait()
+}
+
+func (w *Worker) deliver(ctx context.Context, d domain.PendingDelivery) {
+	startedAt := time.Now()
+	statusCode, err := w.send(ctx, d)
+
+	// Leave the delivery to its lease, it is retried after a restart
+	if ctx.Err() != nil {
+		return
+	}
+
+	attempt := domain.Attempt{
+		DeliveryId: d.Id,
+		Attempt:    d.Attempts + 1,
+		Duration:   time.Since(startedAt),
+	}
+
+	if statusCode != 0 {
+		attempt.StatusCode = &statusCode
+	}
+
+	status := StatusSucceeded
+	nextAttemptAt := time.Now().UTC()
+
+	if err != nil {
+		message := err.Error()
+		attempt.Error = &message
+
+		status = StatusPending
+		nextAttemptAt = nextAttemptAt.Add(w.backoff(attempt.Attempt))
+
+		if attempt.Attempt >= w.options.MaxAttempts {
+			status = StatusFailed
+			w.logger.Warnf("Webhook delivery %d to %s failed after %d attempts: %s", d.Id, d.URL, attempt.Attempt, err)
+		}
+	}
+
+	if err := w.repository.RecordAttempt(ctx, attempt, status, nextAttemptAt); err != nil {
+		w.logger.Errorf("Error while recording webhook delivery attempt: %s", err)
+	}
+}
+
+func (w *Worker) send(ctx context.Context, d domain.PendingDelivery) (int, error) {
+	body, err := json.Marshal(Envelope{
+		Id:        d.EventId,
+		Type:      d.EventType,
+		CreatedAt: d.EventCreatedAt,
+		Data:      d.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if w.options.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.options.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.Id, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a bounded part of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the exponential delay before the next attempt with jitter
+// in the upper half, the same way the SkinPort client spaces its retries.
+func (w *Worker) backoff(attempt int) time.Duration {
+	delay := w.options.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > w.options.MaxBackoff {
+		delay = w.options.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/bdzhalalov/kolikosoft-trade/internal/server"
 	"github.com/bdzhalalov/kolikosoft-trade/pkg/config"
+	"os"
 	"os/signal"
 	"syscall"
 )
 
 func main() {
+	cfg := config.InitConfig()
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Invalid config: %s\n", err)
+		os.Exit(1)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	cfg := config.InitConfig()
-
-	server.Start(ctx, &cfg)
+	if err := server.Start(ctx, &cfg); err != nil {
+		stop()
+		fmt.Printf("Unable to start server: %s\n", err)
+		os.Exit(1)
+	}
 }
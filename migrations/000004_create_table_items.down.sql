@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS set_updated_at ON items;
+
+DROP INDEX IF EXISTS ux_items_app_market_hash_name;
+
+DROP TABLE IF EXISTS items;
\ No newline at end of file
@@ -0,0 +1,18 @@
+CREATE TABLE items (
+       id               BIGSERIAL PRIMARY KEY,
+       app_id           INTEGER NOT NULL,
+       market_hash_name VARCHAR(512) NOT NULL,
+       version          VARCHAR(256) NULL,
+       item_page        TEXT NOT NULL,
+       market_page      TEXT NOT NULL,
+       created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+       updated_at       TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX ux_items_app_market_hash_name
+    ON items(app_id, market_hash_name);
+
+CREATE TRIGGER set_updated_at
+    BEFORE UPDATE ON items
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
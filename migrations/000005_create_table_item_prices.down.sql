@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS ix_item_prices_item_currency_created;
+
+DROP TABLE IF EXISTS item_prices;
+
+DROP TABLE IF EXISTS item_snapshots;
\ No newline at end of file
@@ -0,0 +1,25 @@
+CREATE TABLE item_snapshots (
+       id          BIGSERIAL PRIMARY KEY,
+       app_id      INTEGER NOT NULL,
+       currency    VARCHAR(3) NOT NULL,
+       items_count INTEGER NOT NULL,
+       created_at  TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE item_prices (
+       snapshot_id          BIGINT NOT NULL REFERENCES item_snapshots(id) ON DELETE CASCADE,
+       item_id              BIGINT NOT NULL REFERENCES items(id),
+       currency             VARCHAR(3) NOT NULL,
+       suggested_price      DOUBLE PRECISION NOT NULL,
+       tradable_min_price   DOUBLE PRECISION NULL,
+       untradable_min_price DOUBLE PRECISION NULL,
+       max_price            DOUBLE PRECISION NOT NULL,
+       mean_price           DOUBLE PRECISION NOT NULL,
+       median_price         DOUBLE PRECISION NOT NULL,
+       quantity             INTEGER NOT NULL,
+       created_at           TIMESTAMP NOT NULL,
+       PRIMARY KEY (snapshot_id, item_id)
+);
+
+CREATE INDEX ix_item_prices_item_currency_created
+    ON item_prices(item_id, currency, created_at);
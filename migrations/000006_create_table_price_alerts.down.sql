@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS ix_price_alert_triggers_user;
+
+DROP TABLE IF EXISTS price_alert_triggers;
+
+DROP TRIGGER IF EXISTS set_updated_at ON price_alerts;
+
+DROP INDEX IF EXISTS ix_price_alerts_active_catalog;
+
+DROP INDEX IF EXISTS ix_price_alerts_user;
+
+DROP TABLE IF EXISTS price_alerts;
\ No newline at end of file
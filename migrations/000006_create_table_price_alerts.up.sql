@@ -0,0 +1,39 @@
+CREATE TABLE price_alerts (
+       id               BIGSERIAL PRIMARY KEY,
+       user_id          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+       app_id           INTEGER NOT NULL,
+       currency         VARCHAR(3) NOT NULL,
+       market_hash_name VARCHAR(512) NOT NULL,
+       direction        VARCHAR(5) NOT NULL CHECK (direction IN ('below', 'above')),
+       threshold        DOUBLE PRECISION NOT NULL CHECK (threshold > 0),
+       active           BOOLEAN NOT NULL DEFAULT TRUE,
+       is_triggered     BOOLEAN NOT NULL DEFAULT FALSE,
+       created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+       updated_at       TIMESTAMP NULL
+);
+
+CREATE INDEX ix_price_alerts_user
+    ON price_alerts(user_id);
+
+CREATE INDEX ix_price_alerts_active_catalog
+    ON price_alerts(app_id, currency)
+    WHERE active;
+
+CREATE TRIGGER set_updated_at
+    BEFORE UPDATE ON price_alerts
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
+
+CREATE TABLE price_alert_triggers (
+       id               BIGSERIAL PRIMARY KEY,
+       alert_id         BIGINT NOT NULL REFERENCES price_alerts(id) ON DELETE CASCADE,
+       user_id          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+       market_hash_name VARCHAR(512) NOT NULL,
+       direction        VARCHAR(5) NOT NULL,
+       threshold        DOUBLE PRECISION NOT NULL,
+       price            DOUBLE PRECISION NOT NULL,
+       created_at       TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ix_price_alert_triggers_user
+    ON price_alert_triggers(user_id, id);
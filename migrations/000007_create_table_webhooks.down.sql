@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS ix_webhook_delivery_attempts_delivery;
+
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+
+DROP TRIGGER IF EXISTS set_updated_at ON webhook_deliveries;
+
+DROP INDEX IF EXISTS ix_webhook_deliveries_pending;
+
+DROP INDEX IF EXISTS ux_webhook_deliveries_webhook_event;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP INDEX IF EXISTS ix_webhook_outbox_pending;
+
+DROP TABLE IF EXISTS webhook_outbox;
+
+DROP TRIGGER IF EXISTS set_updated_at ON webhooks;
+
+DROP TABLE IF EXISTS webhooks;
\ No newline at end of file
@@ -0,0 +1,65 @@
+CREATE TABLE webhooks (
+       id          BIGSERIAL PRIMARY KEY,
+       url         TEXT NOT NULL,
+       secret      VARCHAR(128) NOT NULL,
+       event_types TEXT[] NOT NULL,
+       created_at  TIMESTAMP NOT NULL DEFAULT now(),
+       updated_at  TIMESTAMP NULL
+);
+
+CREATE TRIGGER set_updated_at
+    BEFORE UPDATE ON webhooks
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
+
+CREATE TABLE webhook_outbox (
+       id            BIGSERIAL PRIMARY KEY,
+       event_type    VARCHAR(64) NOT NULL,
+       payload       JSONB NOT NULL,
+       created_at    TIMESTAMP NOT NULL DEFAULT now(),
+       dispatched_at TIMESTAMP NULL
+);
+
+CREATE INDEX ix_webhook_outbox_pending
+    ON webhook_outbox(id)
+    WHERE dispatched_at IS NULL;
+
+CREATE TABLE webhook_deliveries (
+       id               BIGSERIAL PRIMARY KEY,
+       webhook_id       BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+       event_id         BIGINT NOT NULL REFERENCES webhook_outbox(id),
+       event_type       VARCHAR(64) NOT NULL,
+       status           VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+       attempts         INTEGER NOT NULL DEFAULT 0,
+       next_attempt_at  TIMESTAMP NOT NULL DEFAULT now(),
+       last_status_code INTEGER NULL,
+       last_error       TEXT NULL,
+       delivered_at     TIMESTAMP NULL,
+       created_at       TIMESTAMP NOT NULL DEFAULT now(),
+       updated_at       TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX ux_webhook_deliveries_webhook_event
+    ON webhook_deliveries(webhook_id, event_id);
+
+CREATE INDEX ix_webhook_deliveries_pending
+    ON webhook_deliveries(next_attempt_at)
+    WHERE status = 'pending';
+
+CREATE TRIGGER set_updated_at
+    BEFORE UPDATE ON webhook_deliveries
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
+
+CREATE TABLE webhook_delivery_attempts (
+       id          BIGSERIAL PRIMARY KEY,
+       delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+       attempt     INTEGER NOT NULL,
+       status_code INTEGER NULL,
+       error       TEXT NULL,
+       duration_ms BIGINT NOT NULL,
+       created_at  TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ix_webhook_delivery_attempts_delivery
+    ON webhook_delivery_attempts(delivery_id, attempt);
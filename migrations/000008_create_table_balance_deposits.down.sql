@@ -0,0 +1,5 @@
+DROP VIEW IF EXISTS balance_transactions;
+
+DROP INDEX IF EXISTS ux_balance_deposits_user_request;
+
+DROP TABLE IF EXISTS balance_deposits;
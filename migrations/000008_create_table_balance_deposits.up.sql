@@ -0,0 +1,20 @@
+CREATE TABLE balance_deposits (
+         id             BIGINT PRIMARY KEY DEFAULT nextval('balance_withdrawals_id_seq'),
+         user_id        BIGINT NOT NULL REFERENCES users(id),
+         amount         BIGINT NOT NULL CHECK (amount > 0),
+         balance_before BIGINT NOT NULL,
+         balance_after  BIGINT NOT NULL,
+         created_at     TIMESTAMP NOT NULL DEFAULT now(),
+         request_id     VARCHAR(256) NOT NULL
+);
+
+CREATE UNIQUE INDEX ux_balance_deposits_user_request
+    ON balance_deposits(user_id, request_id);
+
+-- Deposits share the withdrawals sequence, so ids are unique across the history.
+CREATE VIEW balance_transactions AS
+    SELECT id, user_id, 'withdrawal' AS type, amount, balance_before, balance_after, created_at
+    FROM balance_withdrawals
+    UNION ALL
+    SELECT id, user_id, 'deposit' AS type, amount, balance_before, balance_after, created_at
+    FROM balance_deposits;
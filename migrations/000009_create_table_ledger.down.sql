@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS create_ledger_account ON users;
+
+DROP FUNCTION IF EXISTS ledger_create_user_account();
+
+DROP TABLE IF EXISTS ledger_postings;
+
+DROP TABLE IF EXISTS ledger_entries;
+
+DROP TABLE IF EXISTS ledger_accounts;
+
+DROP FUNCTION IF EXISTS ledger_check_entry_balanced();
+
+DROP FUNCTION IF EXISTS ledger_forbid_change();
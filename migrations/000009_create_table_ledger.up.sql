@@ -0,0 +1,118 @@
+CREATE TABLE ledger_accounts (
+         id         BIGSERIAL PRIMARY KEY,
+         code       VARCHAR(64) NOT NULL UNIQUE,
+         type       VARCHAR(16) NOT NULL CHECK (type IN ('user', 'system', 'fee', 'revenue')),
+         user_id    BIGINT NULL UNIQUE REFERENCES users(id),
+         created_at TIMESTAMP NOT NULL DEFAULT now(),
+         CHECK ((type = 'user') = (user_id IS NOT NULL))
+);
+
+CREATE TABLE ledger_entries (
+         id         BIGSERIAL PRIMARY KEY,
+         type       VARCHAR(32) NOT NULL,
+         reference  VARCHAR(128) NOT NULL,
+         created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ix_ledger_entries_reference ON ledger_entries(reference);
+
+-- Amounts are signed: a positive posting increases the account balance and
+-- the postings of every entry sum up to zero.
+CREATE TABLE ledger_postings (
+         id         BIGSERIAL PRIMARY KEY,
+         entry_id   BIGINT NOT NULL REFERENCES ledger_entries(id),
+         account_id BIGINT NOT NULL REFERENCES ledger_accounts(id),
+         amount     BIGINT NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX ix_ledger_postings_entry ON ledger_postings(entry_id);
+CREATE INDEX ix_ledger_postings_account ON ledger_postings(account_id);
+
+CREATE OR REPLACE FUNCTION ledger_forbid_change()
+    RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger records are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER forbid_change
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW
+    EXECUTE FUNCTION ledger_forbid_change();
+
+CREATE TRIGGER forbid_change
+    BEFORE UPDATE OR DELETE ON ledger_postings
+    FOR EACH ROW
+    EXECUTE FUNCTION ledger_forbid_change();
+
+CREATE OR REPLACE FUNCTION ledger_check_entry_balanced()
+    RETURNS TRIGGER AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger_postings WHERE entry_id = NEW.entry_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger entry % is not balanced', NEW.entry_id;
+    END IF;
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Checked at commit, once every posting of the entry is written
+CREATE CONSTRAINT TRIGGER check_entry_balanced
+    AFTER INSERT ON ledger_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+    EXECUTE FUNCTION ledger_check_entry_balanced();
+
+-- A user created with a balance gets it opened against the cash account, the
+-- same way existing balances are opened below
+CREATE OR REPLACE FUNCTION ledger_create_user_account()
+    RETURNS TRIGGER AS $$
+DECLARE
+    account BIGINT;
+    entry BIGINT;
+BEGIN
+    INSERT INTO ledger_accounts(code, type, user_id) VALUES ('user:' || NEW.id, 'user', NEW.id)
+    RETURNING id INTO account;
+
+    IF NEW.balance <> 0 THEN
+        INSERT INTO ledger_entries(type, reference) VALUES ('opening_balance', 'user:' || NEW.id)
+        RETURNING id INTO entry;
+
+        INSERT INTO ledger_postings(entry_id, account_id, amount)
+        SELECT entry, account, NEW.balance
+        UNION ALL
+        SELECT entry, id, -NEW.balance FROM ledger_accounts WHERE code = 'system:cash';
+    END IF;
+RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER create_ledger_account
+    AFTER INSERT ON users
+    FOR EACH ROW
+    EXECUTE FUNCTION ledger_create_user_account();
+
+INSERT INTO ledger_accounts(code, type) VALUES
+    ('system:cash', 'system'),
+    ('system:fees', 'fee'),
+    ('system:revenue', 'revenue');
+
+INSERT INTO ledger_accounts(code, type, user_id)
+SELECT 'user:' || id, 'user', id FROM users;
+
+-- Existing balances are opened against the cash account
+DO $$
+DECLARE
+    u RECORD;
+    entry BIGINT;
+BEGIN
+    FOR u IN SELECT id, balance FROM users WHERE balance <> 0 ORDER BY id LOOP
+        INSERT INTO ledger_entries(type, reference) VALUES ('opening_balance', 'user:' || u.id)
+        RETURNING id INTO entry;
+
+        INSERT INTO ledger_postings(entry_id, account_id, amount)
+        SELECT entry, id, u.balance FROM ledger_accounts WHERE code = 'user:' || u.id
+        UNION ALL
+        SELECT entry, id, -u.balance FROM ledger_accounts WHERE code = 'system:cash';
+    END LOOP;
+END;
+$$;
@@ -0,0 +1,14 @@
+DROP VIEW IF EXISTS balance_transactions;
+
+CREATE VIEW balance_transactions AS
+    SELECT id, user_id, 'withdrawal' AS type, amount, balance_before, balance_after, created_at
+    FROM balance_withdrawals
+    UNION ALL
+    SELECT id, user_id, 'deposit' AS type, amount, balance_before, balance_after, created_at
+    FROM balance_deposits;
+
+DROP INDEX IF EXISTS ix_balance_transfers_to_user;
+
+DROP INDEX IF EXISTS ux_balance_transfers_user_request;
+
+DROP TABLE IF EXISTS balance_transfers;
@@ -0,0 +1,37 @@
+CREATE TABLE balance_transfers (
+         id                  BIGINT PRIMARY KEY DEFAULT nextval('balance_withdrawals_id_seq'),
+         from_user_id        BIGINT NOT NULL REFERENCES users(id),
+         to_user_id          BIGINT NOT NULL REFERENCES users(id),
+         amount              BIGINT NOT NULL CHECK (amount > 0),
+         from_balance_before BIGINT NOT NULL,
+         from_balance_after  BIGINT NOT NULL,
+         to_balance_before   BIGINT NOT NULL,
+         to_balance_after    BIGINT NOT NULL,
+         created_at          TIMESTAMP NOT NULL DEFAULT now(),
+         request_id          VARCHAR(256) NOT NULL,
+         CHECK (from_user_id <> to_user_id)
+);
+
+CREATE UNIQUE INDEX ux_balance_transfers_user_request
+    ON balance_transfers(from_user_id, request_id);
+
+CREATE INDEX ix_balance_transfers_to_user
+    ON balance_transfers(to_user_id);
+
+-- A transfer shows up in the history of both users under the same id
+CREATE OR REPLACE VIEW balance_transactions AS
+    SELECT id, user_id, 'withdrawal' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id
+    FROM balance_withdrawals
+    UNION ALL
+    SELECT id, user_id, 'deposit' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id
+    FROM balance_deposits
+    UNION ALL
+    SELECT id, from_user_id, 'transfer_out' AS type, amount, from_balance_before, from_balance_after, created_at,
+           to_user_id AS counterparty_user_id
+    FROM balance_transfers
+    UNION ALL
+    SELECT id, to_user_id, 'transfer_in' AS type, amount, to_balance_before, to_balance_after, created_at,
+           from_user_id AS counterparty_user_id
+    FROM balance_transfers;
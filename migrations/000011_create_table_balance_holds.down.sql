@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS set_updated_at ON balance_holds;
+
+DROP INDEX IF EXISTS ix_balance_holds_active_expires_at;
+
+DROP INDEX IF EXISTS ux_balance_holds_user_request;
+
+DROP TABLE IF EXISTS balance_holds;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS chk_users_held_balance,
+    DROP COLUMN IF EXISTS held_balance;
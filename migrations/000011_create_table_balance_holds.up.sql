@@ -0,0 +1,30 @@
+-- users.balance stays the total, the available part is balance - held_balance
+ALTER TABLE users
+    ADD COLUMN held_balance BIGINT NOT NULL DEFAULT 0,
+    ADD CONSTRAINT chk_users_held_balance CHECK (held_balance >= 0 AND held_balance <= balance);
+
+CREATE TABLE balance_holds (
+         id              BIGSERIAL PRIMARY KEY,
+         user_id         BIGINT NOT NULL REFERENCES users(id),
+         amount          BIGINT NOT NULL CHECK (amount > 0),
+         status          VARCHAR(16) NOT NULL DEFAULT 'active'
+                         CHECK (status IN ('active', 'captured', 'released', 'expired')),
+         captured_amount BIGINT NULL,
+         withdrawal_id   BIGINT NULL REFERENCES balance_withdrawals(id),
+         request_id      VARCHAR(256) NOT NULL,
+         expires_at      TIMESTAMP NOT NULL,
+         created_at      TIMESTAMP NOT NULL DEFAULT now(),
+         updated_at      TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX ux_balance_holds_user_request
+    ON balance_holds(user_id, request_id);
+
+CREATE INDEX ix_balance_holds_active_expires_at
+    ON balance_holds(expires_at)
+    WHERE status = 'active';
+
+CREATE TRIGGER set_updated_at
+    BEFORE UPDATE ON balance_holds
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
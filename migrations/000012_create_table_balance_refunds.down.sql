@@ -0,0 +1,28 @@
+DROP VIEW IF EXISTS balance_transactions;
+
+CREATE VIEW balance_transactions AS
+    SELECT id, user_id, 'withdrawal' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id
+    FROM balance_withdrawals
+    UNION ALL
+    SELECT id, user_id, 'deposit' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id
+    FROM balance_deposits
+    UNION ALL
+    SELECT id, from_user_id, 'transfer_out' AS type, amount, from_balance_before, from_balance_after, created_at,
+           to_user_id AS counterparty_user_id
+    FROM balance_transfers
+    UNION ALL
+    SELECT id, to_user_id, 'transfer_in' AS type, amount, to_balance_before, to_balance_after, created_at,
+           from_user_id AS counterparty_user_id
+    FROM balance_transfers;
+
+DROP INDEX IF EXISTS ix_balance_refunds_withdrawal;
+
+DROP INDEX IF EXISTS ux_balance_refunds_user_request;
+
+DROP TABLE IF EXISTS balance_refunds;
+
+ALTER TABLE balance_withdrawals
+    DROP CONSTRAINT IF EXISTS chk_balance_withdrawals_refunded_amount,
+    DROP COLUMN IF EXISTS refunded_amount;
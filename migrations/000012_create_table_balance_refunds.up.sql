@@ -0,0 +1,42 @@
+ALTER TABLE balance_withdrawals
+    ADD COLUMN refunded_amount BIGINT NOT NULL DEFAULT 0,
+    ADD CONSTRAINT chk_balance_withdrawals_refunded_amount CHECK (refunded_amount >= 0 AND refunded_amount <= amount);
+
+CREATE TABLE balance_refunds (
+         id             BIGINT PRIMARY KEY DEFAULT nextval('balance_withdrawals_id_seq'),
+         user_id        BIGINT NOT NULL REFERENCES users(id),
+         withdrawal_id  BIGINT NOT NULL REFERENCES balance_withdrawals(id),
+         amount         BIGINT NOT NULL CHECK (amount > 0),
+         balance_before BIGINT NOT NULL,
+         balance_after  BIGINT NOT NULL,
+         created_at     TIMESTAMP NOT NULL DEFAULT now(),
+         request_id     VARCHAR(256) NOT NULL
+);
+
+CREATE UNIQUE INDEX ux_balance_refunds_user_request
+    ON balance_refunds(user_id, request_id);
+
+CREATE INDEX ix_balance_refunds_withdrawal
+    ON balance_refunds(withdrawal_id);
+
+-- Refunds link to the refunded withdrawal through withdrawal_id
+CREATE OR REPLACE VIEW balance_transactions AS
+    SELECT id, user_id, 'withdrawal' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id, NULL::bigint AS withdrawal_id
+    FROM balance_withdrawals
+    UNION ALL
+    SELECT id, user_id, 'deposit' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id, NULL::bigint AS withdrawal_id
+    FROM balance_deposits
+    UNION ALL
+    SELECT id, from_user_id, 'transfer_out' AS type, amount, from_balance_before, from_balance_after, created_at,
+           to_user_id AS counterparty_user_id, NULL::bigint AS withdrawal_id
+    FROM balance_transfers
+    UNION ALL
+    SELECT id, to_user_id, 'transfer_in' AS type, amount, to_balance_before, to_balance_after, created_at,
+           from_user_id AS counterparty_user_id, NULL::bigint AS withdrawal_id
+    FROM balance_transfers
+    UNION ALL
+    SELECT id, user_id, 'refund' AS type, amount, balance_before, balance_after, created_at,
+           NULL::bigint AS counterparty_user_id, withdrawal_id
+    FROM balance_refunds;
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS ix_balance_transfers_to_user_created_at;
+
+CREATE INDEX ix_balance_transfers_to_user
+    ON balance_transfers(to_user_id);
+
+DROP INDEX IF EXISTS ix_balance_transfers_from_user_created_at;
+
+DROP INDEX IF EXISTS ix_balance_refunds_user_created_at;
+
+DROP INDEX IF EXISTS ix_balance_deposits_user_created_at;
+
+DROP INDEX IF EXISTS ix_balance_withdrawals_user_created_at;
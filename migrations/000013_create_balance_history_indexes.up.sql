@@ -0,0 +1,16 @@
+CREATE INDEX ix_balance_withdrawals_user_created_at
+    ON balance_withdrawals(user_id, created_at);
+
+CREATE INDEX ix_balance_deposits_user_created_at
+    ON balance_deposits(user_id, created_at);
+
+CREATE INDEX ix_balance_refunds_user_created_at
+    ON balance_refunds(user_id, created_at);
+
+CREATE INDEX ix_balance_transfers_from_user_created_at
+    ON balance_transfers(from_user_id, created_at);
+
+DROP INDEX IF EXISTS ix_balance_transfers_to_user;
+
+CREATE INDEX ix_balance_transfers_to_user_created_at
+    ON balance_transfers(to_user_id, created_at);
@@ -0,0 +1,30 @@
+-- The row with user_id NULL holds global limits, a user row overrides them
+-- field by field. NULL means no limit.
+CREATE TABLE withdrawal_limits (
+         id                   BIGSERIAL PRIMARY KEY,
+         user_id              BIGINT NULL REFERENCES users(id) ON DELETE CASCADE,
+         max_amount           BIGINT NULL CHECK (max_amount > 0),
+         daily_amount         BIGINT NULL CHECK (daily_amount > 0),
+         monthly_amount       BIGINT NULL CHECK (monthly_amount > 0),
+         max_count            INTEGER NULL CHECK (max_count > 0),
+         count_window_seconds BIGINT NULL CHECK (count_window_seconds > 0),
+         created_at           TIMESTAMP NOT NULL DEFAULT now(),
+         updated_at           TIMESTAMP NULL,
+         CONSTRAINT chk_withdrawal_limits_count_window
+             CHECK ((max_count IS NULL) = (count_window_seconds IS NULL))
+);
+
+CREATE UNIQUE INDEX ux_withdrawal_limits_user
+    ON withdrawal_limits(user_id)
+    WHERE user_id IS NOT NULL;
+
+CREATE UNIQUE INDEX ux_withdrawal_limits_global
+    ON withdrawal_limits((user_id IS NULL))
+    WHERE user_id IS NULL;
+
+CREATE TRIGGER set_updated_at
+    BEFORE UPDATE ON withdrawal_limits
+    FOR EACH ROW
+    EXECUTE FUNCTION trigger_set_updated_at();
+
+INSERT INTO withdrawal_limits(user_id) VALUES (NULL);
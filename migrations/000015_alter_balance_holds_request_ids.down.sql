@@ -0,0 +1,10 @@
+ALTER TABLE balance_holds
+    DROP COLUMN IF EXISTS finish_request_id;
+
+UPDATE balance_withdrawals w
+SET request_id = 'hold:' || h.id
+FROM balance_holds h
+WHERE h.withdrawal_id = w.id;
+
+ALTER TABLE balance_withdrawals
+    ALTER COLUMN request_id SET NOT NULL;
@@ -0,0 +1,13 @@
+-- Captures are linked by balance_holds.withdrawal_id only, so they do not take
+-- request ids from the namespace clients use for withdrawals
+ALTER TABLE balance_withdrawals
+    ALTER COLUMN request_id DROP NOT NULL;
+
+UPDATE balance_withdrawals w
+SET request_id = NULL
+FROM balance_holds h
+WHERE h.withdrawal_id = w.id;
+
+-- Idempotency-Key of the capture or release that finished the hold
+ALTER TABLE balance_holds
+    ADD COLUMN finish_request_id VARCHAR(256) NULL;
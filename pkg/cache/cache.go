@@ -6,8 +6,9 @@ import (
 )
 
 type entry struct {
-	value     any
-	expiresAt time.Time
+	value      any
+	expiresAt  time.Time
+	staleUntil time.Time
 }
 
 type Cache struct {
@@ -22,28 +23,49 @@ func New() *Cache {
 }
 
 func (c *Cache) Set(key string, value any, duration time.Duration) {
+	c.SetWithStale(key, value, duration, 0)
+}
+
+// SetWithStale stores value as fresh for duration and keeps it available
+// through GetStale for staleDuration after that.
+func (c *Cache) SetWithStale(key string, value any, duration time.Duration, staleDuration time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	expiresAt := time.Now().Add(duration)
+
 	e := entry{
-		value:     value,
-		expiresAt: time.Now().Add(duration),
+		value:      value,
+		expiresAt:  expiresAt,
+		staleUntil: expiresAt.Add(staleDuration),
 	}
 
 	c.storage[key] = e
 }
 
 func (c *Cache) Get(key string) (any, bool) {
+	value, fresh, exists := c.GetStale(key)
+	if !exists || !fresh {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// GetStale returns the stored value while it is fresh or stale. The fresh flag
+// reports whether the value has not expired yet.
+func (c *Cache) GetStale(key string) (any, bool, bool) {
 	c.mu.RLock()
 	e, exists := c.storage[key]
 	c.mu.RUnlock()
 
 	if !exists {
-		return nil, false
+		return nil, false, false
 	}
 
-	if time.Now().Before(e.expiresAt) {
-		return e.value, true
+	now := time.Now()
+	if now.Before(e.staleUntil) {
+		return e.value, now.Before(e.expiresAt), true
 	}
 
 	c.mu.Lock()
@@ -51,13 +73,14 @@ func (c *Cache) Get(key string) (any, bool) {
 
 	checkedEntry, ok := c.storage[key]
 	if !ok {
-		return nil, false
+		return nil, false, false
 	}
 
-	if time.Now().Before(checkedEntry.expiresAt) {
-		return checkedEntry.value, true
+	now = time.Now()
+	if now.Before(checkedEntry.staleUntil) {
+		return checkedEntry.value, now.Before(checkedEntry.expiresAt), true
 	}
 
 	delete(c.storage, key)
-	return nil, false
+	return nil, false, false
 }
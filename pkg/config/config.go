@@ -1,19 +1,46 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"time"
 )
 
 type Config struct {
-	Addr            string `mapstructure:"ADDR"`
-	LogLevel        string `mapstructure:"LOG_LEVEL"`
-	DbName          string `mapstructure:"DB_NAME"`
-	DbHost          string `mapstructure:"DB_HOST"`
-	DbPort          int    `mapstructure:"DB_PORT"`
-	DbUser          string `mapstructure:"DB_USER"`
-	DbPass          string `mapstructure:"DB_PASSWORD"`
-	SkinPortBaseURL string `mapstructure:"SKINPORT_BASE_URL"`
+	Addr            string        `mapstructure:"ADDR"`
+	LogLevel        string        `mapstructure:"LOG_LEVEL"`
+	DbName          string        `mapstructure:"DB_NAME"`
+	DbHost          string        `mapstructure:"DB_HOST"`
+	DbPort          int           `mapstructure:"DB_PORT"`
+	DbUser          string        `mapstructure:"DB_USER"`
+	DbPass          string        `mapstructure:"DB_PASSWORD"`
+	SkinPortBaseURL string        `mapstructure:"SKINPORT_BASE_URL"`
+	ItemsCacheTTL   time.Duration `mapstructure:"ITEMS_CACHE_TTL"`
+	ItemsStaleTTL   time.Duration `mapstructure:"ITEMS_STALE_TTL"`
+
+	SalesHistoryCacheTTL time.Duration `mapstructure:"SALES_HISTORY_CACHE_TTL"`
+
+	ItemsRefreshInterval time.Duration `mapstructure:"ITEMS_REFRESH_INTERVAL"`
+	ItemsRefreshCatalogs string        `mapstructure:"ITEMS_REFRESH_CATALOGS"`
+	ItemsProviders       string        `mapstructure:"ITEMS_PROVIDERS"`
+	SkinPortRateLimit    int           `mapstructure:"SKINPORT_RATE_LIMIT"`
+	SkinPortRateWindow   time.Duration `mapstructure:"SKINPORT_RATE_WINDOW"`
+	SkinPortTimeout      time.Duration `mapstructure:"SKINPORT_TIMEOUT"`
+	SkinPortMaxRetries   int           `mapstructure:"SKINPORT_MAX_RETRIES"`
+
+	SkinPortBreakerThreshold        int           `mapstructure:"SKINPORT_BREAKER_THRESHOLD"`
+	SkinPortBreakerCoolDown         time.Duration `mapstructure:"SKINPORT_BREAKER_COOLDOWN"`
+	SkinPortBreakerHalfOpenRequests int           `mapstructure:"SKINPORT_BREAKER_HALF_OPEN_REQUESTS"`
+
+	WebhookPollInterval time.Duration `mapstructure:"WEBHOOK_POLL_INTERVAL"`
+	WebhookTimeout      time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookMaxAttempts  int           `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+
+	LedgerReconcileInterval time.Duration `mapstructure:"LEDGER_RECONCILE_INTERVAL"`
+
+	BalanceHoldTTL           time.Duration `mapstructure:"BALANCE_HOLD_TTL"`
+	BalanceHoldSweepInterval time.Duration `mapstructure:"BALANCE_HOLD_SWEEP_INTERVAL"`
 }
 
 var Cfg Config
@@ -24,6 +51,26 @@ func InitConfig() Config {
 	viper.SetConfigType("env")
 	viper.AddConfigPath(".")
 
+	viper.SetDefault("ITEMS_CACHE_TTL", "5m")
+	viper.SetDefault("ITEMS_STALE_TTL", "1h")
+	viper.SetDefault("SALES_HISTORY_CACHE_TTL", "10m")
+	viper.SetDefault("ITEMS_REFRESH_INTERVAL", "5m")
+	viper.SetDefault("ITEMS_REFRESH_CATALOGS", "730:EUR")
+	viper.SetDefault("ITEMS_PROVIDERS", "")
+	viper.SetDefault("SKINPORT_RATE_LIMIT", 8)
+	viper.SetDefault("SKINPORT_RATE_WINDOW", "5m")
+	viper.SetDefault("SKINPORT_TIMEOUT", "10s")
+	viper.SetDefault("SKINPORT_MAX_RETRIES", 3)
+	viper.SetDefault("SKINPORT_BREAKER_THRESHOLD", 5)
+	viper.SetDefault("SKINPORT_BREAKER_COOLDOWN", "30s")
+	viper.SetDefault("SKINPORT_BREAKER_HALF_OPEN_REQUESTS", 2)
+	viper.SetDefault("WEBHOOK_POLL_INTERVAL", "1s")
+	viper.SetDefault("WEBHOOK_TIMEOUT", "10s")
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 8)
+	viper.SetDefault("LEDGER_RECONCILE_INTERVAL", "1h")
+	viper.SetDefault("BALANCE_HOLD_TTL", "15m")
+	viper.SetDefault("BALANCE_HOLD_SWEEP_INTERVAL", "1m")
+
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Printf("Error reading config file, %s\n", err)
 	}
@@ -35,3 +82,48 @@ func InitConfig() Config {
 
 	return Cfg
 }
+
+// Validate rejects values the service can not run with, e.g. a zero interval
+// panics in time.NewTicker and a zero rate limit never refills.
+func (c Config) Validate() error {
+	var errs []error
+
+	positiveDurations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"ITEMS_REFRESH_INTERVAL", c.ItemsRefreshInterval},
+		{"SKINPORT_RATE_WINDOW", c.SkinPortRateWindow},
+		{"SKINPORT_BREAKER_COOLDOWN", c.SkinPortBreakerCoolDown},
+		{"WEBHOOK_POLL_INTERVAL", c.WebhookPollInterval},
+		{"LEDGER_RECONCILE_INTERVAL", c.LedgerReconcileInterval},
+		{"BALANCE_HOLD_TTL", c.BalanceHoldTTL},
+		{"BALANCE_HOLD_SWEEP_INTERVAL", c.BalanceHoldSweepInterval},
+	}
+	for _, d := range positiveDurations {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than 0, got %s", d.name, d.value))
+		}
+	}
+
+	positiveInts := []struct {
+		name  string
+		value int
+	}{
+		{"SKINPORT_RATE_LIMIT", c.SkinPortRateLimit},
+		{"SKINPORT_BREAKER_THRESHOLD", c.SkinPortBreakerThreshold},
+		{"SKINPORT_BREAKER_HALF_OPEN_REQUESTS", c.SkinPortBreakerHalfOpenRequests},
+		{"WEBHOOK_MAX_ATTEMPTS", c.WebhookMaxAttempts},
+	}
+	for _, i := range positiveInts {
+		if i.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than 0, got %d", i.name, i.value))
+		}
+	}
+
+	if c.SkinPortMaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("SKINPORT_MAX_RETRIES must not be negative, got %d", c.SkinPortMaxRetries))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,15 @@
+package error
+
+import "net/http"
+
+type ConflictError struct {
+	Message string
+	Code    int
+}
+
+func (e *ConflictError) New(message string) *BaseError {
+	return &BaseError{
+		Message: message,
+		Code:    http.StatusConflict,
+	}
+}
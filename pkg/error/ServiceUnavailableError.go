@@ -0,0 +1,15 @@
+package error
+
+import "net/http"
+
+type ServiceUnavailableError struct {
+	Message string
+	Code    int
+}
+
+func (e *ServiceUnavailableError) New(message string) *BaseError {
+	return &BaseError{
+		Message: message,
+		Code:    http.StatusServiceUnavailable,
+	}
+}
@@ -0,0 +1,15 @@
+package error
+
+import "net/http"
+
+type UnprocessableEntityError struct {
+	Message string
+	Code    int
+}
+
+func (e *UnprocessableEntityError) New(message string) *BaseError {
+	return &BaseError{
+		Message: message,
+		Code:    http.StatusUnprocessableEntity,
+	}
+}
@@ -0,0 +1,66 @@
+package singleflight
+
+import "sync"
+
+type Result struct {
+	Value  any
+	Err    error
+	Shared bool
+}
+
+type call struct {
+	done    chan struct{}
+	value   any
+	err     error
+	waiters int
+}
+
+// Group coalesces concurrent calls with the same key into a single execution
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+func (g *Group) Do(key string, fn func() (any, error)) (any, error, bool) {
+	res := <-g.DoChan(key, fn)
+	return res.Value, res.Err, res.Shared
+}
+
+func (g *Group) DoChan(key string, fn func() (any, error)) <-chan Result {
+	ch := make(chan Result, 1)
+
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		g.mu.Unlock()
+
+		go func() {
+			<-c.done
+			ch <- Result{Value: c.value, Err: c.err, Shared: true}
+		}()
+
+		return ch
+	}
+
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go func() {
+		c.value, c.err = fn()
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		shared := c.waiters > 0
+		g.mu.Unlock()
+
+		close(c.done)
+		ch <- Result{Value: c.value, Err: c.err, Shared: shared}
+	}()
+
+	return ch
+}